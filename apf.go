@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	flowcontrolv1beta1 "k8s.io/api/flowcontrol/v1beta1"
+	restclient "k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	apfUserPrefix = "load-simulator-"
+
+	flowSchemaUIDHeader    = "X-Kubernetes-PF-FlowSchema-UID"
+	priorityLevelUIDHeader = "X-Kubernetes-PF-PriorityLevel-UID"
+)
+
+// apfIdentity is a group of runners sending their requests as the same
+// impersonated user, which a FlowSchema can match.
+type apfIdentity struct {
+	name   string
+	weight int
+}
+
+// parseIdentities parses "name=weight,..." e.g. "hub=20,agent=80".
+func parseIdentities(s string) ([]apfIdentity, error) {
+	out := []apfIdentity{}
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid identity %q, expecting name=weight", item)
+		}
+
+		w, err := strconv.Atoi(kv[1])
+		if err != nil || w <= 0 {
+			return nil, fmt.Errorf("invalid weight of identity %q, it has to be a positive integer", item)
+		}
+
+		out = append(out, apfIdentity{name: kv[0], weight: w})
+	}
+
+	return out, nil
+}
+
+// identityFor splits the runners by the identity weights, in order, e.g.
+// with hub=20,agent=80 the first 20% of the runners are hub.
+func identityFor(ids []apfIdentity, idx, total int) string {
+	if len(ids) == 0 || total <= 0 {
+		return ""
+	}
+
+	weights := make([]int, len(ids))
+	for i, id := range ids {
+		weights[i] = id.weight
+	}
+
+	return ids[weightedIndex(weights, idx, total)].name
+}
+
+// weightedIndex returns which of the weights runner idx falls in, the
+// runners are split in order, proportionally to the weights.
+func weightedIndex(weights []int, idx, total int) int {
+	sum := 0
+	for _, w := range weights {
+		sum += w
+	}
+
+	acc := 0
+	for i, w := range weights {
+		acc += w
+		if idx*sum < acc*total {
+			return i
+		}
+	}
+
+	return len(weights) - 1
+}
+
+func impersonationFor(identity string, groups []string) restclient.ImpersonationConfig {
+	return restclient.ImpersonationConfig{
+		UserName: apfUserPrefix + identity,
+		Groups:   groups,
+	}
+}
+
+// logClassification sends a request as each identity and logs the FlowSchema
+// and the priority level the apiserver classified it into, to check the APF
+// configuration before trusting the per identity metrics.
+func logClassification(ctx context.Context, config *restclient.Config, ids []apfIdentity, groups []string, logger logr.Logger) error {
+	cl, err := client.New(config, client.Options{})
+	if err != nil {
+		return fmt.Errorf("failed to create client, error: %w", err)
+	}
+
+	names, err := apfNames(ctx, cl)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		cfg := restclient.CopyConfig(config)
+		cfg.Impersonate = impersonationFor(id.name, groups)
+
+		rt, err := restclient.TransportFor(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to create transport, error: %w", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(cfg.Host, "/")+"/api", nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			return fmt.Errorf("failed to send request as %s, error: %w", id.name, err)
+		}
+
+		resp.Body.Close()
+
+		logger.Info(fmt.Sprintf("identity %s (user %s) is classified into flowschema %s, priority level %s", id.name, cfg.Impersonate.UserName,
+			names[resp.Header.Get(flowSchemaUIDHeader)], names[resp.Header.Get(priorityLevelUIDHeader)]))
+	}
+
+	return nil
+}
+
+// apfNames maps the UIDs of the FlowSchemas and the priority levels, which
+// the responses carry, to their names.
+func apfNames(ctx context.Context, cl client.Client) (map[string]string, error) {
+	names := map[string]string{}
+
+	schemas := &flowcontrolv1beta1.FlowSchemaList{}
+	if err := cl.List(ctx, schemas); err != nil {
+		return nil, fmt.Errorf("failed to list FlowSchemas, error: %w", err)
+	}
+
+	for _, fs := range schemas.Items {
+		names[string(fs.UID)] = fs.Name
+	}
+
+	levels := &flowcontrolv1beta1.PriorityLevelConfigurationList{}
+	if err := cl.List(ctx, levels); err != nil {
+		return nil, fmt.Errorf("failed to list PriorityLevelConfigurations, error: %w", err)
+	}
+
+	for _, pl := range levels.Items {
+		names[string(pl.UID)] = pl.Name
+	}
+
+	return names, nil
+}
+
+// apfAttribution records the requests on the wire by the priority level and
+// the FlowSchema APF classified them into, from the headers of the responses,
+// as "<priority level>/<flowschema>/<verb>". The requests APF rejected are
+// recorded as errors, so the error rate of a priority level is its share of
+// 429.
+type apfAttribution struct {
+	metrics *Metrics
+	// names are the names of the UIDs of the headers, the UIDs are recorded
+	// when they're unknown
+	names map[string]string
+}
+
+// resolveAPFNames is apfNames for the attribution, which reports the UIDs
+// when the names can't be listed.
+func resolveAPFNames(ctx context.Context, config *restclient.Config, logger logr.Logger) map[string]string {
+	cl, err := client.New(config, client.Options{})
+	if err != nil {
+		logger.Error(err, "failed to create client, the priority levels and the FlowSchemas are reported by UID")
+		return map[string]string{}
+	}
+
+	names, err := apfNames(ctx, cl)
+	if err != nil {
+		logger.Error(err, "the priority levels and the FlowSchemas are reported by UID")
+		return map[string]string{}
+	}
+
+	return names
+}
+
+func (a *apfAttribution) name(uid string) string {
+	if uid == "" {
+		return "unclassified"
+	}
+
+	if name, ok := a.names[uid]; ok {
+		return name
+	}
+
+	return uid
+}
+
+type apfRoundTripper struct {
+	attribution *apfAttribution
+	next        http.RoundTripper
+}
+
+func (rt *apfRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	verb, _ := requestVerb(req)
+
+	start := time.Now()
+	resp, err := rt.next.RoundTrip(req)
+
+	// a watch lasts as long as its stream, and failed requests have no
+	// classification
+	if verb == "watch" || err != nil {
+		return resp, err
+	}
+
+	a := rt.attribution
+	op := a.name(resp.Header.Get(priorityLevelUIDHeader)) + "/" + a.name(resp.Header.Get(flowSchemaUIDHeader)) + "/" + verb
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		a.metrics.Observe(op, time.Since(start), errThrottled)
+	} else {
+		a.metrics.Observe(op, time.Since(start), nil)
+	}
+
+	return resp, err
+}
+
+func wrapAPFAttribution(a *apfAttribution) func(http.RoundTripper) http.RoundTripper {
+	return func(next http.RoundTripper) http.RoundTripper {
+		if a == nil {
+			return next
+		}
+
+		return &apfRoundTripper{attribution: a, next: next}
+	}
+}
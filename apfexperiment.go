@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/go-logr/logr"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// the load of an experiment impersonates the load-simulator-apf-experiment
+	// user in this group, which the temporary FlowSchema matches
+	experimentIdentity = "apf-experiment"
+	experimentGroup    = "load-simulator:apf-experiment"
+	experimentName     = "load-simulator-apf-experiment"
+)
+
+// apfExperimentCommand runs the same load once for each priority level
+// configuration of -shares: it installs a temporary FlowSchema matching the
+// load and its priority level, runs the load, given after "--", and removes
+// them again, then compares the requests of the runs.
+func apfExperimentCommand(args []string, logger logr.Logger) error {
+	fs := flag.NewFlagSet("apf-experiment", flag.ContinueOnError)
+
+	kubeconfig := fs.String("kubeconfig", os.Getenv("KUBECONFIG"), "absolute path to the kubeconfig file, its user needs to manage the flowcontrol objects and to impersonate")
+	shares := fs.String("shares", "5,20", "comma separated assured concurrency shares of the priority level, the load runs once with each of them")
+	queues := fs.Int("queues", 16, "number of queues of the priority level, 0 rejects the requests over the concurrency limit instead of queuing them")
+	handSize := fs.Int("hand-size", 4, "hand size of the shuffle sharding of the priority level")
+	queueLength := fs.Int("queue-length", 50, "length limit of each queue of the priority level")
+	precedence := fs.Int("precedence", 1000, "matching precedence of the FlowSchema, under the one of any other FlowSchema the load may match")
+	reportDir := fs.String("report-dir", "", "directory of the reports of the runs, shares-<shares>.json, defaults to a temporary directory")
+	newGuard := guardFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	guard, err := newGuard()
+	if err != nil {
+		return err
+	}
+
+	variants := []int32{}
+	for _, item := range strings.Split(*shares, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(item)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid shares %q, expecting positive integers", item)
+		}
+
+		variants = append(variants, int32(n))
+	}
+
+	if len(variants) == 0 {
+		return fmt.Errorf("shares has no value")
+	}
+
+	if *queues < 0 || *handSize < 1 || *queueLength < 1 || *precedence < 1 || *precedence > 10000 {
+		return fmt.Errorf("queues can't be negative, hand-size and queue-length have to be at least 1 and precedence between 1 and 10000")
+	}
+
+	runArgs := fs.Args()
+	for _, name := range []string{"apf-identities", "low-priority", "report"} {
+		if hasFlag(runArgs, name) {
+			return fmt.Errorf("the load of the experiment can't set %s, the experiment does", name)
+		}
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to load rest.Config, error: %w", err)
+	}
+
+	if err := guard.check(*kubeconfig, config.Host); err != nil {
+		return err
+	}
+
+	cl, err := client.New(config, client.Options{})
+	if err != nil {
+		return fmt.Errorf("failed to create client, error: %w", err)
+	}
+
+	if *reportDir == "" {
+		if *reportDir, err = ioutil.TempDir("", "load-simulator-apf-experiment-"); err != nil {
+			return fmt.Errorf("failed to create the report directory, error: %w", err)
+		}
+	}
+
+	bin, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the load-simulator binary, error: %w", err)
+	}
+
+	// the runs get the signal as well, the experiment only stops after
+	// removing the APF objects
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+
+	reports := map[int32]*Report{}
+
+	for _, s := range variants {
+		a := apfObjects{
+			name:        experimentName,
+			group:       experimentGroup,
+			shares:      s,
+			precedence:  int32(*precedence),
+			queues:      int32(*queues),
+			handSize:    int32(*handSize),
+			queueLength: int32(*queueLength),
+		}
+
+		path := filepath.Join(*reportDir, fmt.Sprintf("shares-%v.json", s))
+
+		report, err := a.experiment(cl, bin, append([]string{"-kubeconfig", *kubeconfig}, runArgs...), path, logger)
+		if err != nil {
+			return err
+		}
+
+		reports[s] = report
+
+		select {
+		case <-c:
+			logger.Info("interrupted, skipping the next runs")
+			printExperiment(logger, variants, reports)
+
+			return nil
+		default:
+		}
+	}
+
+	printExperiment(logger, variants, reports)
+
+	logger.Info(fmt.Sprintf("the reports of the runs are in %s", *reportDir))
+
+	return nil
+}
+
+// experiment installs a, runs the load as its identity, then uninstalls a
+// whatever the outcome of the run, and returns its report.
+func (a apfObjects) experiment(cl client.Client, bin string, runArgs []string, reportPath string, logger logr.Logger) (*Report, error) {
+	if err := a.install(context.TODO(), cl); err != nil {
+		return nil, err
+	}
+
+	logger.Info(fmt.Sprintf("installed FlowSchema %s with %v shares, running the load", a.name, a.shares))
+
+	args := append(append([]string{}, runArgs...), "-apf-identities", experimentIdentity+"=1", "-apf-groups", experimentGroup, "-report", reportPath)
+
+	cmd := exec.Command(bin, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	runErr := cmd.Run()
+
+	if err := a.uninstall(context.TODO(), cl); err != nil {
+		return nil, err
+	}
+
+	logger.Info(fmt.Sprintf("uninstalled FlowSchema %s", a.name))
+
+	if runErr != nil {
+		return nil, fmt.Errorf("the load with %v shares failed, error: %w", a.shares, runErr)
+	}
+
+	dat, err := ioutil.ReadFile(reportPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the report of the load with %v shares, error: %w", a.shares, err)
+	}
+
+	report := &Report{}
+	if err := json.Unmarshal(dat, report); err != nil {
+		return nil, fmt.Errorf("failed to parse %s, error: %w", reportPath, err)
+	}
+
+	return report, nil
+}
+
+// printExperiment compares the requests on the wire of the runs, the
+// requests APF rejected count as errors.
+func printExperiment(logger logr.Logger, variants []int32, reports map[int32]*Report) {
+	b := &strings.Builder{}
+
+	tw := tabwriter.NewWriter(b, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "SHARES\tOP\tCOUNT\tERRORS\tP50\tP99\n")
+
+	for _, s := range variants {
+		report, ok := reports[s]
+		if !ok {
+			continue
+		}
+
+		for _, run := range report.Runs {
+			for _, sum := range run.Requests {
+				fmt.Fprintf(tw, "%v\t%s\t%v\t%v\t%v\t%v\n", s, sum.Op, sum.Count, sum.Errors, sum.P50, sum.P99)
+			}
+		}
+	}
+
+	tw.Flush()
+
+	logger.Info("requests of the experiment by shares of the priority level:\n" + b.String())
+}
+
+// hasFlag tells whether args set the flag name, as -name, --name or
+// -name=value.
+func hasFlag(args []string, name string) bool {
+	for _, a := range args {
+		a = strings.TrimLeft(a, "-")
+		if a == name || strings.HasPrefix(a, name+"=") {
+			return true
+		}
+	}
+
+	return false
+}
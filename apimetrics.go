@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+// sample is a single line of the prometheus text format exposed by the
+// apiserver /metrics endpoint.
+type sample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// scrapeAPIServer fetches the apiserver /metrics and returns the samples of
+// the metrics with the given names.
+func scrapeAPIServer(ctx context.Context, config *restclient.Config, names ...string) ([]sample, error) {
+	cs, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset, error: %w", err)
+	}
+
+	dat, err := cs.Discovery().RESTClient().Get().AbsPath("/metrics").DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get apiserver metrics, error: %w", err)
+	}
+
+	want := map[string]bool{}
+	for _, n := range names {
+		want[n] = true
+	}
+
+	out := []sample{}
+	for _, s := range parseSamples(dat) {
+		if want[s.name] {
+			out = append(out, s)
+		}
+	}
+
+	return out, nil
+}
+
+// parseSamples is a minimal parser of the prometheus text format, it skips
+// comments and anything it doesn't understand.
+func parseSamples(dat []byte) []sample {
+	out := []sample{}
+
+	sc := bufio.NewScanner(bytes.NewReader(dat))
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		s := sample{labels: map[string]string{}}
+
+		rest := line
+		if i := strings.IndexByte(line, '{'); i >= 0 {
+			j := strings.LastIndexByte(line, '}')
+			if j < i {
+				continue
+			}
+
+			s.name = line[:i]
+			s.labels = parseLabels(line[i+1 : j])
+			rest = strings.TrimSpace(line[j+1:])
+		} else {
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				continue
+			}
+
+			s.name = fields[0]
+			rest = strings.Join(fields[1:], " ")
+		}
+
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+
+		s.value = v
+		out = append(out, s)
+	}
+
+	return out
+}
+
+func parseLabels(s string) map[string]string {
+	out := map[string]string{}
+
+	for len(s) > 0 {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 || eq+1 >= len(s) || s[eq+1] != '"' {
+			return out
+		}
+
+		key := strings.TrimSpace(s[:eq])
+
+		// find the closing quote, skipping the escaped ones
+		val := strings.Builder{}
+		i := eq + 2
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+			}
+			val.WriteByte(s[i])
+		}
+
+		out[key] = val.String()
+
+		if i < len(s) {
+			i++
+		}
+
+		s = strings.TrimLeft(s[i:], ", ")
+	}
+
+	return out
+}
+
+// sumSamples adds up the samples matching all the given labels.
+func sumSamples(samples []sample, name string, labels map[string]string) float64 {
+	total := 0.0
+
+	for _, s := range samples {
+		if s.name != name {
+			continue
+		}
+
+		matched := true
+		for k, v := range labels {
+			if s.labels[k] != v {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			total += s.value
+		}
+	}
+
+	return total
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// bandwidth counts the bytes of the request and response bodies by verb, as
+// they go over the wire, so compressed responses count compressed.
+type bandwidth struct {
+	mu    sync.Mutex
+	verbs map[string]*verbBytes
+	// samples is the throughput over time, see sample
+	samples []ThroughputSample
+}
+
+type verbBytes struct {
+	requests int64
+	sent     int64
+	received int64
+}
+
+// BandwidthSummary is the bytes of the request and response bodies of a verb.
+type BandwidthSummary struct {
+	Verb          string `json:"verb"`
+	Requests      int64  `json:"requests"`
+	SentBytes     int64  `json:"sentBytes"`
+	ReceivedBytes int64  `json:"receivedBytes"`
+}
+
+// ThroughputSample is the throughput of all the verbs over an interval.
+type ThroughputSample struct {
+	Time                   time.Time `json:"time"`
+	SentBytesPerSecond     float64   `json:"sentBytesPerSecond"`
+	ReceivedBytesPerSecond float64   `json:"receivedBytesPerSecond"`
+}
+
+func newBandwidth() *bandwidth {
+	return &bandwidth{verbs: map[string]*verbBytes{}}
+}
+
+func (b *bandwidth) verb(verb string) *verbBytes {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	v := b.verbs[verb]
+	if v == nil {
+		v = &verbBytes{}
+		b.verbs[verb] = v
+	}
+
+	return v
+}
+
+func (b *bandwidth) Summary() []BandwidthSummary {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	out := []BandwidthSummary{}
+	for verb, v := range b.verbs {
+		out = append(out, BandwidthSummary{
+			Verb:          verb,
+			Requests:      atomic.LoadInt64(&v.requests),
+			SentBytes:     atomic.LoadInt64(&v.sent),
+			ReceivedBytes: atomic.LoadInt64(&v.received),
+		})
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Verb < out[j].Verb })
+
+	return out
+}
+
+func (b *bandwidth) Report(logger logr.Logger) {
+	for _, s := range b.Summary() {
+		logger.Info(fmt.Sprintf("%s: %v requests, sent %v bytes, received %v bytes", s.Verb, s.Requests, s.SentBytes, s.ReceivedBytes))
+	}
+
+	samples := b.Throughput()
+	if len(samples) == 0 {
+		return
+	}
+
+	peak := samples[0]
+	for _, s := range samples {
+		if s.SentBytesPerSecond+s.ReceivedBytesPerSecond > peak.SentBytesPerSecond+peak.ReceivedBytesPerSecond {
+			peak = s
+		}
+	}
+
+	logger.Info(fmt.Sprintf("peak throughput at %s: sent %.0f bytes/s, received %.0f bytes/s", peak.Time.Format(time.RFC3339), peak.SentBytesPerSecond, peak.ReceivedBytesPerSecond))
+}
+
+func (b *bandwidth) totals() (int64, int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sent, received := int64(0), int64(0)
+	for _, v := range b.verbs {
+		sent += atomic.LoadInt64(&v.sent)
+		received += atomic.LoadInt64(&v.received)
+	}
+
+	return sent, received
+}
+
+// sample records the throughput of all the verbs every interval until stop,
+// to size the network of the hub and the konnectivity tunnels for the peaks
+// rather than the average.
+func (b *bandwidth) sample(interval time.Duration, stop <-chan struct{}, wg *sync.WaitGroup) {
+	last := time.Now()
+	lastSent, lastReceived := b.totals()
+
+	record := func() {
+		now := time.Now()
+		sent, received := b.totals()
+
+		secs := now.Sub(last).Seconds()
+		if secs <= 0 {
+			return
+		}
+
+		b.mu.Lock()
+		b.samples = append(b.samples, ThroughputSample{
+			Time:                   now,
+			SentBytesPerSecond:     float64(sent-lastSent) / secs,
+			ReceivedBytesPerSecond: float64(received-lastReceived) / secs,
+		})
+		b.mu.Unlock()
+
+		last, lastSent, lastReceived = now, sent, received
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				record()
+				return
+			case <-ticker.C:
+				record()
+			}
+		}
+	}()
+}
+
+func (b *bandwidth) Throughput() []ThroughputSample {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]ThroughputSample{}, b.samples...)
+}
+
+// bandwidthRoundTripper counts the bytes of each request by verb. It asks for
+// gzip itself, when compression is on, since the transport would hide the
+// compressed size otherwise.
+type bandwidthRoundTripper struct {
+	bandwidth   *bandwidth
+	compression bool
+	next        http.RoundTripper
+}
+
+func (rt *bandwidthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	verb, _ := requestVerb(req)
+	v := rt.bandwidth.verb(verb)
+
+	atomic.AddInt64(&v.requests, 1)
+	if req.ContentLength > 0 {
+		atomic.AddInt64(&v.sent, req.ContentLength)
+	}
+
+	if rt.compression && req.Header.Get("Accept-Encoding") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+
+	resp, err := rt.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	body := &countingBody{ReadCloser: resp.Body, count: &v.received}
+	resp.Body = body
+
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		resp.Body = &gzipBody{raw: body}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+
+	return resp, nil
+}
+
+// countingBody counts the bytes read from the wire.
+type countingBody struct {
+	io.ReadCloser
+	count *int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	atomic.AddInt64(b.count, int64(n))
+
+	return n, err
+}
+
+// gzipBody decompresses the response, on the first read so an empty body
+// doesn't fail.
+type gzipBody struct {
+	raw io.ReadCloser
+	zr  *gzip.Reader
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	if b.zr == nil {
+		zr, err := gzip.NewReader(b.raw)
+		if err != nil {
+			return 0, err
+		}
+
+		b.zr = zr
+	}
+
+	return b.zr.Read(p)
+}
+
+func (b *gzipBody) Close() error {
+	return b.raw.Close()
+}
+
+func wrapBandwidth(b *bandwidth, compression bool) func(http.RoundTripper) http.RoundTripper {
+	return func(next http.RoundTripper) http.RoundTripper {
+		if b == nil {
+			return next
+		}
+
+		return &bandwidthRoundTripper{bandwidth: b, compression: compression, next: next}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// batchMembers are the other objects of a runner with a batch size, each
+// tick drives all of them concurrently on the runner's connection, so that
+// the throughput of a runner doesn't need thousands of runners. They live in
+// the runner's namespace, named <object>-b<i>.
+func (r *Runner) batchMembers() []*Runner {
+	if r.batchSize <= 1 || r.template.GetName() == "" {
+		return nil
+	}
+
+	out := []*Runner{}
+	for i := 1; i < r.batchSize; i++ {
+		m := *r
+		m.batch = nil
+		m.batchMember = true
+
+		m.template = templateMeta(r.template)
+		m.template.SetName(fmt.Sprintf("%s-b%v", r.template.GetName(), i))
+		m.baseName = m.template.GetName()
+
+		out = append(out, &m)
+	}
+
+	return out
+}
+
+// shareClient hands the runner's client over to its batch members.
+func (r *Runner) shareClient() {
+	for _, m := range r.batch {
+		m.Client = r.Client
+		m.config = r.config
+		m.transport = r.transport
+	}
+}
+
+// forBatch runs f for the runner and its batch members concurrently.
+func (r *Runner) forBatch(f func(m *Runner)) {
+	if len(r.batch) == 0 {
+		f(r)
+		return
+	}
+
+	all := append([]*Runner{r}, r.batch...)
+	parallel(len(all), len(all), func(i int) {
+		f(all[i])
+	})
+}
+
+// batchTick is a tick of an object of a runner with batch workers.
+type batchTick struct {
+	m   *Runner
+	seq int
+}
+
+// startBatchWorkers starts the r.batchWorkers goroutines driving the objects
+// of the batch, so a slow object doesn't hold the others back until the next
+// tick, see dispatchBatch.
+func (r *Runner) startBatchWorkers() {
+	if r.batchWorkers <= 0 || len(r.batch) == 0 {
+		return
+	}
+
+	// an object is queued once at most, the queue never blocks the ticker
+	r.batchQueue = make(chan batchTick, len(r.batch)+1)
+	r.batchWorkersDone = &sync.WaitGroup{}
+
+	for w := 0; w < r.batchWorkers; w++ {
+		r.batchWorkersDone.Add(1)
+		go func() {
+			defer r.batchWorkersDone.Done()
+
+			for t := range r.batchQueue {
+				// the queued ticks of a killed runner are dropped
+				if r.ctx.Err() != nil {
+					atomic.StoreInt32(&t.m.ticking, 0)
+					continue
+				}
+
+				// only the template objects have a TTL
+				if r.workload.setup == nil && t.m.expired() {
+					t.m.recreate()
+				}
+
+				r.workload.tick(t.m, t.seq)
+				atomic.StoreInt32(&t.m.ticking, 0)
+
+				r.beat()
+			}
+		}()
+	}
+}
+
+// dispatchBatch queues the tick of each object of the batch which is done
+// with its previous one, the others skip the tick.
+func (r *Runner) dispatchBatch(seq int) {
+	for _, m := range append([]*Runner{r}, r.batch...) {
+		if !atomic.CompareAndSwapInt32(&m.ticking, 0, 1) {
+			r.skippedTicks += 1
+			continue
+		}
+
+		r.batchQueue <- batchTick{m: m, seq: seq}
+	}
+}
+
+// stopBatchWorkers stops the workers, waiting for the ticks in flight unless
+// the runner was killed, which cancels them.
+func (r *Runner) stopBatchWorkers(wait bool) {
+	if r.batchQueue == nil {
+		return
+	}
+
+	close(r.batchQueue)
+
+	if !wait {
+		r.batchCancel()
+		return
+	}
+
+	r.batchWorkersDone.Wait()
+
+	if r.skippedTicks != 0 {
+		r.logger.Info(fmt.Sprintf("%v ticks of the objects of %s were skipped, the objects were busy with their previous tick", r.skippedTicks, r.name))
+	}
+}
+
+// createBatch creates the objects of the batch members, once the runner
+// created its own along with the namespace.
+func (r *Runner) createBatch() {
+	parallel(len(r.batch), len(r.batch), func(i int) {
+		m := r.batch[i]
+
+		if err := m.create(); err != nil && !errors.Is(err, errLimitReached) {
+			m.logger.Error(err, fmt.Sprintf("failed to create batch object %s", m.getKey()))
+			return
+		}
+
+		m.createdAt = r.createdAt
+	})
+}
+
+// deleteBatch deletes the objects of the batch members with the runner's
+// client, before the runner deletes its own along with the namespace.
+func (r *Runner) deleteBatch() {
+	ctx := r.context()
+
+	parallel(len(r.batch), len(r.batch), func(i int) {
+		m := r.batch[i]
+
+		start := time.Now()
+		if err := r.Client.Delete(ctx, m.template.DeepCopy()); err != nil {
+			if !k8serrors.IsNotFound(err) {
+				r.logger.Error(err, fmt.Sprintf("failed to delete batch object %s", m.getKey()))
+				return
+			}
+
+			if !m.swallowed("delete", m.getKey().String(), err, time.Since(start), r.onNotFound) {
+				return
+			}
+		}
+
+		r.state.remove(m.template)
+	})
+}
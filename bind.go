@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	bindObjectPrefix = "load-simulator-bind"
+
+	// bindSchedulerName keeps the real scheduler, if any, off the pods
+	bindSchedulerName = "load-simulator"
+)
+
+func parseBindNodes(s string) ([]string, error) {
+	out := []string{}
+	for _, n := range strings.Split(s, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			out = append(out, n)
+		}
+	}
+
+	if len(out) == 0 {
+		return nil, fmt.Errorf("bind-nodes has no node")
+	}
+
+	return out, nil
+}
+
+// bindSetup only creates the namespace, the pods are created by the ticks.
+func (r *Runner) bindSetup() error {
+	if err := r.createNamespace(r.context(), r.template.GetNamespace()); err != nil {
+		return err
+	}
+
+	_, err := r.typedClient()
+
+	return err
+}
+
+// bindTick acts as a scheduler: it creates a pending pod, binds it to one of
+// r.bindNodes in rotation with the Binding subresource, then deletes it right
+// away, since no kubelet will ever run it. This loads the write path of the
+// scheduling without a scheduler or nodes, the nodes don't even have to
+// exist.
+func (r *Runner) bindTick(seq int) {
+	ctx := r.context()
+	pod := r.bindPod(seq)
+
+	cs, err := r.typedClient()
+	if err != nil {
+		r.logger.Error(err, "failed to bind")
+		return
+	}
+
+	if err := r.createObject(ctx, "bind/create", pod, r.onAlreadyExists); err != nil {
+		r.logger.Error(err, fmt.Sprintf("failed to create pod %s", pod.Name))
+		return
+	}
+
+	binding := &corev1.Binding{
+		ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+		Target:     corev1.ObjectReference{Kind: "Node", Name: r.bindNodes[seq%len(r.bindNodes)]},
+	}
+
+	if err := r.metrics.Time("bind/bind", func() error {
+		return cs.CoreV1().Pods(pod.Namespace).Bind(ctx, binding, metav1.CreateOptions{})
+	}); err != nil {
+		r.logger.Error(err, fmt.Sprintf("failed to bind pod %s", pod.Name))
+	}
+
+	// a bound pod waits for its kubelet to terminate it otherwise
+	if err := r.metrics.Time("bind/delete", func() error {
+		return r.Client.Delete(ctx, pod, client.GracePeriodSeconds(0))
+	}); err != nil && !k8serrors.IsNotFound(err) {
+		r.logger.Error(err, fmt.Sprintf("failed to delete pod %s", pod.Name))
+	}
+}
+
+func (r *Runner) bindPod(seq int) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%v-%v", bindObjectPrefix, r.index, seq),
+			Namespace: r.template.GetNamespace(),
+			Labels:    r.labels(map[string]string{"app": bindObjectPrefix}),
+		},
+		Spec: corev1.PodSpec{
+			SchedulerName: bindSchedulerName,
+			Containers: []corev1.Container{
+				{Name: "pause", Image: "k8s.gcr.io/pause:3.5"},
+			},
+		},
+	}
+}
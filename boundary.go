@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// errEtcdTooLarge is the message of the etcd rejection of a request over its
+// --max-request-bytes, which the apiserver relays as an internal error.
+const errEtcdTooLarge = "request is too large"
+
+// boundary is an object size the apiserver or etcd is expected to enforce,
+// e.g. 1Mi for the ConfigMaps and Secrets, 1.5Mi for an etcd request.
+type boundary struct {
+	name  string
+	bytes int
+}
+
+// parseBoundaries parses comma separated quantities, e.g. "1Mi,1.5Mi".
+func parseBoundaries(s string) ([]boundary, error) {
+	out := []boundary{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		q, err := resource.ParseQuantity(item)
+		if err != nil || q.Value() <= 0 {
+			return nil, fmt.Errorf("invalid size boundary %q, expecting a positive quantity, e.g. 1.5Mi", item)
+		}
+
+		out = append(out, boundary{name: item, bytes: int(q.Value())})
+	}
+
+	if len(out) == 0 {
+		return nil, fmt.Errorf("boundary-sizes has no size")
+	}
+
+	return out, nil
+}
+
+// boundaryTick creates a copy of the template padded to just under or just
+// over one of r.boundaries, rotating through them, and records whether the
+// apiserver took it and how long it took to answer as
+// "boundary/<size>-<under|over>-<accepted|rejected>". An accepted object is
+// deleted right away.
+func (r *Runner) boundaryTick(seq int) {
+	b := r.boundaries[(seq/2)%len(r.boundaries)]
+
+	side, size := "under", b.bytes-r.boundaryMargin
+	if seq%2 == 1 {
+		side, size = "over", b.bytes+r.boundaryMargin
+	}
+
+	obj, err := r.paddedObject(fmt.Sprintf("%s-boundary-%v", r.template.GetName(), seq), size)
+	if err != nil {
+		r.logger.Error(err, fmt.Sprintf("failed to pad the object to %v bytes", size))
+		return
+	}
+
+	op := fmt.Sprintf("boundary/%s-%s", b.name, side)
+	ctx := r.context()
+
+	start := time.Now()
+	err = r.Client.Create(ctx, obj)
+	d := time.Since(start)
+
+	if err != nil && !sizeRejected(err) {
+		r.metrics.Observe(op, d, err)
+		r.logger.Error(err, fmt.Sprintf("failed to create %s", obj.GetName()))
+
+		return
+	}
+
+	if err != nil {
+		r.metrics.Observe(op+"-rejected", d, nil)
+
+		if side == "under" {
+			r.logger.Info(fmt.Sprintf("the %v bytes %s was rejected under the %s boundary: %v", size, obj.GetName(), b.name, err))
+		}
+
+		return
+	}
+
+	r.metrics.Observe(op+"-accepted", d, nil)
+
+	// a schema pruning the padding makes the object fit whatever its size
+	if _, found, _ := unstructured.NestedString(obj.Object, r.boundaryField...); !found {
+		r.logger.Info(fmt.Sprintf("the padding %s of %s was pruned, the field has to be kept by the schema of the kind", strings.Join(r.boundaryField, "."), obj.GetName()))
+	}
+
+	if err := r.Client.Delete(ctx, obj); err != nil {
+		r.logger.Error(err, fmt.Sprintf("failed to delete %s", obj.GetName()))
+	}
+}
+
+// sizeRejected tells whether err rejects the size of the object, the
+// request body limit of the apiserver, the validation of its size, or the
+// request limit of etcd.
+func sizeRejected(err error) bool {
+	return k8serrors.IsRequestEntityTooLargeError(err) || k8serrors.IsInvalid(err) || strings.Contains(err.Error(), errEtcdTooLarge)
+}
+
+// paddedObject is a copy of the template named name, whose JSON encoding is
+// size bytes long thanks to a string of padding at r.boundaryField.
+func (r *Runner) paddedObject(name string, size int) (*unstructured.Unstructured, error) {
+	obj := r.object()
+	obj.SetName(name)
+
+	if err := unstructured.SetNestedField(obj.Object, "", r.boundaryField...); err != nil {
+		return nil, err
+	}
+
+	dat, err := json.Marshal(obj.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(dat) > size {
+		return nil, fmt.Errorf("the template is already %v bytes", len(dat))
+	}
+
+	// the padding is only made of characters JSON doesn't escape
+	if err := unstructured.SetNestedField(obj.Object, strings.Repeat("x", size-len(dat)), r.boundaryField...); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
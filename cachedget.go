@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	restclient "k8s.io/client-go/rest"
+)
+
+// cachedReadsDefault is the percentage of the clients reading from the watch
+// cache in the cached-get mode.
+const cachedReadsDefault = 50
+
+// readerClient returns the runner's dynamic client for the reads which need
+// options the client doesn't take, it's limited like the other reads.
+func (r *Runner) readerClient() (dynamic.Interface, error) {
+	if r.reader != nil {
+		return r.reader, nil
+	}
+
+	config := restclient.CopyConfig(r.config)
+	config.QPS = r.readQPS
+	config.Burst = r.readBurst
+
+	dc, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client, error: %w", err)
+	}
+
+	r.reader = dc
+
+	return dc, nil
+}
+
+// cachedGetTick gets the runner's object and lists the objects of its kind in
+// its namespace. A client reading cached sets resourceVersion=0, so the
+// apiserver serves both from the watch cache, the way informers and well
+// behaved clients do. The other clients read without a resourceVersion, which
+// is a quorum read from etcd for every request.
+func (r *Runner) cachedGetTick(seq int) {
+	dc, err := r.readerClient()
+	if err != nil {
+		r.logger.Error(err, "failed to read")
+		return
+	}
+
+	gvk := r.template.GroupVersionKind()
+
+	mapping, err := r.Client.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		r.logger.Error(err, fmt.Sprintf("failed to map %s", gvk.String()))
+		return
+	}
+
+	ri := dc.Resource(mapping.Resource).Namespace(r.template.GetNamespace())
+
+	suffix, rv := "uncached", ""
+	if r.cachedReads {
+		suffix, rv = "cached", "0"
+	}
+
+	ctx := r.context()
+
+	if err := r.metrics.Time("get/"+suffix, func() error {
+		_, err := ri.Get(ctx, r.template.GetName(), metav1.GetOptions{ResourceVersion: rv})
+		return err
+	}); err != nil {
+		r.logger.Error(err, fmt.Sprintf("failed to get %s", r.getKey()))
+	}
+
+	if err := r.metrics.Time("list/"+suffix, func() error {
+		_, err := ri.List(ctx, metav1.ListOptions{ResourceVersion: rv})
+		return err
+	}); err != nil {
+		r.logger.Error(err, fmt.Sprintf("failed to list %s", mapping.Resource.Resource))
+	}
+}
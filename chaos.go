@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// chaos kills a share of the runners every interval, dropping their
+// connections without any clean up, and respawns them after a delay, the way
+// crash looping agents behave.
+type chaos struct {
+	interval     time.Duration
+	percent      float64
+	respawnDelay time.Duration
+}
+
+func (c chaos) enabled() bool {
+	return c.interval > 0 && c.percent > 0
+}
+
+// run kills runners of the pool, and respawns them after the delay.
+func (c chaos) run(p *pool, logger logr.Logger, stop <-chan struct{}, wg *sync.WaitGroup) {
+	mu := sync.Mutex{}
+	killed := map[int]bool{}
+
+	respawn := func(idx int) {
+		defer wg.Done()
+
+		select {
+		case <-time.After(c.respawnDelay):
+			mu.Lock()
+			defer mu.Unlock()
+
+			select {
+			case <-stop:
+				// the run is over, only clean up what the killed runner left
+				p.start(idx, WithCleanOption(true))
+				return
+			default:
+			}
+
+			p.start(idx)
+			delete(killed, idx)
+
+			logger.Info(fmt.Sprintf("chaos respawned runner %v", idx))
+
+		case <-stop:
+			p.start(idx, WithCleanOption(true))
+		}
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				mu.Lock()
+
+				size := p.len()
+				n := int(float64(size) * c.percent / 100)
+				victims := []int{}
+				for _, idx := range rnd.Perm(size) {
+					if len(victims) == n {
+						break
+					}
+
+					if !killed[idx] {
+						victims = append(victims, idx)
+					}
+				}
+
+				for _, idx := range victims {
+					killed[idx] = true
+					p.kill(idx)
+
+					wg.Add(1)
+					go respawn(idx)
+				}
+
+				mu.Unlock()
+
+				logger.Info(fmt.Sprintf("chaos killed %v runners %v", len(victims), victims))
+			}
+		}
+	}()
+}
+
+// kill stops the runner without any clean up.
+func (r *Runner) kill() {
+	close(r.killCh)
+}
+
+// retire stops the runner, which cleans up what it created.
+func (r *Runner) retire() {
+	close(r.quitCh)
+}
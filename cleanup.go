@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	restclient "k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	cleanObjects    = "objects"
+	cleanNamespaces = "namespaces"
+	cleanAll        = "all"
+)
+
+func validateCleanScope(s string) error {
+	switch s {
+	case cleanObjects, cleanNamespaces, cleanAll:
+		return nil
+	}
+
+	return fmt.Errorf("unknown clean scope %q, expecting %s|%s|%s", s, cleanObjects, cleanNamespaces, cleanAll)
+}
+
+// runLabel is set to the run ID on everything the runners create, so the
+// clean up can be verified.
+const runLabel = "load-simulator/run"
+
+// cleanupPollInterval is the interval between the checks of the clean up.
+const cleanupPollInterval = 2 * time.Second
+
+var (
+	namespaceGVK = schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}
+	csrGVK       = schema.GroupVersionKind{Group: "certificates.k8s.io", Version: "v1", Kind: "CertificateSigningRequest"}
+
+	// clusterScopedKinds are the cluster scoped kinds the modes create,
+	// which the clean up checks whatever the mode
+	clusterScopedKinds = []schema.GroupVersionKind{csrGVK, crdGVK, managedClusterGVK}
+)
+
+// CleanupReport tells whether everything the run created is gone, and why
+// the leftovers are still there.
+type CleanupReport struct {
+	Verified bool          `json:"verified"`
+	Duration time.Duration `json:"duration"`
+	Leaks    []Leak        `json:"leaks,omitempty"`
+}
+
+type Leak struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Reason    string `json:"reason"`
+	// Hub is the hub of the object in a federated run
+	Hub string `json:"hub,omitempty"`
+}
+
+// verifyCleanup polls until no object of kinds matches selector, or until
+// timeout.
+func verifyCleanup(ctx context.Context, config *restclient.Config, selector labels.Selector, kinds []schema.GroupVersionKind, timeout time.Duration, logger logr.Logger) (*CleanupReport, error) {
+	cl, err := client.New(config, client.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client, error: %w", err)
+	}
+
+	start := time.Now()
+	deadline := start.Add(timeout)
+
+	for {
+		leaks, err := findLeaks(ctx, cl, selector, kinds)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(leaks) == 0 || time.Now().After(deadline) {
+			out := &CleanupReport{Verified: len(leaks) == 0, Duration: time.Since(start), Leaks: leaks}
+			out.log(logger)
+
+			return out, nil
+		}
+
+		time.Sleep(cleanupPollInterval)
+	}
+}
+
+func findLeaks(ctx context.Context, cl client.Client, selector labels.Selector, kinds []schema.GroupVersionKind) ([]Leak, error) {
+	out := []Leak{}
+
+	for _, gvk := range kinds {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk)
+
+		if err := cl.List(ctx, list, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			// e.g. the CRD of the template is gone already
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+
+			return nil, fmt.Errorf("failed to list %s, error: %w", gvk.Kind, err)
+		}
+
+		for _, item := range list.Items {
+			out = append(out, Leak{Kind: gvk.Kind, Namespace: item.GetNamespace(), Name: item.GetName(), Reason: leakReason(item)})
+		}
+	}
+
+	return out, nil
+}
+
+// leakReason tells what an object is waiting for, e.g. the finalizers of a
+// terminating namespace and its content still being removed.
+func leakReason(obj unstructured.Unstructured) string {
+	if obj.GetDeletionTimestamp() == nil {
+		return "not deleted"
+	}
+
+	reasons := []string{fmt.Sprintf("terminating since %s", obj.GetDeletionTimestamp().Format(time.RFC3339))}
+
+	finalizers := obj.GetFinalizers()
+	if spec, found, _ := unstructured.NestedStringSlice(obj.Object, "spec", "finalizers"); found {
+		finalizers = append(finalizers, spec...)
+	}
+
+	if len(finalizers) != 0 {
+		reasons = append(reasons, fmt.Sprintf("finalizers %s", strings.Join(finalizers, ",")))
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok || cond["status"] != "True" {
+			continue
+		}
+
+		if msg, ok := cond["message"].(string); ok && msg != "" {
+			reasons = append(reasons, msg)
+		}
+	}
+
+	return strings.Join(reasons, ", ")
+}
+
+func (c *CleanupReport) log(logger logr.Logger) {
+	if c.Verified {
+		logger.Info(fmt.Sprintf("clean up verified after %v", c.Duration))
+		return
+	}
+
+	logger.Info(fmt.Sprintf("%v objects left after %v", len(c.Leaks), c.Duration))
+
+	for _, l := range c.Leaks {
+		logger.Info(fmt.Sprintf("leaked %s %s/%s: %s", l.Kind, l.Namespace, l.Name, l.Reason))
+	}
+}
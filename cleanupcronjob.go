@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	cleanupCronJobInstall   = "install"
+	cleanupCronJobUninstall = "uninstall"
+)
+
+// cleanupScript deletes the objects of $RESOURCES labeled with the run label
+// and created more than $TTL_MINUTES ago. The timestamps are RFC 3339 in UTC,
+// which sort as strings.
+const cleanupScript = `cutoff=$(date -u -d "-${TTL_MINUTES} minutes" +%Y-%m-%dT%H:%M:%SZ)
+for resource in ${RESOURCES}; do
+  kubectl get "${resource}" --all-namespaces -l "${SELECTOR}" \
+    -o jsonpath='{range .items[*]}{.metadata.creationTimestamp} {.metadata.name} {.metadata.namespace}{"\n"}{end}' |
+  while read -r created name namespace; do
+    if [[ "${created}" < "${cutoff}" ]]; then
+      kubectl delete "${resource}" "${name}" ${namespace:+--namespace "${namespace}"} --wait=false --ignore-not-found
+    fi
+  done
+done
+`
+
+// cleanupCronJob deletes what the runs left behind from inside the cluster,
+// so the clean up happens even when the machine of the run dies.
+type cleanupCronJob struct {
+	name      string
+	namespace string
+	schedule  string
+	image     string
+	ttl       int
+	// resources are the kubectl resources, e.g.
+	// manifestworks.work.open-cluster-management.io, deleted in order, the
+	// namespaces last
+	resources []string
+}
+
+// rbac lets the ServiceAccount of the CronJob list and delete the resources.
+func (c cleanupCronJob) rbac() rbacObjects {
+	perms := []permission{}
+	for _, res := range c.resources {
+		p := permission{resource: res, verbs: []string{"list", "delete"}, cluster: true}
+		if i := strings.Index(res, "."); i != -1 {
+			p.resource, p.group = res[:i], res[i+1:]
+		}
+
+		perms = append(perms, p)
+	}
+
+	return rbacObjects{name: c.name, namespace: c.namespace, perms: mergePermissions(perms)}
+}
+
+func (c cleanupCronJob) cronJob() *batchv1.CronJob {
+	history := int32(1)
+
+	return &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      c.name,
+			Namespace: c.namespace,
+			Labels:    map[string]string{"app.kubernetes.io/managed-by": "load-simulator"},
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule:                   c.schedule,
+			ConcurrencyPolicy:          batchv1.ForbidConcurrent,
+			SuccessfulJobsHistoryLimit: &history,
+			FailedJobsHistoryLimit:     &history,
+			JobTemplate: batchv1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							ServiceAccountName: c.name,
+							RestartPolicy:      corev1.RestartPolicyNever,
+							Containers: []corev1.Container{
+								{
+									Name:    "cleanup",
+									Image:   c.image,
+									Command: []string{"/bin/bash", "-c", cleanupScript},
+									Env: []corev1.EnvVar{
+										{Name: "TTL_MINUTES", Value: strconv.Itoa(c.ttl)},
+										{Name: "RESOURCES", Value: strings.Join(c.resources, " ")},
+										{Name: "SELECTOR", Value: runLabel},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// cleanupCronJobCommand installs, or uninstalls, a CronJob deleting the
+// objects of the kinds of the run given after "--", of every run, once they
+// are older than -ttl.
+func cleanupCronJobCommand(args []string, logger logr.Logger) error {
+	if len(args) == 0 || (args[0] != cleanupCronJobInstall && args[0] != cleanupCronJobUninstall) {
+		return fmt.Errorf("expecting cleanup-cronjob %s|%s", cleanupCronJobInstall, cleanupCronJobUninstall)
+	}
+
+	fs := flag.NewFlagSet("cleanup-cronjob "+args[0], flag.ContinueOnError)
+
+	kubeconfig := fs.String("kubeconfig", os.Getenv("KUBECONFIG"), "absolute path to the kubeconfig file, its user needs to manage CronJobs and RBAC and to grant the list and delete permissions of the kinds of the run")
+	name := fs.String("name", "load-simulator-cleanup", "name of the CronJob, of its ServiceAccount and of its ClusterRole and binding")
+	namespace := fs.String("namespace", "default", "namespace of the CronJob")
+	ttl := fs.Int("ttl", 120, "minutes after which the objects of the runs are deleted, longer than the longest run")
+	schedule := fs.String("schedule", "*/10 * * * *", "schedule of the CronJob")
+	image := fs.String("image", "bitnami/kubectl:latest", "image of the CronJob, it needs bash, GNU date and kubectl")
+	newGuard := guardFlags(fs)
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	guard, err := newGuard()
+	if err != nil {
+		return err
+	}
+
+	if *ttl < 1 {
+		return fmt.Errorf("ttl has to be at least 1")
+	}
+
+	o, err := parseOptions("cleanup-cronjob", fs.Args())
+	if err != nil {
+		return err
+	}
+
+	// the CronJob is derived from the flags, there's no run to record
+	o.state = nil
+
+	if err := o.loadTemplates(); err != nil {
+		return err
+	}
+
+	c := cleanupCronJob{name: *name, namespace: *namespace, schedule: *schedule, image: *image, ttl: *ttl}
+	kinds := append(append(o.templateKinds(), clusterScopedKinds...), namespaceGVK)
+	for _, gvk := range kinds {
+		res := resourceOf(gvk)
+		if gvk.Group != "" {
+			res += "." + gvk.Group
+		}
+
+		c.resources = append(c.resources, res)
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to load rest.Config, error: %w", err)
+	}
+
+	if err := guard.check(*kubeconfig, config.Host); err != nil {
+		return err
+	}
+
+	cl, err := client.New(config, client.Options{})
+	if err != nil {
+		return fmt.Errorf("failed to create client, error: %w", err)
+	}
+
+	ctx := context.TODO()
+
+	if args[0] == cleanupCronJobUninstall {
+		if err := cl.Delete(ctx, c.cronJob()); err != nil && !k8serrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete CronJob %s, error: %w", c.name, err)
+		}
+
+		if err := c.rbac().uninstall(ctx, cl); err != nil {
+			return err
+		}
+
+		logger.Info(fmt.Sprintf("uninstalled CronJob %s/%s", c.namespace, c.name))
+
+		return nil
+	}
+
+	if err := c.rbac().install(ctx, cl); err != nil {
+		return err
+	}
+
+	job := c.cronJob()
+	if err := createOrUpdate(ctx, cl, job, &batchv1.CronJob{}, func(current client.Object) {
+		current.(*batchv1.CronJob).Spec = job.Spec
+	}); err != nil {
+		return fmt.Errorf("failed to install CronJob %s, error: %w", c.name, err)
+	}
+
+	logger.Info(fmt.Sprintf("installed CronJob %s/%s on %q, deleting the %s of the runs older than %v minutes", c.namespace, c.name, c.schedule, strings.Join(c.resources, ", "), c.ttl))
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// errNoCollision marks a colliding create which got in, the name it reused
+// wasn't taken.
+var errNoCollision = errors.New("name not taken")
+
+// collideTick creates a copy of the runner's object under its name, which is
+// taken since the setup, so the apiserver rejects it as AlreadyExists. The
+// rejections are reported as create/collision, a create which got in, the
+// object being gone, is reported as an error and the object is kept.
+func (r *Runner) collideTick() {
+	if !r.limits.reserveObject() {
+		return
+	}
+
+	obj := r.object()
+
+	start := time.Now()
+	err := r.Client.Create(r.context(), obj)
+	d := time.Since(start)
+
+	switch {
+	case k8serrors.IsAlreadyExists(err):
+		r.limits.releaseObject()
+		r.metrics.Observe("create/collision", d, nil)
+
+	case err != nil:
+		r.limits.releaseObject()
+		r.metrics.Observe("create/collision", d, err)
+		r.logger.Error(err, fmt.Sprintf("failed to create %s", r.getKey()))
+
+	default:
+		r.limits.commitObject()
+		r.state.add(r.template)
+		r.metrics.Observe("create/collision", d, errNoCollision)
+	}
+}
+
+// injectCollision tells whether this tick sends a colliding create instead.
+func (r *Runner) injectCollision() bool {
+	return r.collidePercent > 0 && r.random().Float64()*100 < r.collidePercent
+}
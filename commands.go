@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/go-logr/logr"
+)
+
+// command is a subcommand, e.g. "load-simulator plan -concurrent 100". Running
+// without a subcommand starts the load.
+type command struct {
+	description string
+	run         func(args []string, logger logr.Logger) error
+}
+
+var commands map[string]command
+
+// commands is filled by init, the commands parse the flags, whose usage lists
+// the commands.
+func init() {
+	commands = map[string]command{
+		"apf-experiment":  {description: "run the load given after -- once for each of -shares, attributed to a temporary FlowSchema and priority level installed for the run and removed afterwards, then compare the requests of the runs", run: apfExperimentCommand},
+		"analyze":         {description: "watch the objects of a run, given its flags and -run-id, for -duration seconds, reporting the delay of the writes stamped with -stamp-writes and the ones lost or reordered", run: analyzeCommand},
+		"cleanup-cronjob": {description: "cleanup-cronjob install|uninstall, install a CronJob in the cluster deleting the objects of the kinds of the run given after --, of any run, once older than -ttl, so they're cleaned up even when the machine of a run dies, or remove it", run: cleanupCronJobCommand},
+		"env":             {description: "env up|down, create a kind cluster set up for a preset, installing the CRDs of its templates, or delete it", run: envCommand},
+		"flowschema":      {description: "flowschema install|uninstall, install the FlowSchema and the priority level the requests of -low-priority runs are classified into, or remove them", run: flowSchemaCommand},
+		"plan":            {description: "print what a run with the same flags would create, without touching the cluster", run: planCommand},
+		"rbac":            {description: "create a ServiceAccount with only the permissions the run given after -- needs, print its kubeconfig, and remove it all once interrupted", run: rbacCommand},
+		"rbac-report":     {description: "print the permissions the phases of a scenario (-f), or the run given after --, need, as a table or as the RBAC objects (-o yaml), without touching the cluster", run: rbacReportCommand},
+		"version":         {description: "print the git commit and the date the simulator was built from", run: versionCommand},
+		"restore":         {description: "create the objects of a snapshot (-f) again, the ones already there are left as they are", run: restoreCommand},
+		"snapshot":        {description: "write the objects of the run given after --, of its -run-id or of any run, to a file (-f) for restore to create them again, so a long pre-population doesn't have to be repeated", run: snapshotCommand},
+		"scenario":        {description: "run the phases of a scenario file (-f) one after the other, honoring their dependencies, conditions and priorities", run: scenarioCommand},
+	}
+}
+
+func usage(fs *flag.FlagSet) func() {
+	return func() {
+		out := fs.Output()
+
+		fmt.Fprintf(out, "Usage of %s:\n", fs.Name())
+		fs.PrintDefaults()
+
+		names := []string{}
+		for name := range commands {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		fmt.Fprintf(out, "\nCommands:\n")
+		for _, name := range names {
+			fmt.Fprintf(out, "  %s\n    \t%s\n", name, commands[name].description)
+		}
+	}
+}
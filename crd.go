@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	crdGroup = "load-simulator.io"
+
+	crdChurnInstall  = "install"
+	crdChurnVersions = "versions"
+
+	// stop waiting for a CRD change to show up in discovery after this
+	crdDiscoveryTimeout = 30 * time.Second
+
+	// stop waiting for a deleted CRD to be gone after this
+	crdDeletionTimeout = 30 * time.Second
+
+	// stop waiting for the restored CRDs to be established after this
+	crdEstablishedTimeout = time.Minute
+)
+
+var crdGVK = schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}
+
+func validateCRDChurn(s string) error {
+	switch s {
+	case crdChurnInstall, crdChurnVersions:
+		return nil
+	}
+
+	return fmt.Errorf("unknown crd churn %q, expecting %s|%s", s, crdChurnInstall, crdChurnVersions)
+}
+
+func (r *Runner) crdPlural() string {
+	return fmt.Sprintf("loadsims%s", r.name)
+}
+
+// crdTick installs and removes a CRD on alternating ticks, or, with the
+// versions churn, adds a served version to the CRD on every tick and starts
+// over once there are r.crdMaxVersions. Every change makes the apiserver
+// republish discovery and aggregate the openapi spec again.
+//
+// The time until the change is visible in discovery is recorded as well,
+// since that's what every discovery client pays for.
+func (r *Runner) crdTick(seq int) {
+	if r.crdChurn == crdChurnVersions {
+		r.crdVersionsTick(seq)
+		return
+	}
+
+	ctx := r.context()
+	crd := r.crdObject(1)
+
+	if seq%2 == 1 {
+		if err := r.metrics.Time("crd/create", func() error {
+			return r.Client.Create(ctx, crd)
+		}); err != nil && !k8serrors.IsAlreadyExists(err) {
+			r.logger.Error(err, fmt.Sprintf("failed to create crd %s", crd.GetName()))
+			return
+		}
+
+		r.waitDiscovery("crd/discovery-added", "v1", true)
+
+		return
+	}
+
+	if err := r.metrics.Time("crd/delete", func() error {
+		return r.Client.Delete(ctx, crd)
+	}); err != nil && !k8serrors.IsNotFound(err) {
+		r.logger.Error(err, fmt.Sprintf("failed to delete crd %s", crd.GetName()))
+		return
+	}
+
+	r.waitDiscovery("crd/discovery-removed", "v1", false)
+}
+
+func (r *Runner) crdVersionsTick(seq int) {
+	ctx := r.context()
+
+	max := r.crdMaxVersions
+	if max < 1 {
+		max = 1
+	}
+
+	versions := (seq-1)%max + 1
+	crd := r.crdObject(versions)
+
+	if versions == 1 {
+		// the cycle starts over with a new CRD, once the previous one is gone
+		if err := r.metrics.Time("crd/delete", func() error {
+			if err := r.Client.Delete(ctx, crd); err != nil && !k8serrors.IsNotFound(err) {
+				return err
+			}
+
+			return nil
+		}); err != nil {
+			r.logger.Error(err, fmt.Sprintf("failed to delete crd %s", crd.GetName()))
+			return
+		}
+
+		if err := r.metrics.Time("crd/deleted", func() error {
+			return r.waitCRDGone(crd.GetName())
+		}); err != nil {
+			r.logger.Error(err, fmt.Sprintf("failed to wait for crd %s to be deleted", crd.GetName()))
+			return
+		}
+
+		if err := r.metrics.Time("crd/create", func() error {
+			return r.Client.Create(ctx, crd)
+		}); err != nil {
+			r.logger.Error(err, fmt.Sprintf("failed to create crd %s", crd.GetName()))
+		}
+
+		return
+	}
+
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(crdGVK)
+
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: crd.GetName()}, current); err != nil {
+		r.logger.Error(err, fmt.Sprintf("failed to get crd %s", crd.GetName()))
+		return
+	}
+
+	crd.SetResourceVersion(current.GetResourceVersion())
+
+	if err := r.metrics.Time("crd/add-version", func() error {
+		return r.Client.Update(ctx, crd)
+	}); err != nil {
+		r.logger.Error(err, fmt.Sprintf("failed to add version to crd %s", crd.GetName()))
+		return
+	}
+
+	r.waitDiscovery("crd/discovery-added", fmt.Sprintf("v%v", versions), true)
+}
+
+// waitCRDGone polls the CRD name until it's deleted, its custom resources
+// are deleted first, up to crdDeletionTimeout.
+func (r *Runner) waitCRDGone(name string) error {
+	start := time.Now()
+
+	for time.Since(start) < crdDeletionTimeout {
+		current := &unstructured.Unstructured{}
+		current.SetGroupVersionKind(crdGVK)
+
+		err := r.Client.Get(r.context(), types.NamespacedName{Name: name}, current)
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+
+		if r.context().Err() != nil {
+			return r.context().Err()
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return fmt.Errorf("timeout")
+}
+
+// waitDiscovery polls discovery until the runner's resource of version
+// is served (or not) and records the time it took under op.
+func (r *Runner) waitDiscovery(op, version string, served bool) {
+	dc, err := r.discoveryClient()
+	if err != nil {
+		r.logger.Error(err, "failed to wait for discovery")
+		return
+	}
+
+	gv := schema.GroupVersion{Group: crdGroup, Version: version}.String()
+	start := time.Now()
+
+	for time.Since(start) < crdDiscoveryTimeout {
+		res, err := dc.ServerResourcesForGroupVersion(gv)
+
+		found := false
+		if err == nil {
+			for _, api := range res.APIResources {
+				if api.Name == r.crdPlural() {
+					found = true
+				}
+			}
+		}
+
+		if found == served {
+			r.metrics.Observe(op, time.Since(start), nil)
+			return
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	r.metrics.Observe(op, time.Since(start), fmt.Errorf("timeout"))
+}
+
+// crdObject builds the runner's CRD serving versions v1 to vN, v1 being the
+// storage version.
+func (r *Runner) crdObject(n int) *unstructured.Unstructured {
+	plural := r.crdPlural()
+
+	versions := []interface{}{}
+	for i := 1; i <= n; i++ {
+		versions = append(versions, map[string]interface{}{
+			"name":    fmt.Sprintf("v%v", i),
+			"served":  true,
+			"storage": i == 1,
+			"schema": map[string]interface{}{
+				"openAPIV3Schema": map[string]interface{}{
+					"type":                                 "object",
+					"x-kubernetes-preserve-unknown-fields": true,
+				},
+			},
+		})
+	}
+
+	crd := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"group": crdGroup,
+			"scope": "Namespaced",
+			"names": map[string]interface{}{
+				"plural": plural,
+				// not the plural truncated, loadsims1 of runner 10 would
+				// be the plural of runner 1
+				"singular": fmt.Sprintf("loadsim%s", r.name),
+				"kind":     fmt.Sprintf("LoadSim%s", r.name),
+				"listKind": fmt.Sprintf("LoadSim%sList", r.name),
+			},
+			"versions": versions,
+		},
+	}}
+
+	crd.SetGroupVersionKind(crdGVK)
+	crd.SetName(fmt.Sprintf("%s.%s", plural, crdGroup))
+	crd.SetLabels(map[string]string{runnerLabel: r.name, runLabel: r.runID})
+
+	return crd
+}
+
+func (r *Runner) crdTeardown() {
+	if err := r.Client.Delete(r.context(), r.crdObject(1)); err != nil && !k8serrors.IsNotFound(err) {
+		r.logger.Error(err, "failed to delete crd")
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// minTokenExpiration is the shortest expiration the apiserver grants a
+// token.
+const minTokenExpiration = 10 * time.Minute
+
+// parseServiceAccount parses "<namespace>/<name>".
+func parseServiceAccount(s string) (types.NamespacedName, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return types.NamespacedName{}, fmt.Errorf("invalid ServiceAccount %q, expecting <namespace>/<name>", s)
+	}
+
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, nil
+}
+
+// withToken has config authenticate with the token alone, instead of the
+// credentials of the kubeconfig.
+func withToken(config *restclient.Config, token string) {
+	config.BearerToken = token
+	config.BearerTokenFile = ""
+	config.Username, config.Password = "", ""
+	config.CertData, config.CertFile = nil, ""
+	config.KeyData, config.KeyFile = nil, ""
+	config.AuthProvider = nil
+	config.ExecProvider = nil
+}
+
+// untilRotation is the time until the next multiple of every, so the
+// runners rotate at the same time, like a fleet-wide rotation.
+func untilRotation(every time.Duration) time.Duration {
+	now := time.Now()
+
+	return now.Truncate(every).Add(every).Sub(now)
+}
+
+// rotateCredentials issues a new token of r.rotateAccount for the runner,
+// with the credentials of the kubeconfig, and rebuilds its client on a new
+// transport, the way a client picks up a rotated credential. The token
+// request is reported as rotate/token, and the first request with the new
+// token, paying for the TLS handshake and the authentication, as
+// rotate/handshake.
+func (r *Runner) rotateCredentials() error {
+	ctx := r.context()
+
+	if r.tokenClient == nil {
+		config, err := clientcmd.BuildConfigFromFlags("", r.kubeconfig)
+		if err != nil {
+			return fmt.Errorf("failed to load rest.Config, error: %w", err)
+		}
+
+		if r.tokenClient, err = kubernetes.NewForConfig(config); err != nil {
+			return fmt.Errorf("failed to create clientset, error: %w", err)
+		}
+	}
+
+	// the token outlives the next rotation
+	expiration := 2 * r.rotateEvery
+	if expiration < minTokenExpiration {
+		expiration = minTokenExpiration
+	}
+
+	seconds := int64(expiration / time.Second)
+
+	var token string
+	if err := r.metrics.Time("rotate/token", func() error {
+		tr, err := r.tokenClient.CoreV1().ServiceAccounts(r.rotateAccount.Namespace).CreateToken(ctx, r.rotateAccount.Name, &authenticationv1.TokenRequest{
+			Spec: authenticationv1.TokenRequestSpec{ExpirationSeconds: &seconds},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return err
+		}
+
+		token = tr.Status.Token
+
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to request a token of ServiceAccount %s, error: %w", r.rotateAccount, err)
+	}
+
+	transport, readTransport := r.transport, r.readTransport
+
+	r.token = token
+	if err := r.configClient(); err != nil {
+		return err
+	}
+
+	r.shareClient()
+
+	// the connections of the previous credential are dropped once idle
+	if transport != nil {
+		transport.CloseIdleConnections()
+	}
+
+	if readTransport != nil {
+		readTransport.CloseIdleConnections()
+	}
+
+	dc, err := discovery.NewDiscoveryClientForConfig(r.config)
+	if err != nil {
+		return fmt.Errorf("failed to create discovery client, error: %w", err)
+	}
+
+	return r.metrics.Time("rotate/handshake", func() error {
+		_, err := dc.ServerVersion()
+		return err
+	})
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// csrSetup creates the approver client, if a kubeconfig is given for it.
+func (r *Runner) csrSetup() error {
+	if r.csrApproverKubeconfig == "" {
+		return nil
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", r.csrApproverKubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to load the approver rest.Config, error: %w", err)
+	}
+
+	cs, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create the approver client, error: %w", err)
+	}
+
+	r.csrApprover = cs
+
+	return nil
+}
+
+// csrTick creates a client certificate CSR with a fresh key, the same way a
+// klusterlet does when it rotates its hub client certificate, and approves it
+// with the approver client when there's one.
+func (r *Runner) csrTick(seq int) {
+	ctx := r.context()
+
+	name := fmt.Sprintf("%s-%s-%v", fieldManagerPrefix, r.name, seq)
+
+	req, err := newCSRRequest(fmt.Sprintf("system:open-cluster-management:%s:%s", fieldManagerPrefix, name))
+	if err != nil {
+		r.logger.Error(err, "failed to generate certificate request")
+		return
+	}
+
+	csr := &certificatesv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{runnerLabel: r.name, runLabel: r.runID},
+		},
+		Spec: certificatesv1.CertificateSigningRequestSpec{
+			Request:    req,
+			SignerName: certificatesv1.KubeAPIServerClientSignerName,
+			Usages:     []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageKeyEncipherment, certificatesv1.UsageClientAuth},
+		},
+	}
+
+	if err := r.metrics.Time("csr/create", func() error {
+		return r.Client.Create(ctx, csr)
+	}); err != nil {
+		if !k8serrors.IsAlreadyExists(err) {
+			r.logger.Error(err, fmt.Sprintf("failed to create csr %s", name))
+		}
+
+		return
+	}
+
+	r.csrNames = append(r.csrNames, name)
+
+	if r.csrApprover == nil {
+		return
+	}
+
+	csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+		Type:    certificatesv1.CertificateApproved,
+		Status:  corev1.ConditionTrue,
+		Reason:  "LoadSimulatorApprove",
+		Message: "approved by load-simulator",
+	})
+
+	if err := r.metrics.Time("csr/approve", func() error {
+		_, err := r.csrApprover.CertificatesV1().CertificateSigningRequests().UpdateApproval(ctx, name, csr, metav1.UpdateOptions{})
+		return err
+	}); err != nil {
+		r.logger.Error(err, fmt.Sprintf("failed to approve csr %s", name))
+	}
+}
+
+// csrTeardown deletes the CSRs created by this runner.
+func (r *Runner) csrTeardown() {
+	ctx := r.context()
+
+	for _, name := range r.csrNames {
+		csr := &certificatesv1.CertificateSigningRequest{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if err := r.Client.Delete(ctx, csr); err != nil && !k8serrors.IsNotFound(err) {
+			r.logger.Error(err, fmt.Sprintf("failed to delete csr %s", name))
+		}
+	}
+
+	r.logger.Info(fmt.Sprintf("deleted %v csr of %s", len(r.csrNames), r.name))
+}
+
+func newCSRRequest(cn string) ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := &x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName:   cn,
+			Organization: []string{"system:open-cluster-management:" + fieldManagerPrefix},
+		},
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, tmpl, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
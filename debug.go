@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// debugServer serves pprof, and the live metrics of the run when asked, on
+// the default mux pprof registers to.
+type debugServer struct {
+	addr    string
+	token   string
+	metrics bool
+	// tags are set on the metrics served
+	tags map[string]string
+
+	mu      sync.Mutex
+	current *Metrics
+}
+
+// validateDebugAddr refuses to expose the profiles beyond the loopback
+// interface without a token.
+func validateDebugAddr(addr, token string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid pprof-addr %s, error: %w", addr, err)
+	}
+
+	if host == "localhost" {
+		return nil
+	}
+
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+
+	if token == "" {
+		return fmt.Errorf("pprof-addr %s isn't a loopback address, it needs pprof-token", addr)
+	}
+
+	return nil
+}
+
+// set makes m the metrics served, each layout has its own.
+func (s *debugServer) set(m *Metrics) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.current = m
+}
+
+func (s *debugServer) serve() error {
+	if s.metrics {
+		http.HandleFunc("/metrics", s.serveMetrics)
+	}
+
+	return http.ListenAndServe(s.addr, s.authorize(http.DefaultServeMux))
+}
+
+func (s *debugServer) serveMetrics(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	m := s.current
+	s.mu.Unlock()
+
+	summary := []Summary{}
+	if m != nil {
+		summary = tagged(m.Summary(), s.tags)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(summary); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// authorize expects "Authorization: Bearer <token>" when a token is set.
+func (s *debugServer) authorize(next http.Handler) http.Handler {
+	if s.token == "" {
+		return next
+	}
+
+	want := []byte("Bearer " + s.token)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), want) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// digits are masked in the dedup keys, so that the same error of different
+// runners, e.g. on load-simulator-12 and load-simulator-13, is aggregated.
+var digits = regexp.MustCompile(`[0-9]+`)
+
+// dedupLogger logs the first occurrence of an error, and only counts the
+// identical ones until the end of the window, since at high error rates
+// logging each failure becomes the bottleneck and fills the disks of soaks.
+type dedupLogger struct {
+	logr.Logger
+	d *dedup
+}
+
+type dedup struct {
+	mu     sync.Mutex
+	window time.Duration
+	seen   map[string]*occurrences
+	done   chan struct{}
+}
+
+type occurrences struct {
+	logger logr.Logger
+	err    error
+	msg    string
+	count  int
+}
+
+// newDedupLogger flushes the counts every window, until close.
+func newDedupLogger(logger logr.Logger, window time.Duration) *dedupLogger {
+	l := &dedupLogger{
+		Logger: logger,
+		d: &dedup{
+			window: window,
+			seen:   map[string]*occurrences{},
+			done:   make(chan struct{}),
+		},
+	}
+
+	go func() {
+		ticker := time.NewTicker(window)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-l.d.done:
+				return
+			case <-ticker.C:
+				l.d.flush()
+			}
+		}
+	}()
+
+	return l
+}
+
+func (l *dedupLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	key := digits.ReplaceAllString(fmt.Sprintf("%s: %v", msg, err), "N")
+
+	l.d.mu.Lock()
+	o, ok := l.d.seen[key]
+	if ok {
+		o.count += 1
+	} else {
+		l.d.seen[key] = &occurrences{logger: l.Logger, err: err, msg: msg}
+	}
+	l.d.mu.Unlock()
+
+	if !ok {
+		l.Logger.Error(err, msg, keysAndValues...)
+	}
+}
+
+func (l *dedupLogger) V(level int) logr.Logger {
+	return &dedupLogger{Logger: l.Logger.V(level), d: l.d}
+}
+
+func (l *dedupLogger) WithValues(keysAndValues ...interface{}) logr.Logger {
+	return &dedupLogger{Logger: l.Logger.WithValues(keysAndValues...), d: l.d}
+}
+
+func (l *dedupLogger) WithName(name string) logr.Logger {
+	return &dedupLogger{Logger: l.Logger.WithName(name), d: l.d}
+}
+
+// close stops the flushes and logs the last counts.
+func (l *dedupLogger) close() {
+	close(l.d.done)
+	l.d.flush()
+}
+
+// flush logs the errors which occurred again within the window, and starts a
+// new window.
+func (d *dedup) flush() {
+	d.mu.Lock()
+	seen := d.seen
+	d.seen = map[string]*occurrences{}
+	d.mu.Unlock()
+
+	keys := []string{}
+	for key, o := range seen {
+		if o.count != 0 {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		o := seen[key]
+		o.logger.Error(o.err, fmt.Sprintf("%s, occurred %v more times in the last %v", o.msg, o.count, d.window))
+	}
+}
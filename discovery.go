@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	discoveryAPIs      = "apis"
+	discoveryOpenAPIV2 = "openapi-v2"
+	discoveryOpenAPIV3 = "openapi-v3"
+)
+
+var discoveryPaths = map[string]string{
+	discoveryOpenAPIV2: "/openapi/v2",
+	discoveryOpenAPIV3: "/openapi/v3",
+}
+
+func parseDiscoveryTargets(s string) ([]string, error) {
+	out := []string{}
+
+	for _, t := range strings.Split(s, ",") {
+		t = strings.TrimSpace(t)
+		switch t {
+		case "":
+			continue
+		case discoveryAPIs, discoveryOpenAPIV2, discoveryOpenAPIV3:
+			out = append(out, t)
+		default:
+			return nil, fmt.Errorf("unknown discovery target %q, expecting a list of %s,%s,%s", t, discoveryAPIs, discoveryOpenAPIV2, discoveryOpenAPIV3)
+		}
+	}
+
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no discovery target is given")
+	}
+
+	return out, nil
+}
+
+// discoveryClient returns the runner's uncached discovery client.
+func (r *Runner) discoveryClient() (discovery.DiscoveryInterface, error) {
+	if r.discovery != nil {
+		return r.discovery, nil
+	}
+
+	dc, err := discovery.NewDiscoveryClientForConfig(r.config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery client, error: %w", err)
+	}
+
+	r.discovery = dc
+
+	return dc, nil
+}
+
+// typedClient returns the runner's clientset, for the subresources the
+// client doesn't cover.
+func (r *Runner) typedClient() (kubernetes.Interface, error) {
+	if r.clientset != nil {
+		return r.clientset, nil
+	}
+
+	cs, err := kubernetes.NewForConfig(r.config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset, error: %w", err)
+	}
+
+	r.clientset = cs
+
+	return cs, nil
+}
+
+// discoveryTick fetches one of r.discoveryTargets, in rotation, without any
+// cache, the way a freshly started kubectl or controller does. The apis
+// target walks /api, /apis and every group version, which is what hits the
+// aggregator hardest.
+func (r *Runner) discoveryTick(seq int) {
+	dc, err := r.discoveryClient()
+	if err != nil {
+		r.logger.Error(err, "failed to fetch discovery")
+		return
+	}
+
+	target := r.discoveryTargets[seq%len(r.discoveryTargets)]
+
+	err = r.metrics.Time("discovery/"+target, func() error {
+		if target == discoveryAPIs {
+			_, _, err := dc.ServerGroupsAndResources()
+			return err
+		}
+
+		_, err := dc.RESTClient().Get().AbsPath(discoveryPaths[target]).DoRaw(r.context())
+		return err
+	})
+	if err != nil {
+		r.logger.Error(err, fmt.Sprintf("failed to fetch %s", target))
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	endpointPerClient  = "per-client"
+	endpointRoundRobin = "round-robin"
+	endpointFailover   = "failover"
+)
+
+// endpoints are the apiserver replicas the requests are spread over, instead
+// of the server of the kubeconfig, e.g. to load HA replicas evenly or pin
+// the load to one of them for comparison.
+type endpoints struct {
+	urls   []*url.URL
+	policy string
+	// weights skew the load over the urls like an imbalanced load
+	// balancer, nil spreads it evenly
+	weights []int
+	// clients is the number of clients per-client splits by the weights
+	clients int
+}
+
+func parseEndpoints(s, policy string) (*endpoints, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	switch policy {
+	case endpointPerClient, endpointRoundRobin, endpointFailover:
+	default:
+		return nil, fmt.Errorf("unknown endpoint policy %q, expecting %s|%s|%s", policy, endpointPerClient, endpointRoundRobin, endpointFailover)
+	}
+
+	e := &endpoints{policy: policy}
+	weights, weighted := []int{}, false
+
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		weight := 1
+		if idx := strings.LastIndex(item, "="); idx != -1 {
+			n, err := strconv.Atoi(item[idx+1:])
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid endpoint weight %q, expecting a positive integer", item[idx+1:])
+			}
+
+			item, weight, weighted = item[:idx], n, true
+		}
+
+		u, err := url.Parse(item)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint %q, expecting https://<host>:<port>[=<weight>]", item)
+		}
+
+		e.urls = append(e.urls, u)
+		weights = append(weights, weight)
+	}
+
+	if weighted {
+		if policy == endpointFailover {
+			return nil, fmt.Errorf("endpoint weights don't apply to the failover policy")
+		}
+
+		e.weights = weights
+	}
+
+	return e, nil
+}
+
+// share is the percentage of the load the endpoint i gets.
+func (e *endpoints) share(i int) float64 {
+	if e.weights == nil {
+		return 100 / float64(len(e.urls))
+	}
+
+	sum := 0
+	for _, w := range e.weights {
+		sum += w
+	}
+
+	return 100 * float64(e.weights[i]) / float64(sum)
+}
+
+// endpointRoundTripper sends each request to an endpoint picked by the
+// policy: per-client sticks a client to an endpoint by its index, like a load
+// balancer with long lived connections, round-robin rotates every request,
+// failover sticks to an endpoint until it refuses connections. With weights,
+// per-client splits the clients and round-robin the requests by weight. The
+// requests are recorded by endpoint.
+type endpointRoundTripper struct {
+	endpoints *endpoints
+	index     int
+	// next is the rotation of round-robin, or the current endpoint of
+	// failover
+	next    int64
+	metrics *Metrics
+	rt      http.RoundTripper
+}
+
+func (rt *endpointRoundTripper) pick() int {
+	n := int64(len(rt.endpoints.urls))
+
+	weights := rt.endpoints.weights
+
+	switch rt.endpoints.policy {
+	case endpointRoundRobin:
+		seq := atomic.AddInt64(&rt.next, 1) - 1
+		if weights == nil {
+			return int(seq % n)
+		}
+
+		sum := 0
+		for _, w := range weights {
+			sum += w
+		}
+
+		// spread the slots of a cycle so the endpoints alternate instead of
+		// getting their share in a row
+		slot := int(seq % int64(sum))
+		return weightedIndex(weights, slot*spreadStep(sum)%sum, sum)
+	case endpointFailover:
+		return int(atomic.LoadInt64(&rt.next) % n)
+	}
+
+	if weights == nil || rt.endpoints.clients < 1 {
+		return rt.index % int(n)
+	}
+
+	return weightedIndex(weights, rt.index%rt.endpoints.clients, rt.endpoints.clients)
+}
+
+// spreadStep is a step coprime with sum, stepping through 0..sum-1 by it
+// visits every slot once per cycle in a scattered order.
+func spreadStep(sum int) int {
+	for step := sum/2 + 1; step < sum; step++ {
+		if gcd(step, sum) == 1 {
+			return step
+		}
+	}
+
+	return 1
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+
+	return a
+}
+
+func (rt *endpointRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	idx := rt.pick()
+
+	for attempt := 0; ; attempt++ {
+		u := rt.endpoints.urls[idx]
+
+		out := req.Clone(req.Context())
+		out.URL.Scheme = u.Scheme
+		out.URL.Host = u.Host
+		out.Host = ""
+
+		start := time.Now()
+		resp, err := rt.rt.RoundTrip(out)
+		if rt.metrics != nil {
+			rt.metrics.Observe(u.Host, time.Since(start), err)
+		}
+
+		// only the requests which were never sent are safe to send again
+		if err == nil || rt.endpoints.policy != endpointFailover || !refused(err) || attempt == len(rt.endpoints.urls)-1 {
+			return resp, err
+		}
+
+		idx = (idx + 1) % len(rt.endpoints.urls)
+		atomic.StoreInt64(&rt.next, int64(idx))
+	}
+}
+
+// refused tells whether the connection couldn't be established.
+func refused(err error) bool {
+	var op *net.OpError
+
+	return errors.As(err, &op) && op.Op == "dial"
+}
+
+func wrapEndpoints(e *endpoints, index int, m *Metrics) func(http.RoundTripper) http.RoundTripper {
+	return func(next http.RoundTripper) http.RoundTripper {
+		if e == nil || len(e.urls) == 0 {
+			return next
+		}
+
+		return &endpointRoundTripper{endpoints: e, index: index, metrics: m, rt: next}
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	envUp   = "up"
+	envDown = "down"
+
+	kwokAnnotation = "kwok.x-k8s.io/node"
+)
+
+// envCommand manages a local kind cluster set up for a preset, so a
+// meaningful load test runs locally in one command.
+func envCommand(args []string, logger logr.Logger) error {
+	if len(args) == 0 || (args[0] != envUp && args[0] != envDown) {
+		return fmt.Errorf("expecting env %s|%s", envUp, envDown)
+	}
+
+	fs := flag.NewFlagSet("env "+args[0], flag.ContinueOnError)
+
+	name := fs.String("name", "load-simulator", "name of the kind cluster")
+	kubeconfig := fs.String("kubeconfig-out", "./load-simulator.kubeconfig", "path the kubeconfig of the cluster is written to")
+	preset := fs.String("preset", "", "preset the cluster is set up for, the CRDs of its templates are installed")
+	template := fs.String("template", "", "comma separated paths to the templates the cluster is set up for, the default of a run when empty")
+	kwokNodes := fs.Int("kwok-nodes", 0, "number of fake nodes registered for kwok, they only turn ready with the kwok controller running")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if _, err := exec.LookPath("kind"); err != nil {
+		return fmt.Errorf("kind isn't installed, see https://kind.sigs.k8s.io, error: %w", err)
+	}
+
+	if args[0] == envDown {
+		return kind("delete", "cluster", "--name", *name)
+	}
+
+	runArgs := []string{"-kubeconfig", *kubeconfig}
+	if *preset != "" {
+		runArgs = append(runArgs, "-preset", *preset)
+	}
+
+	if *template != "" {
+		runArgs = append(runArgs, "-template", *template)
+	}
+
+	o, err := parseOptions("env up", runArgs)
+	if err != nil {
+		return err
+	}
+
+	// the env doesn't run, it has nothing to record
+	o.state = nil
+
+	if err := o.loadTemplates(); err != nil {
+		return err
+	}
+
+	out, err := exec.Command("kind", "get", "clusters").Output()
+	if err != nil {
+		return fmt.Errorf("failed to list the kind clusters, error: %w", err)
+	}
+
+	if strings.Contains("\n"+string(out), "\n"+*name+"\n") {
+		logger.Info(fmt.Sprintf("kind cluster %s already exists", *name))
+
+		if err := kind("export", "kubeconfig", "--name", *name, "--kubeconfig", *kubeconfig); err != nil {
+			return err
+		}
+	} else if err := kind("create", "cluster", "--name", *name, "--kubeconfig", *kubeconfig, "--wait", "120s"); err != nil {
+		return err
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to load rest.Config, error: %w", err)
+	}
+
+	cl, err := client.New(config, client.Options{})
+	if err != nil {
+		return fmt.Errorf("failed to create client, error: %w", err)
+	}
+
+	dc, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create discovery client, error: %w", err)
+	}
+
+	ctx := context.TODO()
+
+	for _, gvk := range o.templateKinds() {
+		if served(dc, gvk) {
+			continue
+		}
+
+		if err := cl.Create(ctx, templateCRD(gvk)); err != nil && !k8serrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to install the CRD of %s, error: %w", gvk, err)
+		}
+
+		logger.Info(fmt.Sprintf("installed a schemaless CRD for %s", gvk))
+	}
+
+	for i := 0; i < *kwokNodes; i++ {
+		if err := cl.Create(ctx, kwokNode(i)); err != nil && !k8serrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to register kwok node %v, error: %w", i, err)
+		}
+	}
+
+	fmt.Printf("the cluster is ready, run the load with:\n  load-simulator %s\n", strings.Join(runArgs, " "))
+
+	return nil
+}
+
+func kind(args ...string) error {
+	cmd := exec.Command("kind", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("kind %s failed, error: %w", strings.Join(args, " "), err)
+	}
+
+	return nil
+}
+
+func served(dc discovery.DiscoveryInterface, gvk schema.GroupVersionKind) bool {
+	list, err := dc.ServerResourcesForGroupVersion(gvk.GroupVersion().String())
+	if err != nil {
+		return false
+	}
+
+	for _, r := range list.APIResources {
+		if r.Kind == gvk.Kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// templateCRD accepts any object of the template's kind, the simulator only
+// needs the apiserver to store them.
+func templateCRD(gvk schema.GroupVersionKind) *unstructured.Unstructured {
+	plural, singular := meta.UnsafeGuessKindToResource(gvk)
+
+	crd := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"group": gvk.Group,
+			"scope": "Namespaced",
+			"names": map[string]interface{}{
+				"plural":   plural.Resource,
+				"singular": singular.Resource,
+				"kind":     gvk.Kind,
+				"listKind": gvk.Kind + "List",
+			},
+			"versions": []interface{}{
+				map[string]interface{}{
+					"name":    gvk.Version,
+					"served":  true,
+					"storage": true,
+					"schema": map[string]interface{}{
+						"openAPIV3Schema": map[string]interface{}{
+							"type":                                 "object",
+							"x-kubernetes-preserve-unknown-fields": true,
+						},
+					},
+				},
+			},
+		},
+	}}
+
+	crd.SetGroupVersionKind(crdGVK)
+	crd.SetName(fmt.Sprintf("%s.%s", plural.Resource, gvk.Group))
+
+	return crd
+}
+
+// kwokNode is a fake node the kwok controller keeps ready.
+func kwokNode(i int) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("kwok-node-%v", i),
+			Annotations: map[string]string{kwokAnnotation: "fake"},
+			Labels:      map[string]string{"type": "kwok"},
+		},
+		Spec: corev1.NodeSpec{
+			Taints: []corev1.Taint{{Key: kwokAnnotation, Value: "fake", Effect: corev1.TaintEffectNoSchedule}},
+		},
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const evictObjectPrefix = "load-simulator-evict"
+
+// evictRunningExpr holds once a pod is Running, the apiserver evicts a pending
+// pod without checking the budget.
+var evictRunningExpr, _ = parseWaitExpr(".status.phase == Running")
+
+// evictSetup creates the namespace with a PodDisruptionBudget, and the
+// r.evictPods pods it covers, then waits for them to run. Without nodes, the
+// pods are set Running through their status instead, nothing else updates
+// them.
+func (r *Runner) evictSetup() error {
+	ctx := r.context()
+	ns := r.template.GetNamespace()
+
+	if err := r.createNamespace(ctx, ns); err != nil {
+		return err
+	}
+
+	minAvailable := intstr.FromInt(r.evictMinAvailable)
+
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Name: evictObjectPrefix, Namespace: ns, Labels: r.labels(nil)},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MinAvailable: &minAvailable,
+			Selector:     &metav1.LabelSelector{MatchLabels: map[string]string{"app": evictObjectPrefix}},
+		},
+	}
+
+	// the runners of the shared layout share the budget
+	handling := r.onAlreadyExists
+	if r.sharedNamespace {
+		handling = outcomeIgnore
+	}
+
+	if err := r.createObject(ctx, "evict/create-budget", pdb, handling); err != nil {
+		return fmt.Errorf("failed to create the PodDisruptionBudget in %s, error: %w", ns, err)
+	}
+
+	cs, err := r.typedClient()
+	if err != nil {
+		return err
+	}
+
+	nodes, err := cs.CoreV1().Nodes().List(ctx, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes, error: %w", err)
+	}
+
+	r.evictNodeless = len(nodes.Items) == 0
+
+	for i := 0; i < r.evictPods; i++ {
+		if err := r.createObject(ctx, "evict/create", r.evictPod(i), r.onAlreadyExists); err != nil {
+			return fmt.Errorf("failed to create pod %s, error: %w", r.evictPod(i).Name, err)
+		}
+	}
+
+	for i := 0; i < r.evictPods; i++ {
+		if _, err := r.evictReady(ctx, i, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// evictReady tells whether pod i is Running, without nodes it's set Running
+// through its status, otherwise, with wait, it's waited for.
+func (r *Runner) evictReady(ctx context.Context, i int, wait bool) (bool, error) {
+	if r.evictRunning[i] {
+		return true, nil
+	}
+
+	pod := r.evictPod(i)
+
+	if r.evictNodeless {
+		patch := []byte(`{"status":{"phase":"Running"}}`)
+		if err := r.metrics.Time("evict/run", func() error {
+			return r.Client.Status().Patch(ctx, pod, client.RawPatch(types.MergePatchType, patch))
+		}); err != nil {
+			return false, fmt.Errorf("failed to set pod %s Running, error: %w", pod.Name, err)
+		}
+
+		r.evictRunning[i] = true
+
+		return true, nil
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Pod"))
+	obj.SetName(pod.Name)
+	obj.SetNamespace(pod.Namespace)
+
+	if !wait {
+		if err := r.Client.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+			return false, fmt.Errorf("failed to get pod %s, error: %w", pod.Name, err)
+		}
+
+		ok, err := evictRunningExpr.holds(obj)
+		r.evictRunning[i] = ok
+
+		return ok, err
+	}
+
+	if err := r.poll(ctx, obj, evictRunningExpr); err != nil {
+		return false, fmt.Errorf("failed to wait for pod %s to run, error: %w", pod.Name, err)
+	}
+
+	r.evictRunning[i] = true
+
+	return true, nil
+}
+
+// evictTick evicts the pods in rotation with a policy/v1 Eviction, so the
+// apiserver evaluates the PodDisruptionBudget on every tick. The evictions
+// the budget refuses are reported as evict/refused, and an evicted pod is
+// created again on its next turn. A pod not Running yet isn't evicted, the
+// budget would be bypassed, the turn is reported as evict/pending.
+func (r *Runner) evictTick(seq int) {
+	ctx := r.context()
+	i := seq % r.evictPods
+	pod := r.evictPod(i)
+
+	start := time.Now()
+
+	running, err := r.evictReady(ctx, i, false)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		r.logger.Error(err, "failed to evict")
+		return
+	}
+
+	if err == nil && !running {
+		r.metrics.Observe("evict/pending", time.Since(start), nil)
+		return
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "policy/v1",
+		"kind":       "Eviction",
+		"metadata":   map[string]interface{}{"name": pod.Name, "namespace": pod.Namespace},
+	})
+	if err != nil {
+		r.logger.Error(err, "failed to marshal eviction")
+		return
+	}
+
+	// the client only knows the policy/v1beta1 Eviction
+	start = time.Now()
+	err = r.clientset.CoreV1().RESTClient().Post().
+		Namespace(pod.Namespace).
+		Resource("pods").
+		Name(pod.Name).
+		SubResource("eviction").
+		Body(body).
+		Do(ctx).
+		Error()
+
+	switch {
+	case err == nil:
+		r.metrics.Observe("evict/allowed", time.Since(start), nil)
+		r.evictRunning[i] = false
+	case k8serrors.IsTooManyRequests(err):
+		r.metrics.Observe("evict/refused", time.Since(start), nil)
+	case k8serrors.IsNotFound(err):
+		r.evictRunning[i] = false
+
+		if err := r.createObject(ctx, "evict/create", pod, r.onAlreadyExists); err != nil {
+			r.logger.Error(err, fmt.Sprintf("failed to create pod %s", pod.Name))
+			return
+		}
+
+		if _, err := r.evictReady(ctx, i, false); err != nil {
+			r.logger.Error(err, "failed to evict")
+		}
+	default:
+		r.metrics.Observe("evict/failed", time.Since(start), err)
+		r.logger.Error(err, fmt.Sprintf("failed to evict pod %s", pod.Name))
+	}
+}
+
+func (r *Runner) evictPod(i int) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%v-%v", evictObjectPrefix, r.index, i),
+			Namespace: r.template.GetNamespace(),
+			Labels:    r.labels(map[string]string{"app": evictObjectPrefix}),
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "pause", Image: "k8s.gcr.io/pause:3.5"},
+			},
+		},
+	}
+}
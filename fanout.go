@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	fanoutObjectName = "load-simulator-fanout"
+
+	fanoutConfigMap = "configmap"
+	fanoutSecret    = "secret"
+)
+
+func validateFanoutKind(s string) error {
+	switch s {
+	case fanoutConfigMap, fanoutSecret:
+		return nil
+	}
+
+	return fmt.Errorf("unknown fanout kind %q, expecting %s|%s", s, fanoutConfigMap, fanoutSecret)
+}
+
+// fanoutObject is the ConfigMap or Secret all the runners of the namespace
+// watch, the way the kubelets watch the ConfigMaps and Secrets their pods
+// mount.
+func (r *Runner) fanoutObject() client.Object {
+	meta := metav1.ObjectMeta{
+		Name:      fanoutObjectName,
+		Namespace: r.template.GetNamespace(),
+		Labels:    r.labels(nil),
+	}
+
+	payload := strings.Repeat("x", r.fanoutBytes)
+
+	if r.fanoutKind == fanoutSecret {
+		return &corev1.Secret{ObjectMeta: meta, Data: map[string][]byte{"payload": []byte(payload)}}
+	}
+
+	return &corev1.ConfigMap{ObjectMeta: meta, Data: map[string]string{"payload": payload}}
+}
+
+func (r *Runner) fanoutList() client.ObjectList {
+	if r.fanoutKind == fanoutSecret {
+		return &corev1.SecretList{}
+	}
+
+	return &corev1.ConfigMapList{}
+}
+
+// fanoutSetup creates the shared object if missing, then starts the watch of
+// the runner, each runner being one consumer of the object.
+func (r *Runner) fanoutSetup() error {
+	ctx := r.context()
+	ns := r.template.GetNamespace()
+
+	if err := r.createNamespace(ctx, ns); err != nil {
+		return err
+	}
+
+	// the first runner creates the shared object, the others find it
+	if err := r.createObject(ctx, "fanout/create", r.fanoutObject(), outcomeIgnore); err != nil {
+		return fmt.Errorf("failed to create %s %s/%s, error: %w", r.fanoutKind, ns, fanoutObjectName, err)
+	}
+
+	wc, err := client.NewWithWatch(r.config, client.Options{})
+	if err != nil {
+		return fmt.Errorf("failed to create watch client, error: %w", err)
+	}
+
+	wctx, cancel := context.WithCancel(ctx)
+	r.watchCancel = cancel
+
+	go r.fanoutWatch(wctx, wc)
+
+	return nil
+}
+
+// fanoutWatch watches the shared object until ctx is done, resuming from the
+// last event when the apiserver closes the watch, so a re-opened watch
+// doesn't report the current object as a delivery. Each update is recorded
+// as fanout/delivery, from the write to the event.
+func (r *Runner) fanoutWatch(ctx context.Context, wc client.WithWatch) {
+	rv := ""
+
+	for ctx.Err() == nil {
+		w, err := wc.Watch(ctx, r.fanoutList(),
+			client.InNamespace(r.template.GetNamespace()),
+			client.MatchingFieldsSelector{Selector: fields.OneTermEqualSelector("metadata.name", fanoutObjectName)},
+			&client.ListOptions{Raw: &metav1.ListOptions{ResourceVersion: rv}},
+		)
+		if err != nil {
+			r.metrics.Observe("fanout/watch", 0, err)
+			time.Sleep(time.Second)
+
+			continue
+		}
+
+		for ev := range w.ResultChan() {
+			if ev.Type == watch.Error {
+				// the resourceVersion is gone, start over from the
+				// current object
+				rv = ""
+				break
+			}
+
+			obj, ok := ev.Object.(metav1.Object)
+			if !ok {
+				continue
+			}
+
+			rv = obj.GetResourceVersion()
+
+			if ev.Type != watch.Modified {
+				continue
+			}
+
+			writtenAt, err := time.Parse(time.RFC3339Nano, obj.GetAnnotations()[writtenAtAnnotation])
+			if err != nil {
+				continue
+			}
+
+			r.metrics.Observe("fanout/delivery", time.Since(writtenAt), nil)
+		}
+
+		w.Stop()
+	}
+}
+
+// fanoutTick updates the shared object with the time of the write, only the
+// first runner writes, the other ones only consume.
+func (r *Runner) fanoutTick(seq int) {
+	if r.index != 0 {
+		return
+	}
+
+	patch := []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:%q,%q:"%v"}}}`,
+		writtenAtAnnotation, time.Now().UTC().Format(time.RFC3339Nano), seqAnnotation, seq))
+
+	obj := r.fanoutObject()
+	if err := r.metrics.Time("fanout/update", func() error {
+		return r.Client.Patch(r.context(), obj, client.RawPatch(types.MergePatchType, patch))
+	}); err != nil {
+		r.logger.Error(err, fmt.Sprintf("failed to update %s %s/%s", r.fanoutKind, obj.GetNamespace(), fanoutObjectName))
+	}
+}
+
+func (r *Runner) fanoutTeardown() {
+	if r.watchCancel != nil {
+		r.watchCancel()
+	}
+
+	if r.index == 0 && !r.fastClean {
+		if err := r.Client.Delete(r.context(), r.fanoutObject()); err != nil && !k8serrors.IsNotFound(err) {
+			r.logger.Error(err, fmt.Sprintf("failed to delete %s %s", r.fanoutKind, fanoutObjectName))
+		}
+	}
+
+	r.delete()
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	restclient "k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// fastClean deletes what the runs matching selector created by collection
+// instead of one object at a time: a DeleteAllOf of each template kind in
+// each namespace holding some, and of the cluster scoped kinds, then the
+// namespaces, which can't be deleted by collection, with workers in
+// parallel. The scope tells whether the objects, the namespaces or both are
+// deleted, the cluster scoped kinds are deleted whatever the scope.
+func fastClean(ctx context.Context, config *restclient.Config, selector labels.Selector, scope string, kinds, clusterKinds []schema.GroupVersionKind, workers int, logger logr.Logger) error {
+	cl, err := client.New(config, client.Options{})
+	if err != nil {
+		return fmt.Errorf("failed to create client, error: %w", err)
+	}
+
+	matching := client.MatchingLabelsSelector{Selector: selector}
+
+	type collection struct {
+		gvk       schema.GroupVersionKind
+		namespace string
+	}
+
+	collections := []collection{}
+	for _, gvk := range clusterKinds {
+		collections = append(collections, collection{gvk: gvk})
+	}
+
+	// deleting the namespaces deletes their objects as well
+	if scope == cleanNamespaces {
+		kinds = nil
+	}
+
+	for _, gvk := range kinds {
+		// only the metadata is needed to find the namespaces
+		list := &metav1.PartialObjectMetadataList{}
+		list.SetGroupVersionKind(gvk)
+
+		if err := cl.List(ctx, list, matching); err != nil {
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+
+			return fmt.Errorf("failed to list %s, error: %w", gvk.Kind, err)
+		}
+
+		seen := map[string]bool{}
+		for _, item := range list.Items {
+			if !seen[item.Namespace] {
+				seen[item.Namespace] = true
+				collections = append(collections, collection{gvk: gvk, namespace: item.Namespace})
+			}
+		}
+	}
+
+	namespaces := &corev1.NamespaceList{}
+	if scope != cleanObjects {
+		if err := cl.List(ctx, namespaces, matching); err != nil {
+			return fmt.Errorf("failed to list namespaces, error: %w", err)
+		}
+	}
+
+	logger.Info(fmt.Sprintf("fast clean of %v collections and %v namespaces", len(collections), len(namespaces.Items)))
+
+	parallel(workers, len(collections), func(i int) {
+		c := collections[i]
+
+		obj := &metav1.PartialObjectMetadata{}
+		obj.SetGroupVersionKind(c.gvk)
+
+		opts := []client.DeleteAllOfOption{matching}
+		if c.namespace != "" {
+			opts = append(opts, client.InNamespace(c.namespace))
+		}
+
+		if err := cl.DeleteAllOf(ctx, obj, opts...); err != nil && !meta.IsNoMatchError(err) && !k8serrors.IsNotFound(err) {
+			logger.Error(err, fmt.Sprintf("failed to delete the %s collection of namespace %q", c.gvk.Kind, c.namespace))
+		}
+	})
+
+	parallel(workers, len(namespaces.Items), func(i int) {
+		ns := &namespaces.Items[i]
+
+		if err := cl.Delete(ctx, ns); err != nil && !k8serrors.IsNotFound(err) {
+			logger.Error(err, fmt.Sprintf("failed to delete namespace %s", ns.Name))
+		}
+	})
+
+	return nil
+}
+
+// parallel calls f for 0 to n-1 with workers goroutines, and waits for them.
+func parallel(workers, n int, f func(i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	items := make(chan int)
+	wg := sync.WaitGroup{}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range items {
+				f(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		items <- i
+	}
+
+	close(items)
+	wg.Wait()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// feedbackTick acts as the work agent reporting the status feedback of the
+// resources of the ManifestWork: each manifest of the template gets
+// r.feedbackValues values, the first one an integer changing on every tick so
+// each patch is a write, the other ones strings of r.feedbackBytes. The status
+// patch is reported as feedback/status.
+func (r *Runner) feedbackTick(seq int) {
+	manifests, _, _ := unstructured.NestedSlice(r.shared.Object, "spec", "workload", "manifests")
+
+	payload := strings.Repeat("x", r.feedbackBytes)
+
+	statuses := make([]interface{}, len(manifests))
+	for i, m := range manifests {
+		manifest, _ := m.(map[string]interface{})
+		meta, _ := manifest["metadata"].(map[string]interface{})
+
+		values := []interface{}{
+			map[string]interface{}{
+				"name":       "observedTick",
+				"fieldValue": map[string]interface{}{"type": "Integer", "integer": int64(seq)},
+			},
+		}
+
+		for v := 1; v < r.feedbackValues; v++ {
+			values = append(values, map[string]interface{}{
+				"name":       fmt.Sprintf("value-%v", v),
+				"fieldValue": map[string]interface{}{"type": "String", "string": payload},
+			})
+		}
+
+		statuses[i] = map[string]interface{}{
+			"resourceMeta": map[string]interface{}{
+				"ordinal":   int64(i),
+				"kind":      manifest["kind"],
+				"name":      meta["name"],
+				"namespace": meta["namespace"],
+			},
+			"statusFeedback": map[string]interface{}{"values": values},
+		}
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"resourceStatus": map[string]interface{}{"manifests": statuses},
+		},
+	})
+	if err != nil {
+		r.logger.Error(err, "failed to marshal the status feedback")
+		return
+	}
+
+	obj := r.template.DeepCopy()
+	if err := r.metrics.Time("feedback/status", func() error {
+		return r.Client.Status().Patch(r.context(), obj, client.RawPatch(types.MergePatchType, patch))
+	}); err != nil {
+		r.logger.Error(err, fmt.Sprintf("failed to update the status feedback of %s", r.getKey()))
+	}
+}
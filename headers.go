@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// headerList is a repeatable "Key: Value" flag.
+type headerList []header
+
+type header struct {
+	key, value string
+}
+
+func (h *headerList) String() string {
+	out := []string{}
+	for _, v := range *h {
+		out = append(out, v.key+": "+v.value)
+	}
+
+	return strings.Join(out, ", ")
+}
+
+func (h *headerList) Set(s string) error {
+	kv := strings.SplitN(s, ":", 2)
+	if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+		return fmt.Errorf("invalid header %q, expecting \"Key: Value\"", s)
+	}
+
+	*h = append(*h, header{key: strings.TrimSpace(kv[0]), value: strings.TrimSpace(kv[1])})
+
+	return nil
+}
+
+// headerRoundTripper adds extra headers to every request, e.g. impersonation
+// extras or priority hints, to experiment with flow control classification.
+type headerRoundTripper struct {
+	headers headerList
+	next    http.RoundTripper
+}
+
+func (rt *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for _, h := range rt.headers {
+		req.Header.Add(h.key, h.value)
+	}
+
+	return rt.next.RoundTrip(req)
+}
+
+func wrapHeaders(headers headerList) func(http.RoundTripper) http.RoundTripper {
+	return func(next http.RoundTripper) http.RoundTripper {
+		if len(headers) == 0 {
+			return next
+		}
+
+		return &headerRoundTripper{headers: headers, next: next}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sync/atomic"
+	"time"
+)
+
+// minStuckAfter is the shortest time without progress a runner is stuck
+// after, the short intervals would flag every slow request.
+const minStuckAfter = 30 * time.Second
+
+// heartbeat tells when a runner is stuck: it made no progress, i.e. didn't
+// finish a tick, for intervals of its tick intervals, e.g. on a hung TLS
+// handshake.
+type heartbeat struct {
+	intervals int
+	restart   bool
+	dumpDir   string
+}
+
+func (h heartbeat) enabled() bool {
+	return h.intervals > 0
+}
+
+// beat records the runner made progress.
+func (r *Runner) beat() {
+	atomic.StoreInt64(&r.lastBeat, time.Now().UnixNano())
+}
+
+func (r *Runner) sinceBeat() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&r.lastBeat)))
+}
+
+// supervise checks the heartbeats of the running runners every second, logs
+// the stuck ones along with a goroutine dump, and restarts them when asked.
+func (p *pool) supervise(h heartbeat) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				for _, idx := range p.stuck(h.intervals) {
+					p.stalled(idx, h)
+				}
+			}
+		}
+	}()
+}
+
+// stuck returns the running runners without a heartbeat for intervals of
+// their tick interval, minStuckAfter at least, and flags the stuck runners which recovered as
+// running again.
+func (p *pool) stuck(intervals int) []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := []int{}
+	for idx, r := range p.runners {
+		after := time.Duration(intervals) * r.interval
+		if after < minStuckAfter {
+			after = minStuckAfter
+		}
+
+		stuck := r.sinceBeat() > after
+
+		switch p.health[idx].status {
+		case runnerRunning:
+			if stuck {
+				out = append(out, idx)
+			}
+		case runnerStuck:
+			// it made progress again
+			if !stuck {
+				p.setStatus(idx, runnerRunning)
+			}
+		}
+	}
+
+	return out
+}
+
+func (p *pool) stalled(idx int, h heartbeat) {
+	p.mu.Lock()
+	r := p.runners[idx]
+	p.setStatus(idx, runnerStuck)
+	p.health[idx].stalls += 1
+	p.mu.Unlock()
+
+	p.logger.Error(fmt.Errorf("no progress for %v", r.sinceBeat().Truncate(time.Second)), fmt.Sprintf("runner %v is stuck", idx))
+
+	path, err := dumpGoroutines(h.dumpDir, idx)
+	if err != nil {
+		p.logger.Error(err, "failed to dump the goroutines")
+	} else {
+		p.logger.Info(fmt.Sprintf("dumped the goroutines to %s", path))
+	}
+
+	if !h.restart {
+		return
+	}
+
+	// the stuck goroutine can't be interrupted, it's killed so that it
+	// exits without clean up whenever it unblocks, and a fresh runner takes
+	// over its object. It's killed under the lock of the pool, unless the
+	// chaos killed it meanwhile, and then respawns it.
+	if !p.kill(idx) {
+		return
+	}
+
+	p.start(idx)
+
+	p.logger.Info(fmt.Sprintf("restarted stuck runner %v", idx))
+}
+
+func dumpGoroutines(dir string, idx int) (string, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("load-simulator-stuck-%v-%v.txt", idx, time.Now().Unix()))
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s, error: %w", path, err)
+	}
+
+	defer f.Close()
+
+	if err := pprof.Lookup("goroutine").WriteTo(f, 2); err != nil {
+		return "", fmt.Errorf("failed to write %s, error: %w", path, err)
+	}
+
+	return path, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// hedging sends a second copy of a read which isn't answered after `after`,
+// the first response wins and the other request is canceled, unless the
+// first one failed, the other copy is waited for then, to tell whether
+// hedging would cut the tail latency of latency sensitive controllers. Each
+// read is reported as hedge/not-sent, answered in time, hedge/won, the copy
+// answered first, or hedge/lost, the original one did, with its latency.
+type hedging struct {
+	after   time.Duration
+	metrics *Metrics
+}
+
+type hedgeResult struct {
+	resp   *http.Response
+	err    error
+	hedged bool
+	// cancel ends the request once its response is read
+	cancel context.CancelFunc
+}
+
+// cancelOnClose keeps the request of the winning response alive until its
+// body is read.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+
+	return c.ReadCloser.Close()
+}
+
+type hedgeRoundTripper struct {
+	hedging *hedging
+	next    http.RoundTripper
+}
+
+func (rt *hedgeRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	verb, _ := requestVerb(req)
+	if verb != "get" && verb != "list" {
+		return rt.next.RoundTrip(req)
+	}
+
+	start := time.Now()
+	results := make(chan hedgeResult, 2)
+
+	send := func(hedged bool) context.CancelFunc {
+		ctx, cancel := context.WithCancel(req.Context())
+
+		go func() {
+			resp, err := rt.next.RoundTrip(req.Clone(ctx))
+			results <- hedgeResult{resp: resp, err: err, hedged: hedged, cancel: cancel}
+		}()
+
+		return cancel
+	}
+
+	cancelOriginal := send(false)
+
+	timer := time.NewTimer(rt.hedging.after)
+	defer timer.Stop()
+
+	select {
+	case res := <-results:
+		rt.hedging.metrics.Observe("hedge/not-sent", time.Since(start), res.err)
+
+		return rt.hedging.won(res)
+
+	case <-timer.C:
+	}
+
+	cancelHedge := send(true)
+
+	res := <-results
+
+	// a failed copy doesn't win, the other one may still answer
+	waiting := true
+	if res.err != nil {
+		res.cancel()
+		res = <-results
+		waiting = false
+	}
+
+	op := "hedge/lost"
+	loser := cancelHedge
+	if res.hedged {
+		op = "hedge/won"
+		loser = cancelOriginal
+	}
+
+	rt.hedging.metrics.Observe(op, time.Since(start), res.err)
+
+	if !waiting {
+		return rt.hedging.won(res)
+	}
+
+	// the loser is canceled, its response discarded
+	loser()
+	go func() {
+		if l := <-results; l.resp != nil {
+			l.resp.Body.Close()
+		}
+	}()
+
+	return rt.hedging.won(res)
+}
+
+func (h *hedging) won(res hedgeResult) (*http.Response, error) {
+	if res.err != nil {
+		res.cancel()
+		return nil, res.err
+	}
+
+	res.resp.Body = &cancelOnClose{ReadCloser: res.resp.Body, cancel: res.cancel}
+
+	return res.resp, nil
+}
+
+// hedging of the runner, nil without -hedge-after.
+func (r *Runner) hedging() *hedging {
+	if r.hedgeAfter <= 0 {
+		return nil
+	}
+
+	return &hedging{after: r.hedgeAfter, metrics: r.metrics}
+}
+
+func wrapHedging(h *hedging) func(http.RoundTripper) http.RoundTripper {
+	return func(next http.RoundTripper) http.RoundTripper {
+		if h == nil {
+			return next
+		}
+
+		return &hedgeRoundTripper{hedging: h, next: next}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// hub is one of the hubs of a federated run, with its own share of the
+// clients.
+type hub struct {
+	name       string
+	kubeconfig string
+	concurrent int
+}
+
+// hubList is the repeatable -hub flag, <name>=<kubeconfig>:<concurrent>.
+type hubList []hub
+
+func (l *hubList) String() string {
+	out := []string{}
+	for _, h := range *l {
+		out = append(out, fmt.Sprintf("%s=%s:%v", h.name, h.kubeconfig, h.concurrent))
+	}
+
+	return strings.Join(out, ",")
+}
+
+func (l *hubList) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return fmt.Errorf("invalid hub %q, expecting <name>=<kubeconfig>:<concurrent>", s)
+	}
+
+	idx := strings.LastIndex(parts[1], ":")
+	if idx <= 0 {
+		return fmt.Errorf("invalid hub %q, expecting <name>=<kubeconfig>:<concurrent>", s)
+	}
+
+	n, err := strconv.Atoi(parts[1][idx+1:])
+	if err != nil || n <= 0 {
+		return fmt.Errorf("invalid concurrent of hub %q, it has to be a positive integer", s)
+	}
+
+	h := hub{name: strings.TrimSpace(parts[0]), kubeconfig: parts[1][:idx], concurrent: n}
+	for _, o := range *l {
+		if o.name == h.name {
+			return fmt.Errorf("hub %s is given twice", h.name)
+		}
+	}
+
+	*l = append(*l, h)
+
+	return nil
+}
+
+func (l hubList) concurrent() int {
+	total := 0
+	for _, h := range l {
+		total += h.concurrent
+	}
+
+	return total
+}
+
+// hubFor returns the hub of runner idx, the hubs take the runners in order.
+func hubFor(l hubList, idx int) hub {
+	for _, h := range l {
+		if idx < h.concurrent {
+			return h
+		}
+
+		idx -= h.concurrent
+	}
+
+	return l[len(l)-1]
+}
+
+func (l hubList) names() []string {
+	out := []string{}
+	for _, h := range l {
+		out = append(out, h.name)
+	}
+
+	return out
+}
+
+// cluster is a cluster the clients of a run write to, a hub of a federated
+// run, or the cluster of -kubeconfig.
+type cluster struct {
+	// hub is empty for the cluster of -kubeconfig
+	hub    string
+	config *restclient.Config
+}
+
+// clusters are the hubs of a federated run, or the cluster of config, the
+// checks and the clean up of the run go through each of them.
+func (o *options) clusters(config *restclient.Config) ([]cluster, error) {
+	if len(o.hubs) == 0 {
+		return []cluster{{config: config}}, nil
+	}
+
+	out := []cluster{}
+	for _, h := range o.hubs {
+		hubConfig, err := clientcmd.BuildConfigFromFlags("", h.kubeconfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load rest.Config of hub %s, error: %w", h.name, err)
+		}
+
+		out = append(out, cluster{hub: h.name, config: hubConfig})
+	}
+
+	return out, nil
+}
+
+func (c cluster) logger(logger logr.Logger) logr.Logger {
+	if c.hub == "" {
+		return logger
+	}
+
+	return logger.WithValues("hub", c.hub)
+}
+
+// compareScopes logs the operations of the scopes, e.g. the hubs or the
+// tenants, side by side.
+func compareScopes(logger logr.Logger, m *Metrics, scopes []string) {
+	byOp := map[string]map[string]Summary{}
+	for _, s := range m.Summary() {
+		parts := strings.SplitN(s.Op, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		if byOp[parts[1]] == nil {
+			byOp[parts[1]] = map[string]Summary{}
+		}
+
+		byOp[parts[1]][parts[0]] = s
+	}
+
+	ops := []string{}
+	for op := range byOp {
+		ops = append(ops, op)
+	}
+
+	sort.Strings(ops)
+
+	for _, op := range ops {
+		out := []string{}
+		for _, scope := range scopes {
+			s, ok := byOp[op][scope]
+			if !ok {
+				continue
+			}
+
+			out = append(out, fmt.Sprintf("%s count=%v errors=%v p50=%v p99=%v", scope, s.Count, s.Errors, s.P50, s.P99))
+		}
+
+		logger.Info(fmt.Sprintf("%s: %s", op, strings.Join(out, " | ")))
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	restclient "k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// startCache starts a controller-runtime cache shared by all the runners,
+// until stop is closed. Like a controller, the runners read from the cache,
+// which lists and watches each kind they read, and write to the apiserver.
+func startCache(config *restclient.Config, stop <-chan struct{}, wg *sync.WaitGroup) (cache.Cache, error) {
+	c, err := cache.New(config, cache.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache, error: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer cancel()
+
+		<-stop
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		c.Start(ctx)
+	}()
+
+	return c, nil
+}
+
+// withCaches hands each runner the cache of its hub, see hubFor, or the one
+// of the cluster without hubs.
+func withCaches(allocate func(idx int) []Option, hubs hubList, caches map[string]cache.Cache) func(idx int) []Option {
+	return func(idx int) []Option {
+		name := ""
+		if len(hubs) != 0 {
+			name = hubFor(hubs, idx).name
+		}
+
+		return append(allocate(idx), WithCache(caches[name]))
+	}
+}
+
+// cachedClient reads from c and writes with cl.
+func cachedClient(c cache.Cache, cl client.Client) (client.Client, error) {
+	return client.NewDelegatingClient(client.NewDelegatingClientInput{
+		CacheReader:       c,
+		Client:            cl,
+		CacheUnstructured: true,
+	})
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// waitJitter delays the start of the runner by a random duration up to
+// r.startJitter, so the tickers of the runners started at once don't tick in
+// lockstep. It returns false if the runner is stopped meanwhile.
+func (r *Runner) waitJitter() bool {
+	if r.startJitter <= 0 {
+		return true
+	}
+
+	d := time.Duration(r.random().Int63n(int64(r.startJitter)))
+
+	// a waiting runner isn't stuck, see heartbeat
+	atomic.StoreInt64(&r.lastBeat, time.Now().Add(d).UnixNano())
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-r.stop:
+	case <-r.killCh:
+	case <-r.quitCh:
+	}
+
+	return false
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	skewNone = "none"
+	skewHot  = "hot"
+	skewZipf = "zipf"
+)
+
+func validateKeySkew(s string) error {
+	switch s {
+	case skewNone, skewHot, skewZipf:
+		return nil
+	}
+
+	return fmt.Errorf("unknown key skew %q, expecting %s|%s|%s", s, skewNone, skewHot, skewZipf)
+}
+
+// keyspace holds the live object of every runner, indexed by the runner
+// index, so runners can target each other's objects.
+type keyspace struct {
+	mu   sync.RWMutex
+	keys map[int]types.NamespacedName
+}
+
+func newKeyspace() *keyspace {
+	return &keyspace{keys: map[int]types.NamespacedName{}}
+}
+
+func (k *keyspace) set(idx int, key types.NamespacedName) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys[idx] = key
+}
+
+func (k *keyspace) remove(idx int) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	delete(k.keys, idx)
+}
+
+func (k *keyspace) get(idx int) (types.NamespacedName, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[idx]
+
+	return key, ok
+}
+
+// keySkew decides which object a GET/PATCH targets.
+type keySkew struct {
+	kind string
+	// number of hot objects, owned by the first runners of the keyspace
+	hotKeys int
+	// share of the traffic going to the hot objects
+	hotFraction float64
+	// zipf exponent, has to be > 1
+	zipfS float64
+	// index of the first runner of the keyspace, the runners of a template
+	// take a contiguous range of indexes
+	offset int
+	// number of runners of the keyspace, the zipf distribution spans all of
+	// them
+	runners int
+}
+
+// pickTarget returns the object the runner's next GET/PATCH goes to, and
+// whether it's some other runner's object. With the hot skew, a fraction of
+// the traffic goes to one of the hot objects; with the zipf skew, the object
+// of runner i is picked with a probability decreasing with i.
+func (r *Runner) pickTarget() (types.NamespacedName, bool) {
+	own := r.getKey()
+
+	if r.keys == nil || r.skew.kind == skewNone || r.skew.kind == "" {
+		return own, false
+	}
+
+	idx := r.index
+
+	switch r.skew.kind {
+	case skewHot:
+		hot := r.skew.hotKeys
+		if hot > r.skew.runners {
+			hot = r.skew.runners
+		}
+
+		if hot > 0 && r.random().Float64() < r.skew.hotFraction {
+			idx = r.skew.offset + r.random().Intn(hot)
+		}
+
+	case skewZipf:
+		if r.zipf == nil && r.skew.runners > 1 {
+			r.zipf = rand.NewZipf(r.random(), r.skew.zipfS, 1, uint64(r.skew.runners-1))
+		}
+
+		if r.zipf != nil {
+			idx = r.skew.offset + int(r.zipf.Uint64())
+		}
+	}
+
+	if idx == r.index {
+		return own, false
+	}
+
+	key, ok := r.keys.get(idx)
+	if !ok {
+		return own, false
+	}
+
+	return key, true
+}
+
+// random returns the runner's own source, math/rand's global one is behind a
+// mutex shared by all the runners.
+func (r *Runner) random() *rand.Rand {
+	if r.rand == nil {
+		r.rand = rand.New(rand.NewSource(time.Now().UnixNano() + int64(r.index)))
+	}
+
+	return r.rand
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// keyValues is a repeatable "key=value" flag, e.g. labels or annotations.
+type keyValues map[string]string
+
+func (kv *keyValues) String() string {
+	out := []string{}
+	for k, v := range *kv {
+		out = append(out, k+"="+v)
+	}
+
+	sort.Strings(out)
+
+	return strings.Join(out, ",")
+}
+
+func (kv *keyValues) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return fmt.Errorf("invalid %q, expecting key=value", s)
+	}
+
+	if *kv == nil {
+		*kv = keyValues{}
+	}
+
+	(*kv)[strings.TrimSpace(parts[0])] = parts[1]
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	namespacePerObject = "per-object"
+	namespaceShared    = "shared"
+)
+
+func validateNamespaceLayout(s string) error {
+	switch s {
+	case namespacePerObject, namespaceShared:
+		return nil
+	}
+
+	return fmt.Errorf("unknown namespace layout %q, expecting %s|%s", s, namespacePerObject, namespaceShared)
+}
+
+// createNamespace creates the namespace ns if missing, unless the namespaces
+// were created out-of-band, e.g. with quotas or NetworkPolicies, or before the
+// load, see -precreate-namespaces.
+func (r *Runner) createNamespace(ctx context.Context, ns string) error {
+	if r.reuseNamespaces || r.precreatedNamespaces {
+		return nil
+	}
+
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        ns,
+			Labels:      r.labels(copyMap(r.namespaceLabels)),
+			Annotations: copyMap(r.namespaceAnnotations),
+		},
+	}
+
+	if err := r.Client.Create(ctx, namespace); err != nil {
+		if !k8serrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create namespace %s, error: %w", ns, err)
+		}
+	}
+
+	return nil
+}
+
+// labels adds the run label to l.
+func (r *Runner) labels(l map[string]string) map[string]string {
+	if r.runID == "" {
+		return l
+	}
+
+	if l == nil {
+		l = map[string]string{}
+	}
+
+	l[runLabel] = r.runID
+
+	return l
+}
+
+// copyMap keeps the response decoded into an object from writing to a map
+// shared by the runners.
+func copyMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+
+	return out
+}
+
+// compareMetrics logs how the operations of run b differ from run a.
+func compareMetrics(logger logr.Logger, aName string, a *Metrics, bName string, b *Metrics) {
+	base := map[string]Summary{}
+	for _, s := range a.Summary() {
+		base[s.Op] = s
+	}
+
+	for _, s := range b.Summary() {
+		o, ok := base[s.Op]
+		if !ok {
+			continue
+		}
+
+		logger.Info(fmt.Sprintf("%s %s vs %s: count %v vs %v, mean %v vs %v (%s), p99 %v vs %v (%s)",
+			s.Op, aName, bName, o.Count, s.Count, o.Mean, s.Mean, delta(o.Mean.Seconds(), s.Mean.Seconds()),
+			o.P99, s.P99, delta(o.P99.Seconds(), s.P99.Seconds())))
+	}
+}
+
+func delta(a, b float64) string {
+	if a == 0 {
+		return "n/a"
+	}
+
+	return fmt.Sprintf("%+.1f%%", (b-a)/a*100)
+}
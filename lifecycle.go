@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	lifecycleCreate = "create"
+	lifecycleWait   = "wait"
+	lifecyclePatch  = "patch"
+	lifecycleDelete = "delete"
+)
+
+// lifecycleStep is a step of the lifecycle of the objects of the lifecycle
+// mode.
+type lifecycleStep struct {
+	verb string
+	// wait is the expression a wait step waits to hold
+	wait *waitExpr
+	// count is the number of patches of a patch step
+	count int
+}
+
+func (s lifecycleStep) op() string {
+	if s.verb == lifecycleWait {
+		return "lifecycle/wait/" + s.wait.String()
+	}
+
+	return "lifecycle/" + s.verb
+}
+
+// parseLifecycle parses the comma separated steps, e.g.
+// "create,wait=Applied,patch=3,delete". The lifecycle starts with create and
+// ends with delete, in between are any number of wait and patch=<count>
+// steps. A wait step waits for a status condition type to be True, or for a
+// JSONPath expression starting with . or { to hold, see parseWaitExpr.
+func parseLifecycle(s string) ([]lifecycleStep, error) {
+	out := []lifecycleStep{}
+
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		kv := strings.SplitN(item, "=", 2)
+		step := lifecycleStep{verb: kv[0]}
+
+		switch {
+		case (step.verb == lifecycleCreate || step.verb == lifecycleDelete) && len(kv) == 1:
+		case step.verb == lifecycleWait && len(kv) == 2 && kv[1] != "":
+			if !strings.HasPrefix(kv[1], ".") && !strings.HasPrefix(kv[1], "{") {
+				step.wait = conditionExpr(kv[1])
+				break
+			}
+
+			w, err := parseWaitExpr(kv[1])
+			if err != nil {
+				return nil, err
+			}
+
+			step.wait = w
+		case step.verb == lifecyclePatch && len(kv) == 2:
+			n, err := strconv.Atoi(kv[1])
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid lifecycle step %q, the count of the patches has to be at least 1", item)
+			}
+
+			step.count = n
+		default:
+			return nil, fmt.Errorf("invalid lifecycle step %q, expecting %s|%s=<condition type or JSONPath expression>|%s=<count>|%s", item, lifecycleCreate, lifecycleWait, lifecyclePatch, lifecycleDelete)
+		}
+
+		out = append(out, step)
+	}
+
+	if len(out) < 2 || out[0].verb != lifecycleCreate || out[len(out)-1].verb != lifecycleDelete {
+		return nil, fmt.Errorf("the lifecycle %q has to start with %s and end with %s", s, lifecycleCreate, lifecycleDelete)
+	}
+
+	for _, step := range out[1 : len(out)-1] {
+		if step.verb == lifecycleCreate || step.verb == lifecycleDelete {
+			return nil, fmt.Errorf("the lifecycle %q creates and deletes the object only once", s)
+		}
+	}
+
+	return out, nil
+}
+
+// lifecycleSetup creates the namespace, the objects are created by the ticks.
+func (r *Runner) lifecycleSetup() error {
+	if ns := r.template.GetNamespace(); ns != "" {
+		return r.createNamespace(r.context(), ns)
+	}
+
+	return nil
+}
+
+// lifecycleTick takes a new object of the runner through r.lifecycle, each
+// step being reported as lifecycle/<verb>, lifecycle/wait/<condition type or
+// expression> for the waits, and the whole lifecycle as lifecycle/total.
+// Once a step fails, the object is deleted and lifecycle/total reports the
+// error.
+func (r *Runner) lifecycleTick(seq int) {
+	ctx := r.context()
+
+	obj := r.object()
+	obj.SetName(fmt.Sprintf("%s-l%v", r.template.GetName(), seq))
+
+	start := time.Now()
+	created := false
+
+	var failed error
+	for _, step := range r.lifecycle {
+		if failed != nil && (!created || step.verb != lifecycleDelete) {
+			continue
+		}
+
+		stepStart := time.Now()
+		err := r.lifecycleStep(ctx, obj, step, seq)
+		r.metrics.Observe(step.op(), time.Since(stepStart), err)
+
+		if err != nil {
+			r.logger.Error(err, fmt.Sprintf("lifecycle step %s of %s failed", step.verb, obj.GetName()))
+
+			if failed == nil {
+				failed = err
+			}
+
+			continue
+		}
+
+		switch step.verb {
+		case lifecycleCreate:
+			created = true
+			r.lifecycleObject = obj
+		case lifecycleDelete:
+			r.lifecycleObject = nil
+		}
+	}
+
+	r.metrics.Observe("lifecycle/total", time.Since(start), failed)
+}
+
+func (r *Runner) lifecycleStep(ctx context.Context, obj *unstructured.Unstructured, step lifecycleStep, seq int) error {
+	switch step.verb {
+	case lifecycleCreate:
+		if !r.limits.reserveObject() {
+			return errLimitReached
+		}
+
+		if err := r.Client.Create(ctx, obj); err != nil {
+			r.limits.releaseObject()
+			return err
+		}
+
+		r.limits.commitObject()
+		r.state.add(obj)
+
+	case lifecycleWait:
+		return r.poll(ctx, obj, step.wait)
+
+	case lifecyclePatch:
+		for i := 0; i < step.count; i++ {
+			patch, err := labelPatch(pickPatchType(r.patchType, seq+i), obj, "hello", fmt.Sprintf("world-%v", i), nil)
+			if err != nil {
+				return err
+			}
+
+			if err := r.Client.Patch(ctx, obj, patch); err != nil {
+				return err
+			}
+		}
+
+	case lifecycleDelete:
+		start := time.Now()
+		if err := r.Client.Delete(ctx, obj); err != nil {
+			if !k8serrors.IsNotFound(err) || !r.swallowed("lifecycle/delete", client.ObjectKeyFromObject(obj).String(), err, time.Since(start), r.onNotFound) {
+				return err
+			}
+		}
+
+		r.state.remove(obj)
+	}
+
+	return nil
+}
+
+// lifecycleTeardown deletes the object the run stopped in the middle of the
+// lifecycle of, then the namespace.
+func (r *Runner) lifecycleTeardown() {
+	if obj := r.lifecycleObject; obj != nil && !r.fastClean {
+		if err := r.Client.Delete(r.context(), obj); err != nil && !k8serrors.IsNotFound(err) {
+			r.logger.Error(err, fmt.Sprintf("failed to delete %s", obj.GetName()))
+		} else {
+			r.state.remove(obj)
+		}
+	}
+
+	r.delete()
+}
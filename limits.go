@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+var errLimitReached = errors.New("limit of the run reached")
+
+// limits are hard caps stopping a run once reached, whatever its duration.
+// They're a second safety net, and allow to create exactly N objects.
+type limits struct {
+	maxObjects  int64
+	maxRequests int64
+
+	// objects counts the reserved objects, including the ones being created.
+	objects  int64
+	created  int64
+	requests int64
+	// lifted is set once the run stops, so the clean up isn't capped.
+	lifted int32
+
+	reached chan struct{}
+	once    sync.Once
+	reason  string
+}
+
+// newLimits returns the limits of a run, 0 means no limit.
+func newLimits(maxObjects, maxRequests int) *limits {
+	return &limits{
+		maxObjects:  int64(maxObjects),
+		maxRequests: int64(maxRequests),
+		reached:     make(chan struct{}),
+	}
+}
+
+func (l *limits) trip(reason string) {
+	l.once.Do(func() {
+		l.reason = reason
+		close(l.reached)
+	})
+}
+
+// done is closed once a limit is reached.
+func (l *limits) done() <-chan struct{} {
+	if l == nil {
+		return nil
+	}
+
+	return l.reached
+}
+
+// lift stops enforcing the limits, it's called before the runners clean up.
+func (l *limits) lift() {
+	if l != nil {
+		atomic.StoreInt32(&l.lifted, 1)
+	}
+}
+
+func (l *limits) enforced() bool {
+	return l != nil && atomic.LoadInt32(&l.lifted) == 0
+}
+
+// reserveObject has to be called before creating an object, it returns false
+// if the object would be over -max-objects. The reservation is either
+// committed or released once the create is done.
+func (l *limits) reserveObject() bool {
+	if !l.enforced() || l.maxObjects == 0 {
+		return true
+	}
+
+	if atomic.AddInt64(&l.objects, 1) > l.maxObjects {
+		atomic.AddInt64(&l.objects, -1)
+		return false
+	}
+
+	return true
+}
+
+func (l *limits) commitObject() {
+	if !l.enforced() || l.maxObjects == 0 {
+		return
+	}
+
+	if atomic.AddInt64(&l.created, 1) == l.maxObjects {
+		l.trip(fmt.Sprintf("max-objects %v reached", l.maxObjects))
+	}
+}
+
+func (l *limits) releaseObject() {
+	if l == nil || l.maxObjects == 0 {
+		return
+	}
+
+	atomic.AddInt64(&l.objects, -1)
+}
+
+// limitRoundTripper counts the requests of the run and refuses the ones over
+// -max-total-requests.
+type limitRoundTripper struct {
+	limits *limits
+	next   http.RoundTripper
+}
+
+func (rt *limitRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	l := rt.limits
+	if l.enforced() {
+		n := atomic.AddInt64(&l.requests, 1)
+		if n > l.maxRequests {
+			return nil, errLimitReached
+		}
+
+		if n == l.maxRequests {
+			l.trip(fmt.Sprintf("max-total-requests %v reached", l.maxRequests))
+		}
+	}
+
+	return rt.next.RoundTrip(req)
+}
+
+func wrapLimits(l *limits) func(http.RoundTripper) http.RoundTripper {
+	return func(next http.RoundTripper) http.RoundTripper {
+		if l == nil || l.maxRequests == 0 {
+			return next
+		}
+
+		return &limitRoundTripper{limits: l, next: next}
+	}
+}
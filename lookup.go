@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	restclient "k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// lookupPattern is a template field populated from the cluster, e.g.
+// {{ lookup "ManagedCluster" }}, or with the group of the kind and a label
+// selector {{ lookup "ManagedCluster.cluster.open-cluster-management.io" "env=dev" }}.
+var lookupPattern = regexp.MustCompile(`^\{\{\s*lookup\s+"([^"]+)"(?:\s+"([^"]*)")?\s*\}\}$`)
+
+// lookup is a field of a template set to the name of an existing object of
+// kind, each runner gets the next object, in the order of the names.
+type lookup struct {
+	path     []string
+	kind     string
+	group    string
+	selector string
+	// names are resolved once the cluster is known, see resolveLookups
+	names []string
+}
+
+func (l lookup) String() string {
+	if l.group != "" {
+		return l.kind + "." + l.group
+	}
+
+	return l.kind
+}
+
+// findLookups returns the lookups of the fields of obj, nested maps only.
+func findLookups(obj map[string]interface{}, path []string) []lookup {
+	out := []lookup{}
+
+	for k, v := range obj {
+		p := append(append([]string{}, path...), k)
+
+		switch v := v.(type) {
+		case map[string]interface{}:
+			out = append(out, findLookups(v, p)...)
+		case string:
+			m := lookupPattern.FindStringSubmatch(v)
+			if m == nil {
+				continue
+			}
+
+			l := lookup{path: p, kind: m[1], selector: m[2]}
+			if i := strings.Index(m[1], "."); i != -1 {
+				l.kind, l.group = m[1][:i], m[1][i+1:]
+			}
+
+			out = append(out, l)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return strings.Join(out[i].path, ".") < strings.Join(out[j].path, ".")
+	})
+
+	return out
+}
+
+// resolveLookups lists the objects of the lookups of the templates, a lookup
+// matching no object fails the run.
+func (o *options) resolveLookups(ctx context.Context, config *restclient.Config, logger logr.Logger) error {
+	var dc discovery.DiscoveryInterface
+	var cl client.Client
+
+	for i := range o.templates {
+		t := &o.templates[i]
+
+		for j := range t.lookups {
+			l := &t.lookups[j]
+
+			if dc == nil {
+				var err error
+				if dc, err = discovery.NewDiscoveryClientForConfig(config); err != nil {
+					return fmt.Errorf("failed to create discovery client, error: %w", err)
+				}
+
+				if cl, err = client.New(config, client.Options{}); err != nil {
+					return fmt.Errorf("failed to create client, error: %w", err)
+				}
+			}
+
+			gvk, err := lookupKind(dc, l.kind, l.group)
+			if err != nil {
+				return err
+			}
+
+			selector, err := labels.Parse(l.selector)
+			if err != nil {
+				return fmt.Errorf("invalid selector %q of the lookup of %s, error: %w", l.selector, l, err)
+			}
+
+			list := &unstructured.UnstructuredList{}
+			list.SetGroupVersionKind(gvk)
+
+			if err := cl.List(ctx, list, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+				return fmt.Errorf("failed to list %s for the lookup of template %s, error: %w", l, t.path, err)
+			}
+
+			l.names = []string{}
+			for _, item := range list.Items {
+				l.names = append(l.names, item.GetName())
+			}
+
+			if len(l.names) == 0 {
+				return fmt.Errorf("the lookup of %s of template %s matches no object", l, t.path)
+			}
+
+			sort.Strings(l.names)
+
+			logger.Info(fmt.Sprintf("%s of template %s is looked up from %v %s", strings.Join(l.path, "."), t.path, len(l.names), l))
+		}
+	}
+
+	return nil
+}
+
+// lookupKind finds the preferred version of kind, in group when set.
+func lookupKind(dc discovery.DiscoveryInterface, kind, group string) (schema.GroupVersionKind, error) {
+	lists, err := dc.ServerPreferredResources()
+	if err != nil && len(lists) == 0 {
+		return schema.GroupVersionKind{}, fmt.Errorf("failed to discover the resources, error: %w", err)
+	}
+
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil || (group != "" && gv.Group != group) {
+			continue
+		}
+
+		for _, res := range list.APIResources {
+			if res.Kind == kind && !strings.Contains(res.Name, "/") {
+				return gv.WithKind(kind), nil
+			}
+		}
+	}
+
+	return schema.GroupVersionKind{}, fmt.Errorf("kind %s isn't served", kind)
+}
+
+// resolved tells whether the lookups of the template are resolved.
+func (t weightedTemplate) resolved() bool {
+	for _, l := range t.lookups {
+		if l.names == nil {
+			return false
+		}
+	}
+
+	return len(t.lookups) != 0
+}
+
+// lookupValues are the names the lookups of the template are set to for the
+// runner idx.
+func (t weightedTemplate) lookupValues(idx int) []string {
+	values := []string{}
+	for _, l := range t.lookups {
+		values = append(values, l.names[idx%len(l.names)])
+	}
+
+	return values
+}
+
+// lookedUp is a copy of w with the lookups of the template set to values.
+func (t weightedTemplate) lookedUp(w *unstructured.Unstructured, values []string) *unstructured.Unstructured {
+	out := w.DeepCopy()
+	for i, l := range t.lookups {
+		_ = unstructured.SetNestedField(out.Object, values[i], l.path...)
+	}
+
+	return out
+}
+
+// namespaceLookedUp tells whether the namespace of the template is looked up,
+// the runners then use existing namespaces.
+func (t weightedTemplate) namespaceLookedUp() bool {
+	for _, l := range t.lookups {
+		if strings.Join(l.path, ".") == "metadata.namespace" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/go-logr/logr"
+	flowcontrolv1beta1 "k8s.io/api/flowcontrol/v1beta1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// lowPriorityIdentity is the identity of -low-priority, impersonating
+	// the load-simulator-low-priority user
+	lowPriorityIdentity = "low-priority"
+	// lowPriorityGroup is what the FlowSchema of the flowschema command
+	// matches
+	lowPriorityGroup = "load-simulator:low-priority"
+	lowPriorityName  = "load-simulator-low-priority"
+
+	flowSchemaInstall   = "install"
+	flowSchemaUninstall = "uninstall"
+)
+
+// apfObjects are a FlowSchema matching the requests of a group, and the
+// priority level it sends them to, both named name.
+type apfObjects struct {
+	name        string
+	group       string
+	shares      int32
+	precedence  int32
+	queues      int32
+	handSize    int32
+	queueLength int32
+}
+
+// priorityLevel queues the requests over its concurrency limit, or rejects
+// them without queues.
+func (a apfObjects) priorityLevel() *flowcontrolv1beta1.PriorityLevelConfiguration {
+	limit := flowcontrolv1beta1.LimitResponse{Type: flowcontrolv1beta1.LimitResponseTypeReject}
+	if a.queues > 0 {
+		limit = flowcontrolv1beta1.LimitResponse{
+			Type: flowcontrolv1beta1.LimitResponseTypeQueue,
+			Queuing: &flowcontrolv1beta1.QueuingConfiguration{
+				Queues:           a.queues,
+				HandSize:         a.handSize,
+				QueueLengthLimit: a.queueLength,
+			},
+		}
+	}
+
+	return &flowcontrolv1beta1.PriorityLevelConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: a.name},
+		Spec: flowcontrolv1beta1.PriorityLevelConfigurationSpec{
+			Type: flowcontrolv1beta1.PriorityLevelEnablementLimited,
+			Limited: &flowcontrolv1beta1.LimitedPriorityLevelConfiguration{
+				AssuredConcurrencyShares: a.shares,
+				LimitResponse:            limit,
+			},
+		},
+	}
+}
+
+func (a apfObjects) flowSchema() *flowcontrolv1beta1.FlowSchema {
+	return &flowcontrolv1beta1.FlowSchema{
+		ObjectMeta: metav1.ObjectMeta{Name: a.name},
+		Spec: flowcontrolv1beta1.FlowSchemaSpec{
+			PriorityLevelConfiguration: flowcontrolv1beta1.PriorityLevelConfigurationReference{Name: a.name},
+			MatchingPrecedence:         a.precedence,
+			DistinguisherMethod:        &flowcontrolv1beta1.FlowDistinguisherMethod{Type: flowcontrolv1beta1.FlowDistinguisherMethodByUserType},
+			Rules: []flowcontrolv1beta1.PolicyRulesWithSubjects{
+				{
+					Subjects: []flowcontrolv1beta1.Subject{
+						{Kind: flowcontrolv1beta1.SubjectKindGroup, Group: &flowcontrolv1beta1.GroupSubject{Name: a.group}},
+					},
+					ResourceRules: []flowcontrolv1beta1.ResourcePolicyRule{
+						{
+							Verbs:        []string{flowcontrolv1beta1.VerbAll},
+							APIGroups:    []string{flowcontrolv1beta1.APIGroupAll},
+							Resources:    []string{flowcontrolv1beta1.ResourceAll},
+							ClusterScope: true,
+							Namespaces:   []string{flowcontrolv1beta1.NamespaceEvery},
+						},
+					},
+					NonResourceRules: []flowcontrolv1beta1.NonResourcePolicyRule{
+						{
+							Verbs:           []string{flowcontrolv1beta1.VerbAll},
+							NonResourceURLs: []string{flowcontrolv1beta1.NonResourceAll},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// install creates the priority level and then the FlowSchema, or updates
+// them to a's spec when they're already there.
+func (a apfObjects) install(ctx context.Context, cl client.Client) error {
+	pl := a.priorityLevel()
+	if err := createOrUpdate(ctx, cl, pl, &flowcontrolv1beta1.PriorityLevelConfiguration{}, func(current client.Object) {
+		current.(*flowcontrolv1beta1.PriorityLevelConfiguration).Spec = pl.Spec
+	}); err != nil {
+		return fmt.Errorf("failed to install PriorityLevelConfiguration %s, error: %w", a.name, err)
+	}
+
+	fs := a.flowSchema()
+	if err := createOrUpdate(ctx, cl, fs, &flowcontrolv1beta1.FlowSchema{}, func(current client.Object) {
+		current.(*flowcontrolv1beta1.FlowSchema).Spec = fs.Spec
+	}); err != nil {
+		return fmt.Errorf("failed to install FlowSchema %s, error: %w", a.name, err)
+	}
+
+	return nil
+}
+
+// uninstall deletes the FlowSchema and then the priority level, the missing
+// ones are skipped.
+func (a apfObjects) uninstall(ctx context.Context, cl client.Client) error {
+	if err := cl.Delete(ctx, a.flowSchema()); err != nil && !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete FlowSchema %s, error: %w", a.name, err)
+	}
+
+	if err := cl.Delete(ctx, a.priorityLevel()); err != nil && !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete PriorityLevelConfiguration %s, error: %w", a.name, err)
+	}
+
+	return nil
+}
+
+// createOrUpdate creates obj, or sets the spec of obj on the object in the
+// cluster, read into current.
+func createOrUpdate(ctx context.Context, cl client.Client, obj, current client.Object, setSpec func(client.Object)) error {
+	err := cl.Create(ctx, obj)
+	if err == nil || !k8serrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	if err := cl.Get(ctx, client.ObjectKeyFromObject(obj), current); err != nil {
+		return err
+	}
+
+	setSpec(current)
+
+	return cl.Update(ctx, current)
+}
+
+// flowSchemaCommand installs, or uninstalls, the FlowSchema and the priority
+// level -low-priority runs are classified into, so background load tests
+// don't starve the workloads sharing the cluster.
+func flowSchemaCommand(args []string, logger logr.Logger) error {
+	if len(args) == 0 || (args[0] != flowSchemaInstall && args[0] != flowSchemaUninstall) {
+		return fmt.Errorf("expecting flowschema %s|%s", flowSchemaInstall, flowSchemaUninstall)
+	}
+
+	fs := flag.NewFlagSet("flowschema "+args[0], flag.ContinueOnError)
+
+	kubeconfig := fs.String("kubeconfig", os.Getenv("KUBECONFIG"), "absolute path to the kubeconfig file, its user needs to manage the flowcontrol objects")
+	shares := fs.Int("shares", 5, "assured concurrency shares of the priority level, the global-default priority level has 20")
+	precedence := fs.Int("precedence", 8000, "matching precedence of the FlowSchema, it has to be under the one of the FlowSchemas matching the same requests, global-default is 9900")
+	newGuard := guardFlags(fs)
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	guard, err := newGuard()
+	if err != nil {
+		return err
+	}
+
+	if *shares < 1 || *precedence < 1 || *precedence > 10000 {
+		return fmt.Errorf("shares has to be at least 1 and precedence between 1 and 10000")
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to load rest.Config, error: %w", err)
+	}
+
+	if err := guard.check(*kubeconfig, config.Host); err != nil {
+		return err
+	}
+
+	cl, err := client.New(config, client.Options{})
+	if err != nil {
+		return fmt.Errorf("failed to create client, error: %w", err)
+	}
+
+	a := apfObjects{
+		name:        lowPriorityName,
+		group:       lowPriorityGroup,
+		shares:      int32(*shares),
+		precedence:  int32(*precedence),
+		queues:      16,
+		handSize:    4,
+		queueLength: 50,
+	}
+
+	if args[0] == flowSchemaUninstall {
+		if err := a.uninstall(context.TODO(), cl); err != nil {
+			return err
+		}
+
+		logger.Info(fmt.Sprintf("uninstalled FlowSchema and PriorityLevelConfiguration %s", a.name))
+
+		return nil
+	}
+
+	if err := a.install(context.TODO(), cl); err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("installed FlowSchema %s matching group %s, with precedence %v, and PriorityLevelConfiguration %s with %v shares", a.name, a.group, a.precedence, a.name, a.shares))
+
+	return nil
+}
@@ -2,16 +2,18 @@ package main
 
 import (
 	"context"
-	"flag"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"math/rand"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"text/template"
 	"time"
 
-	"github.com/ghodss/yaml"
 	"github.com/go-logr/logr"
 	"github.com/go-logr/zapr"
 	uzap "go.uber.org/zap"
@@ -21,9 +23,14 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/transport"
+	"k8s.io/client-go/util/flowcontrol"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
@@ -34,6 +41,9 @@ import (
 var (
 	s        = runtime.NewScheme()
 	loggName = "load-simlulator"
+
+	// how long the runners get to return once their requests are canceled
+	shutdownGrace = 5 * time.Second
 )
 
 func init() {
@@ -46,147 +56,1292 @@ func init() {
 }
 
 func main() {
-	kubeconfig := flag.String("kubeconfig", os.Getenv("KUBECONFIG"), "absolute path to the kubeconfig file")
-	concurentNum := flag.Int("concurrent", 10, "number of concurrent clients")
-	duration := flag.Int("duration", 10, "duration for running this test, in second")
-	interval := flag.Int("interval", 5, "wait interval between each update/create, in milliseconds, default is 5")
-	clean := flag.Bool("clean", false, "only do clean up operation")
-	pprof := flag.Bool("pprof", false, "enable pprof or not")
-	update := flag.Bool("update", true, "do continous update after creation")
-	tmeplate := flag.String("template", "./testdata/manifestwork-template.yaml", "path to the template file, default is ./testdata/manifestwork-template.yaml")
+	logger := log.Log.WithName(loggName)
 
-	flag.Parse()
+	args := os.Args[1:]
+	if len(args) != 0 {
+		if cmd, ok := commands[args[0]]; ok {
+			if err := cmd.run(args[1:], logger); err != nil {
+				logger.Error(err, fmt.Sprintf("%s failed", args[0]))
+				os.Exit(1)
+			}
 
-	logger := log.Log.WithName(loggName)
+			return
+		}
+	}
+
+	o, err := parseOptions("load-simulator", args)
+	if err != nil {
+		logger.Error(err, "invalid flag")
+		os.Exit(1)
+	}
+
+	if o.logDedup > 0 {
+		l := newDedupLogger(logger, time.Duration(o.logDedup)*time.Second)
+		defer l.close()
+
+		logger = l
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", o.kubeconfig)
+	if err != nil {
+		logger.Error(err, "failed to load rest.Config")
+		os.Exit(1)
+	}
+
+	var reqLog *requestLog
+	if o.requestLogPath != "" && !o.clean {
+		if reqLog, err = openRequestLog(o.requestLogPath, time.Duration(o.requestLogSlower)*time.Millisecond, logger); err != nil {
+			logger.Error(err, "failed to open the request log")
+			os.Exit(1)
+		}
+	}
+
+	closeRequestLog := func() {
+		if reqLog == nil {
+			return
+		}
+
+		if err := reqLog.close(); err != nil {
+			logger.Error(err, "failed to write the request log")
+		}
+	}
+
+	defer closeRequestLog()
+
+	// os.Exit skips the deferred calls, the request log is flushed first
+	exit := func(code int) {
+		closeRequestLog()
+		os.Exit(code)
+	}
+
+	if err := o.guard.check(o.kubeconfig, config.Host); err != nil {
+		logger.Error(err, "refusing to run")
+		exit(1)
+	}
+
+	clusters, err := o.clusters(config)
+	if err != nil {
+		logger.Error(err, "failed to load the hubs")
+		exit(1)
+	}
+
+	for i, h := range o.hubs {
+		if err := o.guard.check(h.kubeconfig, clusters[i].config.Host); err != nil {
+			logger.Error(err, fmt.Sprintf("refusing to run against hub %s", h.name))
+			exit(1)
+		}
+	}
+
+	if err := o.loadTemplates(); err != nil {
+		logger.Error(err, "invalid template")
+		exit(1)
+	}
+
+	if err := o.resolveLookups(context.TODO(), config, logger); err != nil {
+		logger.Error(err, "failed to look up the template fields")
+		exit(1)
+	}
+
+	debug := &debugServer{addr: o.pprofAddr, token: o.pprofToken, metrics: o.pprofMetrics, tags: o.tags}
+	var spokeCluster *spoke
+	if o.spokeKubeconfig != "" {
+		if spokeCluster, err = newSpoke(o.spokeKubeconfig, time.Duration(o.spokeTimeout)*time.Second); err != nil {
+			logger.Error(err, "failed to connect to the spoke")
+			exit(1)
+		}
+	}
+
+	if o.pprof {
+		go func() {
+			logger.Error(debug.serve(), "pperf server")
+		}()
+	}
+
+	if len(o.identities) != 0 {
+		if err := logClassification(context.TODO(), config, o.identities, o.identityGroups, logger); err != nil {
+			logger.Error(err, "failed to check the APF classification of the identities")
+		}
+	}
+
+	var apfNamesByUID map[string]string
+	if o.apfAttribution && !o.clean {
+		apfNamesByUID = resolveAPFNames(context.TODO(), config, logger)
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+
+	results := map[string]*Metrics{}
+	report := &Report{RunID: o.runID, Tags: o.tags}
+
+	defer func() {
+		if err := report.write(o.reportPath); err != nil {
+			logger.Error(err, "failed to write report")
+		}
+	}()
+
+	if report.Metadata, err = collectMetadata(context.TODO(), config, o.effective); err != nil {
+		logger.Error(err, "failed to collect the run metadata")
+	}
+
+	if o.state != nil {
+		logger.Info(fmt.Sprintf("the state of the run is saved to %s", o.state.path))
+	}
+
+	for _, layout := range o.layouts {
+		logger.Info(fmt.Sprintf("%s testing at %v(duration) seconds, %v(concurrent update client numbers) on clean == %v, update == %v, namespace layout == %v", o.runID, o.duration, o.concurrent, o.clean, o.update, layout))
+
+		metrics := NewMetrics()
+		results[layout] = metrics
+		debug.set(metrics)
+
+		// the requests on the wire, and their waits in the client side
+		// limiter, by verb and resource
+		requests := NewMetrics()
+		waits := NewMetrics()
+		byEndpoint := NewMetrics()
+
+		var byPriority *apfAttribution
+		if apfNamesByUID != nil {
+			byPriority = &apfAttribution{metrics: NewMetrics(), names: apfNamesByUID}
+		}
+		bw := newBandwidth()
+		rateLimiterWaits.set(waits)
+
+		wg := &sync.WaitGroup{}
+
+		stop := make(chan struct{})
+
+		if o.precreate() {
+			if err := o.precreateNamespaces(context.TODO(), config, layout, logger); err != nil {
+				logger.Error(err, "failed to pre-create the namespaces")
+				exit(1)
+			}
+		}
+
+		var probe *webhookProbe
+		if o.webhook != "" {
+			probe, err = newWebhookProbe(context.TODO(), config, o.webhook)
+			if err != nil {
+				logger.Error(err, "failed to set up the webhook probe")
+				exit(1)
+			}
+		}
+
+		var apiProbe *apiServiceProbe
+		if o.probeAPIServices != "" {
+			apiProbe, err = newAPIServiceProbe(config, strings.Split(o.probeAPIServices, ","), time.Duration(o.probeInterval)*time.Millisecond, metrics, logger)
+			if err != nil {
+				logger.Error(err, "failed to set up the APIService probe")
+				exit(1)
+			}
+
+			apiProbe.run(stop, wg)
+		}
+
+		var obs *observers
+		if o.observers > 0 {
+			obs, err = newObservers(config, o.observers, time.Duration(o.observerInterval)*time.Millisecond, o.runID, logger)
+			if err != nil {
+				logger.Error(err, "failed to set up the observers")
+				exit(1)
+			}
+
+			obs.run(stop, wg)
+		}
+
+		restarts := newWatchRestarts(o.restartFraction, time.Duration(o.restartAt)*time.Second, time.Duration(o.restartEvery)*time.Minute)
+		if restarts != nil && !o.clean {
+			restarts.run(metrics, logger, stop, wg)
+		}
+
+		if o.throughputEvery > 0 && !o.clean {
+			bw.sample(time.Duration(o.throughputEvery)*time.Second, stop, wg)
+		}
+
+		var waves *rollout
+		if o.mode == "rollout" && !o.clean {
+			waves = newRollout(time.Duration(o.rolloutEvery) * time.Second)
+			waves.run(logger, stop, wg)
+		}
+
+		var objects *targets
+		if o.mode == "target" && !o.clean {
+			if objects, err = o.startTargets(config, logger, stop, wg); err != nil {
+				logger.Error(err, "failed to discover the targets")
+				exit(1)
+			}
+		}
+
+		var measurement *latencyMeasurement
+		if o.objectLatency && !o.clean {
+			if measurement, err = o.startLatencyMeasurement(config, logger, stop, wg); err != nil {
+				logger.Error(err, "failed to start the latency measurement")
+				exit(1)
+			}
+		}
+
+		// the events of the watches of all the runners, see watch-lag
+		consistency := newSequenceCheck()
+
+		scale := newLoadScale()
+		if len(o.scheduleEntries) != 0 {
+			runSchedule(o.scheduleEntries, scale, logger, stop, wg)
+		}
+
+		opts := append(o.runnerOptions(layout, metrics, scale), WithLogger(logger), WithRequestMetrics(requests), WithRequestLog(reqLog), WithBandwidth(bw), WithWatchRestarts(restarts), WithWatchSequence(consistency), WithRollout(waves, o.rolloutWorks), WithTargets(objects, o.targetVerbs), WithEndpoints(o.endpoints, byEndpoint), WithAPFAttribution(byPriority))
+		if spokeCluster != nil {
+			opts = append(opts, WithSpoke(spokeCluster))
+		}
+
+		allocate := o.allocate(metrics)
+
+		if o.informer && !o.clean {
+			caches := map[string]cache.Cache{}
+			for _, cl := range clusters {
+				sharedCache, err := startCache(cl.config, stop, wg)
+				if err != nil {
+					cl.logger(logger).Error(err, "failed to start the cache")
+					exit(1)
+				}
+
+				caches[cl.hub] = sharedCache
+			}
+
+			allocate = withCaches(allocate, o.hubs, caches)
+		}
+
+		storageBefore := map[string]*storageSnapshot{}
+		for _, cl := range clusters {
+			snap, err := scrapeStorage(context.TODO(), cl.config)
+			if err != nil {
+				cl.logger(logger).Info(fmt.Sprintf("storage growth isn't tracked, error: %v", err))
+				continue
+			}
+
+			storageBefore[cl.hub] = snap
+		}
+
+		runReport := &RunReport{NamespaceLayout: layout, Start: time.Now()}
+
+		if o.state != nil && !o.clean {
+			o.state.track(runReport.Start, logger, stop, wg)
+		}
+
+		lim := newLimits(o.maxObjects, o.maxRequests)
+
+		rc := o.reconnect
+		rc.requests, rc.report = requests, &ReconnectReport{}
+
+		var verify func()
+		if o.verifyObjs && !o.clean {
+			verify = func() {
+				if runReport.Verification, err = o.verifyObjects(context.TODO(), clusters, logger); err != nil {
+					logger.Error(err, "failed to verify the objects")
+				}
+			}
+		}
+
+		// the storage is scraped under load, before the runners delete what
+		// they created
+		storageAfter := map[string]*storageSnapshot{}
+		scrape := func() {
+			for _, cl := range clusters {
+				if _, ok := storageBefore[cl.hub]; !ok {
+					continue
+				}
+
+				snap, err := scrapeStorage(context.TODO(), cl.config)
+				if err != nil {
+					cl.logger(logger).Error(err, "failed to scrape storage metrics")
+				}
+
+				storageAfter[cl.hub] = snap
+			}
+		}
+
+		interrupted := runLoad(logger, o.concurrent, time.Duration(o.duration)*time.Second, time.Duration(o.shutdownTimeout)*time.Second, o.clean, o.chaos, o.heartbeat, rc, allocate, lim, verify, scrape, c, stop, wg,
+			append(opts, WithLimits(lim))...)
+
+		if o.clean && o.state != nil {
+			if err := o.state.cleanRecorded(context.TODO(), clusters, o.reuseNamespaces || o.cleanScope == cleanObjects, o.concurrent, logger); err != nil {
+				logger.Error(err, "failed to delete the recorded objects")
+			}
+		}
+
+		if o.fastClean {
+			for _, cl := range clusters {
+				if err := o.cleanByCollection(context.TODO(), cl.config, cl.logger(logger)); err != nil {
+					cl.logger(logger).Error(err, "failed to clean up")
+				}
+			}
+		}
+
+		cleanup, err := o.verifyCleanup(context.TODO(), clusters, logger)
+		if err != nil {
+			logger.Error(err, "failed to verify the clean up")
+		}
+
+		if o.state != nil {
+			o.state.Finished = !interrupted && (cleanup == nil || cleanup.Verified)
+			if err := o.state.flush(); err != nil {
+				logger.Error(err, "failed to save the run state")
+			}
+		}
+
+		if o.clean {
+			report.Runs = append(report.Runs, &RunReport{NamespaceLayout: layout, Start: runReport.Start, End: time.Now(), Cleanup: cleanup})
+			return
+		}
+
+		metrics.Report(logger)
+
+		runReport.End = time.Now()
+		runReport.Interrupted = interrupted
+		runReport.LimitReached = lim.reason
+		runReport.Cleanup = cleanup
+		runReport.Operations = metrics.Summary()
+
+		logger.Info("requests on the wire, apart from the client side waits:")
+		requests.Report(logger)
+
+		runReport.Requests = requests.Summary()
+
+		logger.Info(fmt.Sprintf("bandwidth by verb, compression %v:", o.compression))
+		bw.Report(logger)
 
-	wg := &sync.WaitGroup{}
+		runReport.Bandwidth = bw.Summary()
+		runReport.Throughput = bw.Throughput()
+
+		rateLimiterWaits.set(nil)
+
+		logger.Info("waits in the client side rate limiter:")
+		waits.Report(logger)
+
+		runReport.LimiterWaits = waits.Summary()
+
+		if !rc.report.Start.IsZero() {
+			runReport.Reconnect = rc.report
+		}
+
+		if c := consistency.Report(); c.Events != 0 {
+			logger.Info(fmt.Sprintf("watch consistency: %v objects, %v events, %v writes lost, %v delivered twice, %v out of order", c.Objects, c.Events, c.Lost, c.Repeated, c.Reordered))
+			runReport.Consistency = &c
+		}
+
+		if o.endpoints != nil {
+			logger.Info(fmt.Sprintf("requests by apiserver endpoint, %s:", o.endpoints.policy))
+			byEndpoint.Report(logger)
+
+			if o.endpoints.weights != nil {
+				for i, u := range o.endpoints.urls {
+					logger.Info(fmt.Sprintf("endpoint %s weighted to %.1f%% of the load", u.Host, o.endpoints.share(i)))
+				}
+			}
+
+			runReport.Endpoints = byEndpoint.Summary()
+		}
+
+		if byPriority != nil {
+			logger.Info("requests by APF priority level and FlowSchema, the throttled ones as errors:")
+			byPriority.metrics.Report(logger)
+
+			runReport.PriorityLevels = byPriority.metrics.Summary()
+		}
+
+		if len(o.budgets) != 0 {
+			runReport.Budgets = o.budgets.check(runReport.Requests)
+			logBudgets(logger, runReport.Budgets)
+		}
+
+		if runReport.Verification != nil {
+			runReport.Verification.log(logger)
+		}
+
+		if measurement != nil {
+			logger.Info("object latency, from the creation of the objects:")
+
+			runReport.ObjectLatency = measurement.quantiles()
+			runReport.Thresholds = checkLatencyThresholds(o.latencyThresholds, runReport.ObjectLatency)
+			logLatencyQuantiles(logger, runReport.ObjectLatency, runReport.Thresholds)
+		}
+
+		if obs != nil {
+			logger.Info("observers, apart from the load:")
+			obs.metrics.Report(logger)
+
+			runReport.Observers = obs.metrics.Summary()
+		}
+
+		for _, cl := range clusters {
+			before, ok := storageBefore[cl.hub]
+			if !ok {
+				continue
+			}
+
+			// a clean run has no load to scrape under, its storage is
+			// scraped once it's done
+			after, ok := storageAfter[cl.hub]
+			if !ok {
+				if after, err = scrapeStorage(context.TODO(), cl.config); err != nil {
+					cl.logger(logger).Error(err, "failed to scrape storage metrics")
+				}
+			}
+
+			growth := storageGrowth(before, after)
+			growth.log(cl.logger(logger))
+
+			if cl.hub == "" {
+				runReport.Storage = growth
+				continue
+			}
+
+			if runReport.HubStorage == nil {
+				runReport.HubStorage = map[string]*StorageGrowth{}
+			}
+
+			runReport.HubStorage[cl.hub] = growth
+		}
+
+		report.Runs = append(report.Runs, runReport)
+
+		if len(o.hubs) != 0 {
+			compareScopes(logger, metrics, o.hubs.names())
+		}
+
+		if len(o.tenants) != 0 {
+			compareScopes(logger, metrics, o.tenants.names())
+		}
+
+		if probe != nil {
+			probe.report(context.TODO(), logger, metrics)
+		}
+
+		if apiProbe != nil {
+			apiProbe.report(logger)
+		}
+
+		if interrupted {
+			return
+		}
+	}
+
+	if o.compareLayouts {
+		compareMetrics(logger, namespacePerObject, results[namespacePerObject], namespaceShared, results[namespaceShared])
+	}
+}
+
+// runLoad starts concurrent runners built from opts and the allocate options
+// of their index, then stops them after
+// dur, or on a signal, and waits until they're done. It returns true if the
+// run was interrupted.
+func runLoad(logger logr.Logger, concurrent int, dur, shutdownTimeout time.Duration, clean bool, ch chaos, hb heartbeat, rc reconnect, allocate func(idx int) []Option, lim *limits, verify, scrape func(), sig <-chan os.Signal, stop chan struct{}, wg *sync.WaitGroup, opts ...Option) bool {
+	ctx, cancel := context.WithCancel(context.Background())
+	shutdownCtx, shutdownCancel := context.WithCancel(context.Background())
+	defer shutdownCancel()
+
+	spawn := func(idx int, extra ...Option) *Runner {
+		all := append([]Option{
+			WithNameSuffix(idx),
+			WithStop(stop),
+			WithKill(make(chan struct{})),
+			WithQuit(make(chan struct{})),
+			WithContext(ctx, shutdownCtx),
+		}, opts...)
+		all = append(all, allocate(idx)...)
+
+		return NewRunner(append(all, extra...)...)
+	}
+
+	now := time.Now()
+	p := newPool(spawn, logger, stop, wg)
+	p.resize(concurrent)
+
+	if !clean && hb.enabled() {
+		p.supervise(hb)
+	}
+
+	if !clean && ch.enabled() {
+		ch.run(p, logger, stop, wg)
+	}
+
+	if !clean && rc.enabled() {
+		rc.run(p, logger, stop, wg)
+	}
+
+	logger.Info(fmt.Sprintf("test %v templates  ", concurrent))
+
+	timeout := time.After(dur)
+
+	cleanUp := func() {
+		lim.lift()
+		cancel()
+		close(stop)
+	}
+
+	// wait for the runners to clean up, canceling their requests after
+	// shutdownTimeout
+	wait := func() {
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+
+		if shutdownTimeout <= 0 {
+			<-done
+			return
+		}
+
+		select {
+		case <-done:
+		case <-time.After(shutdownTimeout):
+			logger.Info(fmt.Sprintf("clean up still running after %v, canceling it", shutdownTimeout))
+			shutdownCancel()
+
+			select {
+			case <-done:
+			case <-time.After(shutdownGrace):
+				logger.Info("some runners didn't stop, what they created may be left behind")
+			}
+		}
+	}
+
+	if clean {
+		cleanUp()
+		wait()
+		return false
+	}
+
+	interrupted := false
+
+	select {
+	case <-sig:
+		logger.Info("system interrupt")
+		interrupted = true
+	case <-timeout:
+		logger.Info(fmt.Sprintf("stop after %v", time.Now().Sub(now).Seconds()))
+	case <-lim.done():
+		logger.Info(fmt.Sprintf("stop after %v, %s", time.Now().Sub(now).Seconds(), lim.reason))
+	}
+
+	// the objects are verified before the runners delete them
+	if verify != nil && !interrupted {
+		verify()
+	}
+
+	if scrape != nil {
+		scrape()
+	}
+
+	cleanUp()
+
+	wait()
+
+	p.report(logger)
+
+	return interrupted
+}
+
+type Option func(*Runner)
+
+func NewRunner(ops ...Option) *Runner {
+	r := &Runner{}
+
+	for _, ops := range ops {
+		ops(r)
+	}
+
+	return r
+}
+
+type Runner struct {
+	name       string
+	kubeconfig string
+	client.Client
+	// template only holds the metadata of the runner's object, the body is
+	// in shared, see object
+	template *unstructured.Unstructured
+	shared   *unstructured.Unstructured
+	stop     chan struct{}
+	logger   logr.Logger
+	clean    bool
+	update   bool
+	interval time.Duration
+	// startJitter is the longest random delay of the start, see waitJitter
+	startJitter time.Duration
+
+	config    *restclient.Config
+	transport *http.Transport
+	discovery discovery.DiscoveryInterface
+	killCh    chan struct{}
+	quitCh    chan struct{}
+	// lastBeat is the unix nano time of the last progress, see beat
+	lastBeat int64
+
+	patchType string
+	metrics   *Metrics
+
+	workload      workload
+	fieldManagers int
+	managedFields int
+
+	batchSize   int
+	batch       []*Runner
+	batchMember bool
+	quotaHard   int
+
+	// batchWorkers drive the objects of the batch each on its own, see
+	// startBatchWorkers
+	batchWorkers     int
+	batchQueue       chan batchTick
+	batchWorkersDone *sync.WaitGroup
+	batchCancel      context.CancelFunc
+	ticking          int32
+	skippedTicks     int64
+
+	spoke *spoke
+	// spokeWaits are the waits for the resources of the works on the spoke,
+	// see verifySpoke
+	spokeWaits *sync.WaitGroup
+	// distinctManifests tells the resources of the ManifestWorks are named
+	// after their work, see suffixManifests
+	distinctManifests bool
+
+	// requests records the requests on the wire, see wrapRequests
+	requests  *Metrics
+	bandwidth *bandwidth
+	// requestLog logs the requests with their audit ID, see wrapRequestLog
+	requestLog *requestLog
+
+	readQPS       float32
+	readBurst     int
+	writeQPS      float32
+	writeBurst    int
+	readTransport *http.Transport
+
+	transportSettings transportSettings
+
+	endpoints       *endpoints
+	endpointMetrics *Metrics
+	apfAttribution  *apfAttribution
+	hedgeAfter      time.Duration
+
+	// cachedReads reads from the watch cache in the cached-get mode
+	cachedReads bool
+	reader      dynamic.Interface
+
+	csrApproverKubeconfig string
+	csrApprover           kubernetes.Interface
+	csrNames              []string
+
+	crdChurn       string
+	crdMaxVersions int
+
+	discoveryTargets []string
+
+	streamKind   string
+	streamCount  int
+	streamConfig *restclient.Config
+	clientset    kubernetes.Interface
+	streamPod    string
+	streams      []*stream
+
+	sharedNamespace bool
+	namespacePrefix string
+	reuseNamespaces bool
+
+	namespaceLabels      map[string]string
+	namespaceAnnotations map[string]string
+	tags                 string
+	precreatedNamespaces bool
+	lookupNamespace      bool
+
+	baseName   string
+	objectTTL  time.Duration
+	createdAt  time.Time
+	generation int
+
+	index int
+	keys  *keyspace
+	skew  keySkew
+	rand  *rand.Rand
+	zipf  *rand.Zipf
+
+	scale *loadScale
+
+	malformedPercent float64
+	malformedSize    int
+	collidePercent   float64
+	onAlreadyExists  string
+	onNotFound       string
+
+	identity       string
+	identityGroups []string
+	// tenantLimiter is the client side limit shared by the clients of a
+	// tenant
+	tenantLimiter flowcontrol.RateLimiter
+
+	runID     string
+	userAgent *template.Template
+
+	headers headerList
+
+	limits *limits
+
+	watchCancel     context.CancelFunc
+	watchProgress   *watchProgress
+	watchStaleAfter time.Duration
+	watchRestarts   *watchRestarts
+	watchSequence   *sequenceCheck
+	// watchLastSeq is the sequence of the last write the watch saw
+	watchLastSeq int
+
+	updateStrategy string
+
+	evictPods         int
+	evictMinAvailable int
+	// evictNodeless tells there's no node to run the pods of the evict mode,
+	// their phase is set instead, and evictRunning which ones are Running
+	evictNodeless bool
+	evictRunning  []bool
+
+	bindNodes []string
+
+	fanoutKind  string
+	fanoutBytes int
+
+	stamps *stamps
+
+	feedbackValues int
+	feedbackBytes  int
+
+	placementChurn    float64
+	placementClusters int
+	placementPool     int
+	placementOffset   int
+
+	// consumeRate is the events per second the slow-watch mode reads
+	consumeRate float64
+
+	// rotateEvery is the interval between the credentials of the runner,
+	// tokens of rotateAccount, see rotateCredentials
+	rotateEvery   time.Duration
+	rotateAccount types.NamespacedName
+	token         string
+	tokenClient   kubernetes.Interface
+
+	lifecycle       []lifecycleStep
+	lifecycleObject *unstructured.Unstructured
+
+	waitReady   *waitExpr
+	waitTimeout time.Duration
+
+	targets     *targets
+	targetVerbs []string
+
+	clusterChurn       string
+	clusterChurnValues int
+	clusterSet         string
+
+	rollout      *rollout
+	rolloutWorks int
+	rolloutState *rolloutState
+
+	boundaries     []boundary
+	boundaryMargin int
+	boundaryField  []string
+
+	cache cache.Cache
+
+	resyncInterval time.Duration
+	resyncWorkers  int
+	lastResync     time.Time
+
+	nameStrategy string
+	namePrefix   string
+
+	fastClean  bool
+	cleanScope string
+
+	state *runState
+
+	// ctx is canceled once the run stops, shutdownCtx once the clean up
+	// outlived -shutdown-timeout, shutdown tells which one is in use
+	ctx         context.Context
+	shutdownCtx context.Context
+	shutdown    int32
+}
+
+func WithKubePath(kubeconfig string) Option {
+	return func(r *Runner) {
+		r.kubeconfig = kubeconfig
+	}
+}
+
+func WithCleanOption(clean bool) Option {
+	return func(r *Runner) {
+		r.clean = clean
+	}
+}
+
+func WithInterval(interval int) Option {
+	return func(r *Runner) {
+		r.interval = time.Millisecond * time.Duration(interval)
+	}
+}
+
+func WithStartJitter(jitter int) Option {
+	return func(r *Runner) {
+		r.startJitter = time.Millisecond * time.Duration(jitter)
+	}
+}
+
+func WithUpdateOption(update bool) Option {
+	return func(r *Runner) {
+		r.update = update
+	}
+}
+
+func WithPatchType(t string) Option {
+	return func(r *Runner) {
+		r.patchType = t
+	}
+}
+
+func WithWorkload(w workload) Option {
+	return func(r *Runner) {
+		r.workload = w
+	}
+}
+
+func WithFieldManagers(n int) Option {
+	return func(r *Runner) {
+		r.fieldManagers = n
+	}
+}
+
+func WithQuotaHard(n int) Option {
+	return func(r *Runner) {
+		r.quotaHard = n
+	}
+}
+
+func WithCSRApprover(kubeconfig string) Option {
+	return func(r *Runner) {
+		r.csrApproverKubeconfig = kubeconfig
+	}
+}
+
+func WithCRDChurn(churn string, maxVersions int) Option {
+	return func(r *Runner) {
+		r.crdChurn = churn
+		r.crdMaxVersions = maxVersions
+	}
+}
+
+func WithDiscoveryTargets(targets []string) Option {
+	return func(r *Runner) {
+		r.discoveryTargets = targets
+	}
+}
+
+func WithStreams(kind string, count int) Option {
+	return func(r *Runner) {
+		r.streamKind = kind
+		r.streamCount = count
+	}
+}
+
+func WithSharedNamespace(shared bool) Option {
+	return func(r *Runner) {
+		r.sharedNamespace = shared
+	}
+}
+
+func WithNamespaces(prefix string, reuse bool) Option {
+	return func(r *Runner) {
+		r.namespacePrefix = prefix
+		r.reuseNamespaces = reuse
+	}
+}
+
+// WithLookupNamespace tells the namespace of the template is an existing one,
+// looked up from the cluster, which the runner neither creates nor deletes.
+func WithLookupNamespace(lookup bool) Option {
+	return func(r *Runner) {
+		if lookup {
+			r.lookupNamespace = true
+			r.reuseNamespaces = true
+		}
+	}
+}
+
+func WithPrecreatedNamespaces(precreated bool) Option {
+	return func(r *Runner) {
+		r.precreatedNamespaces = precreated
+	}
+}
+
+// WithTags sets the tags annotation, see tagsAnnotation.
+func WithTags(tags keyValues) Option {
+	return func(r *Runner) {
+		if len(tags) != 0 {
+			r.tags = tags.String()
+		}
+	}
+}
+
+func WithNamespaceMetadata(labels, annotations map[string]string) Option {
+	return func(r *Runner) {
+		r.namespaceLabels = labels
+		r.namespaceAnnotations = annotations
+	}
+}
+
+func WithObjectTTL(ttl int) Option {
+	return func(r *Runner) {
+		r.objectTTL = time.Second * time.Duration(ttl)
+	}
+}
+
+func WithKeySkew(keys *keyspace, skew keySkew) Option {
+	return func(r *Runner) {
+		r.keys = keys
+		r.skew = skew
+	}
+}
+
+func WithLoadScale(scale *loadScale) Option {
+	return func(r *Runner) {
+		r.scale = scale
+	}
+}
+
+func WithKill(kill chan struct{}) Option {
+	return func(r *Runner) {
+		r.killCh = kill
+	}
+}
+
+func WithQuit(quit chan struct{}) Option {
+	return func(r *Runner) {
+		r.quitCh = quit
+	}
+}
+
+func WithBatchSize(n int) Option {
+	return func(r *Runner) {
+		r.batchSize = n
+	}
+}
+
+func WithBatchWorkers(n int) Option {
+	return func(r *Runner) {
+		r.batchWorkers = n
+	}
+}
+
+func WithCachedReads(cached bool) Option {
+	return func(r *Runner) {
+		r.cachedReads = cached
+	}
+}
+
+func WithWatchStaleAfter(d time.Duration) Option {
+	return func(r *Runner) {
+		r.watchStaleAfter = d
+	}
+}
+
+func WithWatchSequence(c *sequenceCheck) Option {
+	return func(r *Runner) {
+		r.watchSequence = c
+	}
+}
+
+func WithWatchRestarts(w *watchRestarts) Option {
+	return func(r *Runner) {
+		r.watchRestarts = w
+	}
+}
+
+func WithUpdateStrategy(s string) Option {
+	return func(r *Runner) {
+		r.updateStrategy = s
+	}
+}
+
+func WithEviction(pods, minAvailable int) Option {
+	return func(r *Runner) {
+		r.evictPods = pods
+		r.evictMinAvailable = minAvailable
+		r.evictRunning = make([]bool, pods)
+	}
+}
+
+func WithBindNodes(nodes []string) Option {
+	return func(r *Runner) {
+		r.bindNodes = nodes
+	}
+}
+
+func WithFanout(kind string, bytes int) Option {
+	return func(r *Runner) {
+		r.fanoutKind = kind
+		r.fanoutBytes = bytes
+	}
+}
+
+func WithConsumeRate(rate float64) Option {
+	return func(r *Runner) {
+		r.consumeRate = rate
+	}
+}
+
+func WithCredentialRotation(every time.Duration, account types.NamespacedName) Option {
+	return func(r *Runner) {
+		r.rotateEvery = every
+		r.rotateAccount = account
+	}
+}
+
+func WithLifecycle(steps []lifecycleStep) Option {
+	return func(r *Runner) {
+		r.lifecycle = steps
+	}
+}
+
+func WithWait(ready *waitExpr, timeout time.Duration) Option {
+	return func(r *Runner) {
+		r.waitReady = ready
+		r.waitTimeout = timeout
+	}
+}
+
+func WithTargets(t *targets, verbs []string) Option {
+	return func(r *Runner) {
+		r.targets = t
+		r.targetVerbs = verbs
+	}
+}
+
+func WithClusterChurn(churn string, values int, set string) Option {
+	return func(r *Runner) {
+		r.clusterChurn = churn
+		r.clusterChurnValues = values
+		r.clusterSet = set
+	}
+}
+
+func WithPlacementChurn(churn float64, clusters, pool int) Option {
+	return func(r *Runner) {
+		r.placementChurn = churn
+		r.placementClusters = clusters
+		r.placementPool = pool
+	}
+}
+
+func WithFeedback(values, bytes int) Option {
+	return func(r *Runner) {
+		r.feedbackValues = values
+		r.feedbackBytes = bytes
+	}
+}
+
+func WithRollout(w *rollout, works int) Option {
+	return func(r *Runner) {
+		r.rollout = w
+		r.rolloutWorks = works
+	}
+}
+
+func WithStampWrites(stamp bool) Option {
+	return func(r *Runner) {
+		if stamp {
+			r.stamps = &stamps{seqs: map[string]int{}}
+		}
+	}
+}
 
-	stop := make(chan struct{})
+func WithBoundaries(boundaries []boundary, margin int, field string) Option {
+	return func(r *Runner) {
+		r.boundaries = boundaries
+		r.boundaryMargin = margin
+		r.boundaryField = strings.Split(field, ".")
+	}
+}
 
-	w := &unstructured.Unstructured{}
+func WithMalformed(percent float64, size int) Option {
+	return func(r *Runner) {
+		r.malformedPercent = percent
+		r.malformedSize = size
+	}
+}
 
-	dat, err := ioutil.ReadFile(*tmeplate)
-	if err != nil {
-		logger.Error(err, "failed to read template")
-		os.Exit(1)
+func WithOutcomes(onAlreadyExists, onNotFound string) Option {
+	return func(r *Runner) {
+		r.onAlreadyExists = onAlreadyExists
+		r.onNotFound = onNotFound
 	}
+}
 
-	if err := yaml.Unmarshal(dat, w); err != nil {
-		logger.Error(err, "failed to parse template")
-		os.Exit(1)
+func WithCollisions(percent float64) Option {
+	return func(r *Runner) {
+		r.collidePercent = percent
 	}
+}
 
-	if *pprof {
-		go func() {
-			logger.Error(http.ListenAndServe("localhost:6060", nil), "pperf server")
-		}()
+// WithTenant puts the runner in the namespaces of t, and under its limit,
+// its identity is set by WithIdentity.
+func WithTenant(t *tenant, namespacePrefix string) Option {
+	return func(r *Runner) {
+		r.namespacePrefix = t.namespacePrefix(namespacePrefix)
+		r.tenantLimiter = t.limiter
 	}
+}
 
-	logger.Info(fmt.Sprintf("testing at %v(duration) seconds, %v(concurrent update client numbers) on clean == %v, update == %v", *duration, *concurentNum, *clean, *update))
+func WithIdentity(identity string, groups []string) Option {
+	return func(r *Runner) {
+		r.identity = identity
+		r.identityGroups = groups
+	}
+}
 
-	now := time.Now()
-	for idx := 0; idx < *concurentNum; idx++ {
-		idx := idx
-		go NewRunner(
-			WithNameSuffix(idx),
-			WithTemplate(w),
-			WithStop(stop),
-			WithWaitGroup(wg),
-			WithInterval(*interval),
-			WithLogger(logger),
-			WithKubePath(*kubeconfig),
-			WithCleanOption(*clean),
-			WithUpdateOption(*update),
-		).run()
+func WithUserAgent(runID string, ua *template.Template) Option {
+	return func(r *Runner) {
+		r.runID = runID
+		r.userAgent = ua
+	}
+}
 
+func WithHeaders(headers headerList) Option {
+	return func(r *Runner) {
+		r.headers = headers
 	}
+}
 
-	logger.Info(fmt.Sprintf("test %v templates  ", *concurentNum))
+func WithLimits(l *limits) Option {
+	return func(r *Runner) {
+		r.limits = l
+	}
+}
 
-	c := make(chan os.Signal)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+func WithCache(c cache.Cache) Option {
+	return func(r *Runner) {
+		r.cache = c
+	}
+}
 
-	dur := time.Duration(*duration) * time.Second
-	timeout := time.After(dur)
+func WithResync(interval time.Duration, workers int) Option {
+	return func(r *Runner) {
+		r.resyncInterval = interval
+		r.resyncWorkers = workers
+	}
+}
 
-	cleanUp := func() {
-		close(stop)
+func WithNameStrategy(strategy string) Option {
+	return func(r *Runner) {
+		r.nameStrategy = strategy
 	}
+}
 
-	defer wg.Wait()
+func WithFastClean(fast bool) Option {
+	return func(r *Runner) {
+		r.fastClean = fast
+	}
+}
 
-	if *clean {
-		return
+func WithCleanScope(scope string) Option {
+	return func(r *Runner) {
+		r.cleanScope = scope
 	}
+}
 
-	select {
-	case <-c:
-		logger.Info("system interrupt")
-	case <-timeout:
-		logger.Info(fmt.Sprintf("stop after %v", time.Now().Sub(now).Seconds()))
+func WithContext(ctx, shutdownCtx context.Context) Option {
+	return func(r *Runner) {
+		r.ctx = ctx
+		r.shutdownCtx = shutdownCtx
 	}
+}
 
-	cleanUp()
+func WithState(s *runState) Option {
+	return func(r *Runner) {
+		r.state = s
+	}
 }
 
-type Option func(*Runner)
+func WithEndpoints(e *endpoints, m *Metrics) Option {
+	return func(r *Runner) {
+		r.endpoints = e
+		r.endpointMetrics = m
+	}
+}
 
-func NewRunner(ops ...Option) *Runner {
-	r := &Runner{}
+func WithTransportSettings(s transportSettings) Option {
+	return func(r *Runner) {
+		r.transportSettings = s
+	}
+}
 
-	for _, ops := range ops {
-		ops(r)
+func WithQPS(readQPS float32, readBurst int, writeQPS float32, writeBurst int) Option {
+	return func(r *Runner) {
+		r.readQPS = readQPS
+		r.readBurst = readBurst
+		r.writeQPS = writeQPS
+		r.writeBurst = writeBurst
 	}
+}
 
-	return r
+func WithRequestMetrics(m *Metrics) Option {
+	return func(r *Runner) {
+		r.requests = m
+	}
 }
 
-type Runner struct {
-	name       string
-	kubeconfig string
-	client.Client
-	template *unstructured.Unstructured
-	stop     chan struct{}
-	logger   logr.Logger
-	wg       *sync.WaitGroup
-	clean    bool
-	update   bool
-	interval time.Duration
+func WithHedging(after int) Option {
+	return func(r *Runner) {
+		r.hedgeAfter = time.Millisecond * time.Duration(after)
+	}
 }
 
-func WithKubePath(kubeconfig string) Option {
+func WithAPFAttribution(a *apfAttribution) Option {
 	return func(r *Runner) {
-		r.kubeconfig = kubeconfig
+		r.apfAttribution = a
 	}
 }
 
-func WithCleanOption(clean bool) Option {
+func WithRequestLog(l *requestLog) Option {
 	return func(r *Runner) {
-		r.clean = clean
+		r.requestLog = l
 	}
 }
 
-func WithInterval(interval int) Option {
+func WithBandwidth(b *bandwidth) Option {
 	return func(r *Runner) {
-		r.interval = time.Millisecond * time.Duration(interval)
+		r.bandwidth = b
 	}
 }
 
-func WithUpdateOption(update bool) Option {
+func WithMetrics(m *Metrics) Option {
 	return func(r *Runner) {
-		r.update = update
+		r.metrics = m
 	}
 }
 
+// WithTemplate shares w between the runners, it mustn't be modified.
 func WithTemplate(w *unstructured.Unstructured) Option {
 	return func(r *Runner) {
-		r.template = w.DeepCopy()
+		r.shared = w
+		r.template = templateMeta(w)
 	}
 }
 
 func WithNameSuffix(s int) Option {
 	return func(r *Runner) {
 		r.name = fmt.Sprintf("%v", s)
+		r.index = s
 	}
 }
 
@@ -196,16 +1351,30 @@ func WithLogger(logger logr.Logger) Option {
 	}
 }
 
-func WithWaitGroup(wg *sync.WaitGroup) Option {
+func WithStop(stop chan struct{}) Option {
 	return func(r *Runner) {
-		r.wg = wg
+		r.stop = stop
 	}
 }
 
-func WithStop(stop chan struct{}) Option {
-	return func(r *Runner) {
-		r.stop = stop
+// context is the context of the runner's requests, the load requests are
+// canceled once the run stops, the clean up ones after -shutdown-timeout.
+func (r *Runner) context() context.Context {
+	if atomic.LoadInt32(&r.shutdown) == 1 && r.shutdownCtx != nil {
+		return r.shutdownCtx
+	}
+
+	if r.ctx == nil {
+		return context.TODO()
 	}
+
+	return r.ctx
+}
+
+// shuttingDown switches the runner to the context of the clean up, the
+// goroutines of the runner may still be reading its context.
+func (r *Runner) shuttingDown() {
+	atomic.StoreInt32(&r.shutdown, 1)
 }
 
 func (r *Runner) configClient() error {
@@ -214,6 +1383,10 @@ func (r *Runner) configClient() error {
 		return fmt.Errorf("failed to load rest.Config, error: %w", err)
 	}
 
+	if r.token != "" {
+		withToken(config, r.token)
+	}
+
 	t := http.DefaultTransport.(*http.Transport).Clone()
 	t.MaxIdleConns = 10
 	t.MaxConnsPerHost = 10
@@ -233,95 +1406,204 @@ func (r *Runner) configClient() error {
 	tlsConfig.InsecureSkipVerify = true
 
 	t.TLSClientConfig = tlsConfig
+
+	// the custom transport would bypass the proxy of the kubeconfig
+	t.Proxy = r.transportSettings.proxy(config.Proxy)
+
+	if err := r.transportSettings.configure(t); err != nil {
+		return err
+	}
+
+	// the bandwidth is counted before the transport decompresses, it asks
+	// for gzip itself
+	if r.bandwidth != nil {
+		t.DisableCompression = true
+	}
 	config.Transport = t
+	r.transport = t
 
 	// make sure the config TLSClientConfig won't override the custom Transport
 	config.TLSClientConfig = restclient.TLSClientConfig{}
 
-	config.QPS = 500.0
-	config.Burst = 1000
+	config.QPS = r.writeQPS
+	config.Burst = r.writeBurst
+
+	// it replaces the limits of the client, for the reads as well
+	if r.tenantLimiter != nil {
+		config.RateLimiter = r.tenantLimiter
+	}
+
+	if r.identity != "" {
+		config.Impersonate = impersonationFor(r.identity, r.identityGroups)
+	}
+
+	config.Wrap(wrapHeaders(r.headers))
+	config.Wrap(wrapLimits(r.limits))
+	config.Wrap(wrapRequests(r.requests))
+	config.Wrap(wrapRequestLog(r.requestLog))
+	config.Wrap(wrapBandwidth(r.bandwidth, r.transportSettings.compression))
+	config.Wrap(wrapEndpoints(r.endpoints, r.index, r.endpointMetrics))
+	config.Wrap(wrapAPFAttribution(r.apfAttribution))
+	// outermost, so the copies count as requests on the wire
+	config.Wrap(wrapHedging(r.hedging()))
+
+	if r.userAgent != nil {
+		ua, err := renderUserAgent(r.userAgent, userAgentData{RunID: r.runID, Runner: r.name, Identity: r.identity, Version: simulatorVersion()})
+		if err != nil {
+			return err
+		}
+
+		config.UserAgent = ua
+	}
 
 	cl, err := client.New(config, client.Options{})
 	if err != nil {
 		return fmt.Errorf("%s failed to create client, error: %w", r.name, err)
 	}
 
+	if r.readQPS != r.writeQPS || r.readBurst != r.writeBurst {
+		if cl, err = r.splitClient(config, cl); err != nil {
+			return err
+		}
+	}
+
+	if r.cache != nil {
+		if cl, err = cachedClient(r.cache, cl); err != nil {
+			return fmt.Errorf("%s failed to create cached client, error: %w", r.name, err)
+		}
+	}
+
 	r.Client = cl
+	r.config = config
 
 	return nil
 }
 
-func (r *Runner) run() {
+// prepare computes the runner's objects, it runs before work.
+func (r *Runner) prepare() {
 	r.initial()
+	r.beat()
+
+	// the plan and the namespace pre-creation prepare runners without metrics
+	if r.identity != "" && r.metrics != nil {
+		r.metrics = r.metrics.Scoped(r.identity)
+	}
+
+	// killing the runner cancels the ticks of its batch workers, the batch
+	// members share its context
+	if r.batchWorkers > 0 && r.batchSize > 1 {
+		r.ctx, r.batchCancel = context.WithCancel(r.context())
+	}
+
+	r.batch = r.batchMembers()
+}
 
+// work drives the workload until the run stops, then cleans up, or only
+// cleans up in clean mode.
+func (r *Runner) work() {
 	if r.clean {
+		r.shuttingDown()
 		r.delete()
 		return
 	}
 
-	go func() {
-		r.wg.Add(1)
-
-		r.apply()
-
-		r.wg.Done()
-	}()
+	r.apply()
 }
 
 func (r *Runner) initial() {
-	payload := r.template.DeepCopy()
+	payload := r.template
 
 	if payload.GetName() == "" {
 		return
 	}
 
+	r.namePrefix = payload.GetName()
+	name := objectName(r.nameStrategy, r.namePrefix, r.runID, r.index)
+
 	ns := &corev1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: fmt.Sprintf("%s-%v", payload.GetName(), r.name),
+			Name: name,
 		},
 	}
 
+	nsPrefix := payload.GetName()
+	if r.namespacePrefix != "" {
+		nsPrefix = r.namespacePrefix
+		ns.Name = fmt.Sprintf("%s-%v", r.namespacePrefix, r.index)
+	}
+
+	if r.sharedNamespace {
+		ns.Name = fmt.Sprintf("%s-%s", nsPrefix, namespaceShared)
+	}
+
+	if r.lookupNamespace {
+		ns.Name = payload.GetNamespace()
+	}
+
 	key := types.NamespacedName{
-		Name:      fmt.Sprintf("%s-%v", payload.GetName(), r.name),
+		Name:      name,
 		Namespace: ns.Name,
 	}
 
 	payload.SetNamespace(key.Namespace)
 	payload.SetName(key.Name)
+	payload.SetLabels(r.labels(payload.GetLabels()))
+	payload.SetAnnotations(r.annotations(payload.GetAnnotations()))
 
-	r.template = payload.DeepCopy()
+	r.baseName = key.Name
 
 	return
 }
 
 func (r *Runner) create() error {
-	ctx := context.TODO()
+	return r.createAs("create", r.onAlreadyExists)
+}
 
-	// for SSAR resource, it won't have metadata...
-	if r.template.GetNamespace() != "" {
-		ns := &corev1.Namespace{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: r.template.GetNamespace(),
-			},
-		}
+// createAs creates the runner's object, an AlreadyExists is reported as
+// <op>/already-exists and handled with handling, see swallowed.
+func (r *Runner) createAs(op, handling string) error {
+	ctx := r.context()
 
-		if err := r.Client.Create(ctx, ns); err != nil {
-			if !k8serrors.IsAlreadyExists(err) {
-				r.logger.Error(err, "failed to create namespace")
-				return err
-			}
+	if !r.limits.reserveObject() {
+		return errLimitReached
+	}
 
+	// for SSAR resource, it won't have metadata... the batch members live in
+	// the runner's namespace
+	if r.template.GetNamespace() != "" && !r.batchMember {
+		if err := r.createNamespace(ctx, r.template.GetNamespace()); err != nil {
+			r.limits.releaseObject()
+			r.logger.Error(err, "failed to create namespace")
+			return err
 		}
 	}
 
-	tmp := r.template.DeepCopy()
+	tmp := r.object()
+	annotations, seq := r.stamp(r.getKey().String(), nil)
+	setAnnotations(tmp, annotations)
+	r.suffixManifests(tmp)
+
+	start := time.Now()
 	if err := r.Client.Create(ctx, tmp); err != nil {
+		r.limits.releaseObject()
+
 		if !k8serrors.IsAlreadyExists(err) {
 			r.logger.Error(err, fmt.Sprintf("failed to create manifestwork: %s ", r.getKey()))
 			return err
 		}
+
+		if !r.swallowed(op, r.getKey().String(), err, time.Since(start), handling) {
+			return err
+		}
+
+		return nil
 	}
 
+	r.limits.commitObject()
+	r.stamped(r.getKey().String(), seq)
+	r.state.add(r.template)
+	r.verifySpoke(tmp, start)
+
 	// turn this line on to print the response of SSRA
 	// r.logger.Info(fmt.Sprintf("here's the SSRA output:\n%v", tmp))
 
@@ -337,7 +1619,8 @@ func (r *Runner) getKey() types.NamespacedName {
 }
 
 func (r *Runner) delete() {
-	if r.template.GetNamespace() == "" {
+	// the objects are deleted by collection once the runners are done
+	if r.fastClean || r.template.GetNamespace() == "" {
 		return
 	}
 
@@ -354,12 +1637,30 @@ func (r *Runner) delete() {
 
 	defer r.logger.Info(fmt.Sprintf("deleted %s", r.name))
 
-	ctx := context.TODO()
-	if err := r.Client.Delete(ctx, r.template.DeepCopy()); err != nil {
-		if !k8serrors.IsNotFound(err) {
-			r.logger.Error(err, fmt.Sprintf("failed to delete manifestwork: %s", r.getKey()))
-			return
+	ctx := r.context()
+
+	// deleting the namespace deletes the objects as well
+	if r.cleanScope != cleanNamespaces || r.reuseNamespaces {
+		r.deleteBatch()
+
+		start := time.Now()
+		if err := r.Client.Delete(ctx, r.template.DeepCopy()); err != nil {
+			if !k8serrors.IsNotFound(err) {
+				r.logger.Error(err, fmt.Sprintf("failed to delete manifestwork: %s", r.getKey()))
+				return
+			}
+
+			if !r.swallowed("delete", r.getKey().String(), err, time.Since(start), r.onNotFound) {
+				return
+			}
 		}
+
+		r.state.remove(r.template)
+	}
+
+	// the namespaces created out-of-band outlive the run
+	if r.reuseNamespaces || r.cleanScope == cleanObjects {
+		return
 	}
 
 	ns := &corev1.Namespace{
@@ -379,6 +1680,10 @@ func (r *Runner) delete() {
 func (r *Runner) apply() {
 	r.logger.Info(r.name)
 
+	if !r.waitJitter() {
+		return
+	}
+
 	cnt := 0
 	for err := r.configClient(); err != nil; err = r.configClient() {
 		r.logger.Error(err, "failed to create client")
@@ -390,21 +1695,106 @@ func (r *Runner) apply() {
 		}
 	}
 
-	if err := r.create(); err != nil {
-		r.logger.Error(err, "failed to create resource")
+	r.shareClient()
+
+	if r.rotateEvery > 0 {
+		if err := r.rotateCredentials(); err != nil {
+			r.logger.Error(err, "failed to issue the credentials")
+			return
+		}
+	}
+
+	setup := r.workload.setup
+	if setup == nil {
+		setup = (*Runner).create
+	}
+
+	// the start jitter is over
+	r.beat()
+
+	if err := setup(r); err != nil {
+		if !errors.Is(err, errLimitReached) {
+			r.logger.Error(err, "failed to create resource")
+		}
+
 		return
 	}
 
-	ctx := context.TODO()
+	if r.workload.setup == nil && r.waitReady != nil {
+		_ = r.waitFor(r.context(), r.template.DeepCopy(), r.waitReady, "wait/ready")
+	}
+
+	r.createdAt = time.Now()
+	r.lastResync = r.createdAt
+
+	if r.workload.setup == nil {
+		r.createBatch()
+	}
+
+	r.beat()
+
+	if r.keys != nil && r.workload.setup == nil {
+		r.keys.set(r.index, r.getKey())
+	}
+
+	r.startBatchWorkers()
+
+	seq := 1
+	scale := r.scale.get()
+	ticker := time.NewTicker(scaleInterval(r.interval, scale))
+
+	// the runners rotate their credentials at the same time, on the
+	// multiples of the interval
+	var rotate <-chan time.Time
+	var rotation *time.Timer
+	if r.rotateEvery > 0 {
+		rotation = time.NewTimer(untilRotation(r.rotateEvery))
+		defer rotation.Stop()
 
-	key := r.getKey()
+		rotate = rotation.C
+	}
+
+	teardown := r.workload.teardown
+	if teardown == nil {
+		teardown = (*Runner).delete
+	}
 
-	suffix := 1
-	ticker := time.NewTicker(r.interval)
+	killed := false
 
 	defer func() {
-		r.delete()
 		ticker.Stop()
+		r.stopBatchWorkers(!killed)
+
+		if killed {
+			// a crashed client doesn't clean up anything, its connections
+			// are just gone
+			if r.transport != nil {
+				r.transport.CloseIdleConnections()
+			}
+
+			if r.readTransport != nil {
+				r.readTransport.CloseIdleConnections()
+			}
+
+			if r.watchCancel != nil {
+				r.watchCancel()
+			}
+
+			return
+		}
+
+		if r.keys != nil {
+			r.keys.remove(r.index)
+		}
+
+		// the works are deleted once their resources are seen, or not, on
+		// the spoke
+		if r.spokeWaits != nil {
+			r.spokeWaits.Wait()
+		}
+
+		r.shuttingDown()
+		teardown(r)
 	}()
 
 	for {
@@ -413,43 +1803,134 @@ func (r *Runner) apply() {
 			r.logger.Info(fmt.Sprintf("stop and delete %s", r.name))
 			return
 
-		case <-ticker.C:
-			if r.update {
-				if err := r.Client.Get(ctx, key, r.template); err != nil {
-					r.logger.Error(err, "failed to Get")
+		case <-r.killCh:
+			r.logger.Info(fmt.Sprintf("killed %s", r.name))
+			killed = true
+			return
 
-					continue
-				}
+		case <-r.quitCh:
+			r.logger.Info(fmt.Sprintf("retire and delete %s", r.name))
+			return
 
-				if !r.update {
-					continue
-				}
+		case <-rotate:
+			if err := r.rotateCredentials(); err != nil {
+				r.logger.Error(err, "failed to rotate the credentials")
+			}
 
-				originalIns := r.template.DeepCopy()
+			rotation.Reset(untilRotation(r.rotateEvery))
 
-				labels := r.template.GetLabels()
+			continue
 
-				if labels == nil {
-					labels = map[string]string{}
-				}
+		case <-ticker.C:
+			if s := r.scale.get(); s != scale {
+				scale = s
+				ticker.Reset(scaleInterval(r.interval, scale))
+			}
 
-				// Update the ReplicaSet
-				labels["hello"] = fmt.Sprintf("world-%v", suffix)
-				suffix += 1
+			// the workers tick the objects, and beat, on their own
+			if r.batchQueue != nil {
+				r.dispatchBatch(seq)
+				seq += 1
 
-				r.template.SetLabels(labels)
+				continue
+			}
 
-				if err := r.Client.Patch(context.TODO(), r.template, client.MergeFrom(originalIns)); err != nil {
-					r.logger.Error(err, "failed to update")
-				}
+			// only the template objects have a TTL
+			if r.workload.setup == nil {
+				r.forBatch(func(m *Runner) {
+					if m.expired() {
+						m.recreate()
+					}
+				})
 			}
 
-			// test SelfSubjectAccessReview since you can't update the SSAR... so let's keep GET it
-			if err := r.create(); err != nil {
-				if !k8serrors.IsAlreadyExists(err) {
-					r.logger.Error(err, fmt.Sprintf("failed to create manifestwork: %s ", r.getKey()))
-				}
+			if r.workload.setup == nil && r.injectMalformed() {
+				r.malformedTick(seq)
+				seq += 1
+				r.beat()
+
+				continue
+			}
+
+			if r.workload.setup == nil && r.injectCollision() {
+				r.collideTick()
+				seq += 1
+				r.beat()
+
+				continue
 			}
+
+			r.forBatch(func(m *Runner) {
+				r.workload.tick(m, seq)
+			})
+			seq += 1
+		}
+
+		r.beat()
+	}
+}
+
+// updateTick keeps patching the object's label and re-creating it, this is
+// the default workload.
+func (r *Runner) updateTick(seq int) {
+	ctx := r.context()
+
+	if r.update {
+		key, other := r.pickTarget()
+
+		suffix := ""
+		if other {
+			suffix = "-skewed"
+		}
+
+		if r.updateStrategy != strategyPatch {
+			r.strategyTick(ctx, key, suffix, seq)
+		} else if !r.patchTick(ctx, key, suffix, seq) {
+			return
+		}
+	}
+
+	// test SelfSubjectAccessReview since you can't update the SSAR... so let's keep GET it
+	// the object is re-created in case it's gone, it's there most of the time
+	if err := r.createAs("recreate", outcomeIgnore); err != nil {
+		if !k8serrors.IsAlreadyExists(err) && !errors.Is(err, errLimitReached) {
+			r.logger.Error(err, fmt.Sprintf("failed to create manifestwork: %s ", r.getKey()))
 		}
 	}
 }
+
+// patchTick gets the object of key and patches a label with r.patchType, it
+// returns false if the object couldn't be read.
+func (r *Runner) patchTick(ctx context.Context, key types.NamespacedName, suffix string, seq int) bool {
+	// the object read isn't kept, the runners only hold the metadata
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(r.template.GroupVersionKind())
+
+	if err := r.metrics.Time("get"+suffix, func() error {
+		return r.Client.Get(ctx, key, obj)
+	}); err != nil {
+		r.logger.Error(err, "failed to Get")
+
+		return false
+	}
+
+	pt := pickPatchType(r.patchType, seq)
+
+	annotations, stamp := r.stamp(key.String(), obj)
+
+	patch, err := labelPatch(pt, obj, "hello", fmt.Sprintf("world-%v", seq), annotations)
+	if err != nil {
+		r.logger.Error(err, "failed to build patch")
+		return true
+	}
+
+	if err := r.metrics.Time("patch/"+pt+suffix, func() error {
+		return r.Client.Patch(ctx, obj, patch)
+	}); err != nil {
+		r.logger.Error(err, "failed to update")
+	} else {
+		r.stamped(key.String(), stamp)
+	}
+
+	return true
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	malformedSchema    = "schema"
+	malformedOversized = "oversized"
+	malformedFieldType = "field-type"
+)
+
+var malformedKinds = []string{malformedSchema, malformedOversized, malformedFieldType}
+
+// malformedTick creates an invalid copy of the template, rotating through a
+// schema violation, a payload over the etcd request limit and a bad field
+// type, and records how long the apiserver takes to reject it.
+func (r *Runner) malformedTick(seq int) {
+	kind := malformedKinds[seq%len(malformedKinds)]
+
+	obj := r.object()
+	obj.SetName(fmt.Sprintf("%s-malformed-%v", r.template.GetName(), seq))
+	obj.SetResourceVersion("")
+	obj.SetUID("")
+	obj.SetManagedFields(nil)
+
+	switch kind {
+	case malformedSchema:
+		// spec is an object for any sane schema
+		obj.Object["spec"] = "load-simulator"
+
+	case malformedOversized:
+		annotations := obj.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+
+		annotations["load-simulator/padding"] = strings.Repeat("x", r.malformedSize)
+		obj.SetAnnotations(annotations)
+
+	case malformedFieldType:
+		meta, _ := obj.Object["metadata"].(map[string]interface{})
+		meta["labels"] = map[string]interface{}{"load-simulator": int64(seq)}
+	}
+
+	ctx := r.context()
+
+	start := time.Now()
+	err := r.Client.Create(ctx, obj)
+	d := time.Since(start)
+
+	if err != nil {
+		r.metrics.Observe(fmt.Sprintf("malformed/%s-rejected", kind), d, nil)
+		return
+	}
+
+	// it shouldn't get in, make it an error in the report and clean it up
+	r.metrics.Observe(fmt.Sprintf("malformed/%s-accepted", kind), d, fmt.Errorf("accepted"))
+
+	if err := r.Client.Delete(ctx, obj); err != nil {
+		r.logger.Error(err, fmt.Sprintf("failed to delete accepted malformed object %s", obj.GetName()))
+	}
+}
+
+// injectMalformed tells whether this tick sends a malformed request instead.
+func (r *Runner) injectMalformed() bool {
+	return r.malformedPercent > 0 && r.random().Float64()*100 < r.malformedPercent
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	clusterChurnLabels = "labels"
+	clusterChurnClaims = "claims"
+	clusterChurnBoth   = "both"
+
+	// clusterChurnKey is the label and the claim the cluster-churn mode
+	// rotates, for the placements to select on
+	clusterChurnKey = "load-simulator/churn"
+
+	clusterSetLabel = "cluster.open-cluster-management.io/clusterset"
+)
+
+var managedClusterGVK = schema.GroupVersionKind{Group: "cluster.open-cluster-management.io", Version: "v1", Kind: "ManagedCluster"}
+
+func validateClusterChurn(s string) error {
+	switch s {
+	case clusterChurnLabels, clusterChurnClaims, clusterChurnBoth:
+		return nil
+	}
+
+	return fmt.Errorf("unknown cluster churn %q, expecting %s|%s|%s", s, clusterChurnLabels, clusterChurnClaims, clusterChurnBoth)
+}
+
+// managedCluster is the ManagedCluster of the runner, labeled with the value
+// of clusterChurnKey.
+func (r *Runner) managedCluster(value string) *unstructured.Unstructured {
+	labels := map[string]string{clusterChurnKey: value}
+	if r.clusterSet != "" {
+		labels[clusterSetLabel] = r.clusterSet
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(managedClusterGVK)
+	obj.SetName(fmt.Sprintf("load-simulator-cluster-%v", r.index))
+	obj.SetLabels(r.labels(labels))
+
+	return obj
+}
+
+func (r *Runner) clusterChurnValue(seq int) string {
+	return fmt.Sprintf("v%v", seq%r.clusterChurnValues)
+}
+
+// clusterSetup creates the ManagedCluster of the runner. The hub doesn't
+// accept it, so the registration controller leaves it alone and no cluster
+// namespace is created, but the placements still see it.
+func (r *Runner) clusterSetup() error {
+	obj := r.managedCluster(r.clusterChurnValue(0))
+	if err := unstructured.SetNestedField(obj.Object, false, "spec", "hubAcceptsClient"); err != nil {
+		return err
+	}
+
+	if err := r.createObject(r.context(), "cluster/create", obj, r.onAlreadyExists); err != nil {
+		return fmt.Errorf("failed to create ManagedCluster %s, error: %w", obj.GetName(), err)
+	}
+
+	return nil
+}
+
+// clusterTick rotates the label, the claim or both of the ManagedCluster
+// through r.clusterChurnValues values, reported as cluster/label and
+// cluster/claim. Each change may move the cluster in or out of every placement
+// selecting on it, and the placement controller recomputes their decisions.
+func (r *Runner) clusterTick(seq int) {
+	value := r.clusterChurnValue(seq)
+
+	if r.clusterChurn != clusterChurnClaims {
+		obj := r.managedCluster(r.clusterChurnValue(seq - 1))
+
+		patch, err := labelPatch(patchMerge, obj, clusterChurnKey, value, nil)
+		if err != nil {
+			r.logger.Error(err, "failed to build the label patch")
+			return
+		}
+
+		if err := r.metrics.Time("cluster/label", func() error {
+			return r.Client.Patch(r.context(), obj, patch)
+		}); err != nil {
+			r.logger.Error(err, fmt.Sprintf("failed to update the labels of %s", obj.GetName()))
+		}
+	}
+
+	if r.clusterChurn != clusterChurnLabels {
+		// what the registration agent reports from the ClusterClaims of the
+		// managed cluster
+		patch, err := json.Marshal(map[string]interface{}{
+			"status": map[string]interface{}{
+				"clusterClaims": []interface{}{
+					map[string]interface{}{"name": clusterChurnKey, "value": value},
+				},
+			},
+		})
+		if err != nil {
+			r.logger.Error(err, "failed to marshal the cluster claims")
+			return
+		}
+
+		obj := r.managedCluster(value)
+		if err := r.metrics.Time("cluster/claim", func() error {
+			return r.Client.Status().Patch(r.context(), obj, client.RawPatch(types.MergePatchType, patch))
+		}); err != nil {
+			r.logger.Error(err, fmt.Sprintf("failed to update the claims of %s", obj.GetName()))
+		}
+	}
+}
+
+// clusterTeardown deletes the ManagedCluster, the runner created no
+// namespace.
+func (r *Runner) clusterTeardown() {
+	if r.fastClean {
+		return
+	}
+
+	obj := r.managedCluster("")
+	if err := r.Client.Delete(r.context(), obj); err != nil && !k8serrors.IsNotFound(err) {
+		r.logger.Error(err, fmt.Sprintf("failed to delete ManagedCluster %s", obj.GetName()))
+	}
+}
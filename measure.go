@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	restclient "k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// observedQuantile is the quantile of the time from the creation of an object
+// to its first watch event.
+const observedQuantile = "Observed"
+
+// latencyMetrics are the metrics a latency threshold can check, named after
+// the fields of LatencyQuantiles.
+var latencyMetrics = map[string]func(LatencyQuantiles) int64{
+	"P50": func(q LatencyQuantiles) int64 { return q.P50 },
+	"P95": func(q LatencyQuantiles) int64 { return q.P95 },
+	"P99": func(q LatencyQuantiles) int64 { return q.P99 },
+	"Max": func(q LatencyQuantiles) int64 { return q.Max },
+	"Avg": func(q LatencyQuantiles) int64 { return q.Avg },
+}
+
+// LatencyQuantiles are the latencies, in milliseconds, from the creation of
+// the objects of a kind to a point of their lifecycle, their first watch
+// event for the Observed quantile, a status condition turning True for the
+// others, shaped like the quantiles of the kube-burner latency measurements.
+type LatencyQuantiles struct {
+	QuantileName string `json:"quantileName"`
+	Kind         string `json:"kind"`
+	Count        int    `json:"count"`
+	P50          int64  `json:"P50"`
+	P95          int64  `json:"P95"`
+	P99          int64  `json:"P99"`
+	Max          int64  `json:"max"`
+	Avg          int64  `json:"avg"`
+}
+
+// latencyThreshold is an item of -object-latency-thresholds, e.g.
+// Ready:P99=2s, the kube-burner threshold with its conditionType, metric and
+// threshold.
+type latencyThreshold struct {
+	conditionType string
+	metric        string
+	threshold     time.Duration
+}
+
+// ThresholdResult compares the worst value of the metric of a quantile over
+// the kinds with its threshold.
+type ThresholdResult struct {
+	ConditionType string        `json:"conditionType"`
+	Metric        string        `json:"metric"`
+	Threshold     time.Duration `json:"threshold"`
+	Value         time.Duration `json:"value"`
+	Met           bool          `json:"met"`
+}
+
+// parseLatencyThresholds parses the comma separated
+// <quantile name>:<metric>=<duration>, e.g. Observed:P95=500ms,Ready:P99=2s.
+func parseLatencyThresholds(s string) ([]latencyThreshold, error) {
+	out := []latencyThreshold{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		kv := strings.SplitN(item, "=", 2)
+		name := strings.SplitN(kv[0], ":", 2)
+		if len(kv) != 2 || len(name) != 2 || name[0] == "" {
+			return nil, fmt.Errorf("invalid latency threshold %q, expecting <condition type or %s>:<metric>=<duration>", item, observedQuantile)
+		}
+
+		if _, ok := latencyMetrics[name[1]]; !ok {
+			return nil, fmt.Errorf("invalid latency threshold %q, unknown metric %q, expecting P50|P95|P99|Max|Avg", item, name[1])
+		}
+
+		d, err := time.ParseDuration(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid latency threshold %q, error: %w", item, err)
+		}
+
+		out = append(out, latencyThreshold{conditionType: name[0], metric: name[1], threshold: d})
+	}
+
+	return out, nil
+}
+
+// objectLatency is what the measurement saw of an object.
+type objectLatency struct {
+	kind     string
+	created  time.Time
+	observed bool
+	// conditions are the condition types seen True already
+	conditions map[string]bool
+}
+
+// latencyMeasurement watches the objects of the run of the template kinds,
+// across the namespaces, and records how long after their creation they're
+// seen by a watch and their conditions turn True. The creation and the
+// transition timestamps have a second precision, like in kube-burner, and the
+// Observed latency compares the clock of the apiserver with the local one.
+type latencyMeasurement struct {
+	kinds      []schema.GroupVersionKind
+	selector   labels.Selector
+	conditions []string
+	start      time.Time
+	logger     logr.Logger
+
+	mu        sync.Mutex
+	objects   map[types.UID]*objectLatency
+	latencies map[string]map[string][]time.Duration
+}
+
+func (o *options) startLatencyMeasurement(config *restclient.Config, logger logr.Logger, stop <-chan struct{}, wg *sync.WaitGroup) (*latencyMeasurement, error) {
+	selector, err := o.runSelector()
+	if err != nil {
+		return nil, err
+	}
+
+	wc, err := client.NewWithWatch(config, client.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watch client, error: %w", err)
+	}
+
+	m := &latencyMeasurement{
+		kinds:      o.templateKinds(),
+		selector:   selector,
+		conditions: o.latencyConditions,
+		// the creation timestamps are truncated to the second
+		start:     time.Now().Truncate(time.Second),
+		logger:    logger,
+		objects:   map[types.UID]*objectLatency{},
+		latencies: map[string]map[string][]time.Duration{},
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		<-stop
+		cancel()
+	}()
+
+	for _, gvk := range m.kinds {
+		wg.Add(1)
+
+		go func(gvk schema.GroupVersionKind) {
+			defer wg.Done()
+
+			m.watch(ctx, wc, gvk)
+		}(gvk)
+	}
+
+	return m, nil
+}
+
+// watch follows the objects of gvk until ctx is done, resuming after the
+// apiserver closes the watch.
+func (m *latencyMeasurement) watch(ctx context.Context, wc client.WithWatch, gvk schema.GroupVersionKind) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(gvk)
+
+	rv := ""
+
+	for ctx.Err() == nil {
+		w, err := wc.Watch(ctx, list,
+			client.MatchingLabelsSelector{Selector: m.selector},
+			&client.ListOptions{Raw: &metav1.ListOptions{ResourceVersion: rv}},
+		)
+		if err != nil {
+			m.logger.Error(err, fmt.Sprintf("failed to watch %s for the latency measurement", gvk.Kind))
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+
+			continue
+		}
+
+		for ev := range w.ResultChan() {
+			if ev.Type == watch.Error {
+				// the events in between are gone, the objects are listed
+				// again
+				rv = ""
+				break
+			}
+
+			obj, ok := ev.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+
+			rv = obj.GetResourceVersion()
+
+			if ev.Type == watch.Added || ev.Type == watch.Modified {
+				m.observe(obj, time.Now())
+			}
+		}
+
+		w.Stop()
+	}
+}
+
+func (m *latencyMeasurement) observe(obj *unstructured.Unstructured, now time.Time) {
+	created := obj.GetCreationTimestamp().Time
+	if created.Before(m.start) {
+		// created before the run, e.g. by a previous run with the same ID
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, ok := m.objects[obj.GetUID()]
+	if !ok {
+		o = &objectLatency{kind: obj.GetKind(), created: created, conditions: map[string]bool{}}
+		m.objects[obj.GetUID()] = o
+	}
+
+	if !o.observed {
+		o.observed = true
+		m.record(o.kind, observedQuantile, now.Sub(created))
+	}
+
+	for _, t := range m.conditions {
+		if o.conditions[t] || !conditionTrue(obj, t) {
+			continue
+		}
+
+		o.conditions[t] = true
+
+		at := now
+		if transition, ok := conditionTransition(obj, t); ok {
+			at = transition
+		}
+
+		m.record(o.kind, t, at.Sub(created))
+	}
+}
+
+func (m *latencyMeasurement) record(kind, quantile string, d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+
+	if m.latencies[kind] == nil {
+		m.latencies[kind] = map[string][]time.Duration{}
+	}
+
+	m.latencies[kind][quantile] = append(m.latencies[kind][quantile], d)
+}
+
+// conditionTransition is the lastTransitionTime of the condition t of obj.
+func conditionTransition(obj *unstructured.Unstructured, t string) (time.Time, bool) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		m, ok := c.(map[string]interface{})
+		if !ok || m["type"] != t {
+			continue
+		}
+
+		s, _ := m["lastTransitionTime"].(string)
+		at, err := time.Parse(time.RFC3339, s)
+
+		return at, err == nil
+	}
+
+	return time.Time{}, false
+}
+
+// quantiles of each kind, Observed first, then the conditions in the order of
+// -object-latency-conditions.
+func (m *latencyMeasurement) quantiles() []LatencyQuantiles {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kinds := []string{}
+	for kind := range m.latencies {
+		kinds = append(kinds, kind)
+	}
+
+	sort.Strings(kinds)
+
+	out := []LatencyQuantiles{}
+	for _, kind := range kinds {
+		for _, name := range append([]string{observedQuantile}, m.conditions...) {
+			l := append([]time.Duration{}, m.latencies[kind][name]...)
+			if len(l) == 0 {
+				continue
+			}
+
+			sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+
+			var total time.Duration
+			for _, d := range l {
+				total += d
+			}
+
+			out = append(out, LatencyQuantiles{
+				QuantileName: name,
+				Kind:         kind,
+				Count:        len(l),
+				P50:          percentile(l, 0.50).Milliseconds(),
+				P95:          percentile(l, 0.95).Milliseconds(),
+				P99:          percentile(l, 0.99).Milliseconds(),
+				Max:          percentile(l, 1).Milliseconds(),
+				Avg:          (total / time.Duration(len(l))).Milliseconds(),
+			})
+		}
+	}
+
+	return out
+}
+
+// checkLatencyThresholds compares the worst value of each threshold over the
+// kinds, a quantile without any latency doesn't meet its threshold.
+func checkLatencyThresholds(thresholds []latencyThreshold, quantiles []LatencyQuantiles) []ThresholdResult {
+	out := []ThresholdResult{}
+	for _, t := range thresholds {
+		res := ThresholdResult{ConditionType: t.conditionType, Metric: t.metric, Threshold: t.threshold}
+
+		seen := false
+		for _, q := range quantiles {
+			if q.QuantileName != t.conditionType {
+				continue
+			}
+
+			seen = true
+			if v := time.Duration(latencyMetrics[t.metric](q)) * time.Millisecond; v > res.Value {
+				res.Value = v
+			}
+		}
+
+		res.Met = seen && res.Value <= t.threshold
+		out = append(out, res)
+	}
+
+	return out
+}
+
+func logLatencyQuantiles(logger logr.Logger, quantiles []LatencyQuantiles, results []ThresholdResult) {
+	for _, q := range quantiles {
+		logger.Info(fmt.Sprintf("%s %s: count=%v P50=%vms P95=%vms P99=%vms max=%vms avg=%vms", q.Kind, q.QuantileName, q.Count, q.P50, q.P95, q.P99, q.Max, q.Avg))
+	}
+
+	for _, r := range results {
+		if !r.Met {
+			logger.Error(fmt.Errorf("%s %v over the %v threshold", r.Metric, r.Value, r.Threshold), fmt.Sprintf("%s latency is over its threshold", r.ConditionType))
+			continue
+		}
+
+		logger.Info(fmt.Sprintf("%s latency: %s %v within the %v threshold", r.ConditionType, r.Metric, r.Value, r.Threshold))
+	}
+}
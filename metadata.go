@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"runtime"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+// secretFlags are masked in the effective configuration of the report: the
+// tokens and the key paths are redacted, the headers keep their key, e.g.
+// Authorization, and the URLs lose their userinfo.
+var secretFlags = map[string]func(string) string{
+	"pprof-token":      redact,
+	"konnectivity-key": redact,
+	"header":           redactHeader,
+	"proxy-url":        redactUserinfo,
+}
+
+func redact(v string) string {
+	if v == "" {
+		return v
+	}
+
+	return "<redacted>"
+}
+
+// redactHeader redacts the value of a "Key: Value" header.
+func redactHeader(v string) string {
+	kv := strings.SplitN(v, ":", 2)
+	if len(kv) != 2 {
+		return redact(v)
+	}
+
+	return kv[0] + ": <redacted>"
+}
+
+func redactUserinfo(v string) string {
+	u, err := url.Parse(v)
+	if err != nil {
+		return redact(v)
+	}
+
+	if u.User == nil {
+		return v
+	}
+
+	u.User = nil
+
+	return u.String()
+}
+
+// maskFlag is the value of the flag, masked if it's a secret one.
+func maskFlag(f *flag.Flag) string {
+	mask, ok := secretFlags[f.Name]
+	if !ok {
+		return f.Value.String()
+	}
+
+	// each header is masked on its own
+	if headers, ok := f.Value.(*headerList); ok {
+		out := []string{}
+		for _, h := range *headers {
+			out = append(out, mask(h.key+": "+h.value))
+		}
+
+		return strings.Join(out, ", ")
+	}
+
+	return mask(f.Value.String())
+}
+
+// RunMetadata is the context of a run, reports without it can't be compared
+// months later.
+type RunMetadata struct {
+	Simulator     string `json:"simulator"`
+	BuildDate     string `json:"buildDate"`
+	GoVersion     string `json:"goVersion"`
+	Server        string `json:"server"`
+	ServerVersion string `json:"serverVersion,omitempty"`
+	Nodes         int    `json:"nodes,omitempty"`
+	// APIServerFlags are the flags of the kube-apiserver pods, they're only
+	// discoverable on clusters running it as static pods, e.g. kubeadm or
+	// OpenShift.
+	APIServerFlags map[string][]string `json:"apiServerFlags,omitempty"`
+	// Config is the value of every flag of the run, the presets applied.
+	Config map[string]string `json:"config"`
+}
+
+// effectiveConfig returns the value of every flag.
+func effectiveConfig(fs *flag.FlagSet) map[string]string {
+	out := map[string]string{}
+	fs.VisitAll(func(f *flag.Flag) {
+		out[f.Name] = maskFlag(f)
+	})
+
+	return out
+}
+
+// collectMetadata fills what the cluster tells, a failure only leaves the
+// corresponding fields empty.
+func collectMetadata(ctx context.Context, config *restclient.Config, effective map[string]string) (*RunMetadata, error) {
+	m := &RunMetadata{
+		Simulator: simulatorVersion(),
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Server:    config.Host,
+		Config:    effective,
+	}
+
+	cs, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return m, fmt.Errorf("failed to create clientset, error: %w", err)
+	}
+
+	errs := []string{}
+
+	if v, err := cs.Discovery().ServerVersion(); err != nil {
+		errs = append(errs, fmt.Sprintf("failed to get the server version, error: %v", err))
+	} else {
+		m.ServerVersion = v.GitVersion
+	}
+
+	if nodes, err := cs.CoreV1().Nodes().List(ctx, metav1.ListOptions{}); err != nil {
+		errs = append(errs, fmt.Sprintf("failed to list the nodes, error: %v", err))
+	} else {
+		m.Nodes = len(nodes.Items)
+	}
+
+	// not finding them is the norm on managed clusters
+	pods, err := cs.CoreV1().Pods("kube-system").List(ctx, metav1.ListOptions{LabelSelector: "component=kube-apiserver"})
+	if err == nil && len(pods.Items) != 0 {
+		m.APIServerFlags = map[string][]string{}
+		for _, c := range pods.Items[0].Spec.Containers {
+			if c.Name == "kube-apiserver" {
+				m.APIServerFlags[c.Name] = append(append([]string{}, c.Command...), c.Args...)
+			}
+		}
+	}
+
+	if len(errs) != 0 {
+		return m, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return m, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// Metrics collects client side latencies keyed by operation, e.g.
+// "patch/merge", so a run can compare different request shapes against each
+// other.
+type Metrics struct {
+	// prefix is prepended to the operations of a scoped Metrics
+	prefix string
+	store  *metricStore
+}
+
+type metricStore struct {
+	mu     sync.Mutex
+	series map[string]*series
+	// count is the number of observations of all the operations
+	count int
+}
+
+type series struct {
+	latencies []time.Duration
+	errors    int
+}
+
+// Summary is the aggregated view of a single operation.
+type Summary struct {
+	Op     string        `json:"op"`
+	Count  int           `json:"count"`
+	Errors int           `json:"errors"`
+	Mean   time.Duration `json:"mean"`
+	P50    time.Duration `json:"p50"`
+	P90    time.Duration `json:"p90"`
+	P99    time.Duration `json:"p99"`
+	Max    time.Duration `json:"max"`
+	// Tags are the -tags of the run, set on the live metrics
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{store: &metricStore{series: map[string]*series{}}}
+}
+
+// Scoped returns a Metrics recording into the same store, with the operations
+// prefixed by "<scope>:", e.g. "agent:patch/merge".
+func (m *Metrics) Scoped(scope string) *Metrics {
+	return &Metrics{prefix: m.prefix + scope + ":", store: m.store}
+}
+
+func (m *Metrics) Observe(op string, d time.Duration, err error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	op = m.prefix + op
+
+	s, ok := m.store.series[op]
+	if !ok {
+		s = &series{}
+		m.store.series[op] = s
+	}
+
+	s.latencies = append(s.latencies, d)
+	if err != nil {
+		s.errors += 1
+	}
+
+	m.store.count += 1
+}
+
+// Count is the number of observations so far, whatever the scope of m.
+func (m *Metrics) Count() int {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	return m.store.count
+}
+
+// Time runs f and records its latency under op.
+func (m *Metrics) Time(op string, f func() error) error {
+	start := time.Now()
+	err := f()
+	m.Observe(op, time.Since(start), err)
+
+	return err
+}
+
+// Summary covers the whole store, whatever the scope of m.
+func (m *Metrics) Summary() []Summary {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	out := []Summary{}
+	for op, s := range m.store.series {
+		l := append([]time.Duration{}, s.latencies...)
+		sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+
+		var total time.Duration
+		for _, d := range l {
+			total += d
+		}
+
+		var mean time.Duration
+		if len(l) != 0 {
+			mean = total / time.Duration(len(l))
+		}
+
+		out = append(out, Summary{
+			Op:     op,
+			Count:  len(l),
+			Errors: s.errors,
+			Mean:   mean,
+			P50:    percentile(l, 0.50),
+			P90:    percentile(l, 0.90),
+			P99:    percentile(l, 0.99),
+			Max:    percentile(l, 1),
+		})
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Op < out[j].Op })
+
+	return out
+}
+
+func (m *Metrics) Report(logger logr.Logger) {
+	for _, s := range m.Summary() {
+		logger.Info(fmt.Sprintf("%s: count=%v errors=%v mean=%v p50=%v p90=%v p99=%v max=%v",
+			s.Op, s.Count, s.Errors, s.Mean, s.P50, s.P90, s.P99, s.Max))
+	}
+}
+
+// percentile expects sorted input.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	idx := int(float64(len(sorted))*p+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+
+	return sorted[idx]
+}
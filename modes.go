@@ -0,0 +1,193 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// runnerLabel is set on cluster scoped objects, to tell which runner created
+// them.
+const runnerLabel = "load-simulator/runner"
+
+// workload is what a Runner does once its client is configured.
+type workload struct {
+	// setup runs once before the first tick, it defaults to creating the
+	// template and its namespace.
+	setup func(r *Runner) error
+	// tick runs every interval until the run stops, seq starts from 1.
+	tick func(r *Runner, seq int)
+	// teardown runs once the run stops, it defaults to deleting the template
+	// and its namespace.
+	teardown func(r *Runner)
+	// template tells a custom setup still creates the template.
+	template bool
+	// verbs are the requests of a tick, they only describe the workload in
+	// the plan.
+	verbs map[string]float64
+	// periodic are the requests of each client every period rather than
+	// every tick, e.g. the waves of a rollout, they only describe the
+	// workload in the plan too.
+	periodic func(o *options) (time.Duration, map[string]float64)
+	// batch tells the tick can drive several objects of a runner, see
+	// -batch-size.
+	batch bool
+	// shared tells the runners work on one object, which needs
+	// -namespace-layout shared.
+	shared bool
+}
+
+// workloads maps the -mode flag to the workload.
+var workloads = map[string]workload{
+	"update": {
+		tick:  (*Runner).updateTick,
+		verbs: map[string]float64{"get": 1, "patch": 1, "create": 1},
+		batch: true,
+	},
+	"apply-managers": {
+		tick:  (*Runner).applyManagersTick,
+		verbs: map[string]float64{"apply": 1},
+		batch: true,
+	},
+	"webhook": {
+		tick:  (*Runner).webhookTick,
+		verbs: map[string]float64{"create (dry-run)": 1},
+		batch: true,
+	},
+	"csr": {
+		setup:    (*Runner).csrSetup,
+		tick:     (*Runner).csrTick,
+		teardown: (*Runner).csrTeardown,
+		verbs:    map[string]float64{"create": 1, "update (approval, with an approver)": 1},
+	},
+	"crd-churn": {
+		setup:    (*Runner).skipSetup,
+		tick:     (*Runner).crdTick,
+		teardown: (*Runner).crdTeardown,
+		verbs:    map[string]float64{"create": 0.5, "delete": 0.5, "get (discovery, until visible)": 1},
+	},
+	"discovery": {
+		setup:    (*Runner).skipSetup,
+		tick:     (*Runner).discoveryTick,
+		teardown: (*Runner).skipTeardown,
+		verbs:    map[string]float64{"get (discovery document)": 1},
+	},
+	"stream": {
+		setup:    (*Runner).streamSetup,
+		tick:     (*Runner).streamTick,
+		teardown: (*Runner).streamTeardown,
+		verbs:    map[string]float64{"get (stream traffic)": 1},
+	},
+	"watch-lag": {
+		setup:    (*Runner).watchLagSetup,
+		tick:     (*Runner).watchLagTick,
+		teardown: (*Runner).watchLagTeardown,
+		template: true,
+		verbs:    map[string]float64{"patch": 1, "watch (event)": 1},
+	},
+	"slow-watch": {
+		setup:    (*Runner).slowWatchSetup,
+		tick:     (*Runner).slowWatchTick,
+		teardown: (*Runner).slowWatchTeardown,
+		template: true,
+		verbs:    map[string]float64{"patch": 1, "watch (event, read at watch-consume-rate)": 1},
+	},
+	"fanout": {
+		setup:    (*Runner).fanoutSetup,
+		tick:     (*Runner).fanoutTick,
+		teardown: (*Runner).fanoutTeardown,
+		verbs:    map[string]float64{"watch (event)": 1},
+		shared:   true,
+	},
+	"rollout": {
+		setup:    (*Runner).rolloutSetup,
+		tick:     (*Runner).rolloutTick,
+		teardown: (*Runner).rolloutTeardown,
+		periodic: func(o *options) (time.Duration, map[string]float64) {
+			works := float64(o.rolloutWorks)
+			return time.Duration(o.rolloutEvery) * time.Second, map[string]float64{"create (each wave)": works, "delete (the previous wave)": works}
+		},
+	},
+	"placement-churn": {
+		setup:    (*Runner).placementSetup,
+		tick:     (*Runner).placementTick,
+		teardown: (*Runner).placementTeardown,
+		verbs:    map[string]float64{"patch (status)": 1},
+	},
+	"lifecycle": {
+		setup:    (*Runner).lifecycleSetup,
+		tick:     (*Runner).lifecycleTick,
+		teardown: (*Runner).lifecycleTeardown,
+		verbs:    map[string]float64{"create": 1, "get (wait steps, until the condition)": 1, "patch (patch steps)": 1, "delete": 1},
+	},
+	"target": {
+		setup:    (*Runner).skipSetup,
+		tick:     (*Runner).targetTick,
+		teardown: (*Runner).skipTeardown,
+		verbs:    map[string]float64{"get, patch or delete (target-verbs in rotation)": 1},
+	},
+	"cluster-churn": {
+		setup:    (*Runner).clusterSetup,
+		tick:     (*Runner).clusterTick,
+		teardown: (*Runner).clusterTeardown,
+		verbs:    map[string]float64{"patch": 1},
+	},
+	"status-feedback": {
+		tick:  (*Runner).feedbackTick,
+		verbs: map[string]float64{"patch (status)": 1},
+	},
+	"resync-storm": {
+		tick: (*Runner).resyncTick,
+		// the first client lists the objects of its namespace and patches
+		// each of them, all of them with the shared namespace
+		periodic: func(o *options) (time.Duration, map[string]float64) {
+			first := 1 / math.Max(float64(o.concurrent), 1)
+			if o.namespaceLayout == namespaceShared {
+				return time.Duration(o.resyncInterval) * time.Minute, map[string]float64{"list (each storm, the first client)": first, "patch (each storm, every object)": 1}
+			}
+
+			return time.Duration(o.resyncInterval) * time.Minute, map[string]float64{"list (each storm, the first client)": first, "patch (each storm, the first object)": first}
+		},
+	},
+	"cached-get": {
+		tick:  (*Runner).cachedGetTick,
+		verbs: map[string]float64{"get": 1, "list": 1},
+	},
+	"bind": {
+		setup: (*Runner).bindSetup,
+		tick:  (*Runner).bindTick,
+		verbs: map[string]float64{"create": 1, "create (binding)": 1, "delete": 1},
+	},
+	"evict": {
+		setup: (*Runner).evictSetup,
+		tick:  (*Runner).evictTick,
+		verbs: map[string]float64{"create (eviction)": 1},
+	},
+	"boundary": {
+		tick:  (*Runner).boundaryTick,
+		verbs: map[string]float64{"create": 1, "delete (accepted, about half)": 0.5},
+	},
+	"quota": {
+		setup: (*Runner).quotaSetup,
+		tick:  (*Runner).quotaTick,
+		verbs: map[string]float64{"create": 1, "delete": 1},
+	},
+}
+
+func workloadNames() []string {
+	out := []string{}
+	for name := range workloads {
+		out = append(out, name)
+	}
+
+	sort.Strings(out)
+
+	return out
+}
+
+// skipSetup is for workloads which don't need the template in the cluster.
+func (r *Runner) skipSetup() error {
+	return nil
+}
+
+func (r *Runner) skipTeardown() {}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+)
+
+const (
+	nameSequential = "sequential"
+	nameRandom     = "random"
+	nameUUID       = "uuid"
+	nameHash       = "hash"
+)
+
+func validateNameStrategy(s string) error {
+	switch s {
+	case nameSequential, nameRandom, nameUUID, nameHash:
+		return nil
+	}
+
+	return fmt.Errorf("unknown name strategy %q, expecting %s|%s|%s|%s", s, nameSequential, nameRandom, nameUUID, nameHash)
+}
+
+// objectName returns the name of the object of runner idx. The etcd key
+// locality and the watch cache behave differently with dense sequential keys
+// and scattered random ones. The random and uuid names are derived from the
+// run ID, so a clean up with the same run ID finds them.
+func objectName(strategy, prefix, runID string, idx int) string {
+	switch strategy {
+	case nameRandom:
+		h := fnv.New64a()
+		fmt.Fprintf(h, "%s/%v", runID, idx)
+
+		rnd := rand.New(rand.NewSource(int64(h.Sum64())))
+
+		const alphabet = "bcdfghjklmnpqrstvwxz2456789"
+
+		b := make([]byte, 10)
+		for i := range b {
+			b[i] = alphabet[rnd.Intn(len(alphabet))]
+		}
+
+		return fmt.Sprintf("%s-%s", prefix, b)
+
+	case nameUUID:
+		sum := sha1.Sum([]byte(fmt.Sprintf("%s/%v", runID, idx)))
+
+		// version 5, RFC 4122 variant
+		sum[6] = (sum[6] & 0x0f) | 0x50
+		sum[8] = (sum[8] & 0x3f) | 0x80
+
+		return fmt.Sprintf("%s-%x-%x-%x-%x-%x", prefix, sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+
+	case nameHash:
+		sum := sha1.Sum([]byte(fmt.Sprintf("%s-%v", prefix, idx)))
+
+		return fmt.Sprintf("%s-%x", prefix, sum[:6])
+	}
+
+	return fmt.Sprintf("%s-%v", prefix, idx)
+}
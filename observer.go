@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+// observers are a few lightweight clients sending canary GET/LIST requests at
+// a low rate during the run. Their latency is reported apart from the load:
+// if the load latency grows while the canaries stay fast, the load clients
+// are saturated rather than the apiserver.
+type observers struct {
+	clients  []kubernetes.Interface
+	interval time.Duration
+	metrics  *Metrics
+	logger   logr.Logger
+}
+
+func newObservers(config *restclient.Config, n int, interval time.Duration, runID string, logger logr.Logger) (*observers, error) {
+	o := &observers{
+		interval: interval,
+		metrics:  NewMetrics(),
+		logger:   logger,
+	}
+
+	for idx := 0; idx < n; idx++ {
+		c := restclient.CopyConfig(config)
+		c.UserAgent = fmt.Sprintf("load-simulator-observer/%s/observer-%v", runID, idx)
+		// a dialer of its own keeps client-go from sharing the transport, and
+		// so the connections, between the observers
+		c.Dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+
+		cs, err := kubernetes.NewForConfig(c)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create observer clientset, error: %w", err)
+		}
+
+		o.clients = append(o.clients, cs)
+	}
+
+	return o, nil
+}
+
+func (o *observers) run(stop <-chan struct{}, wg *sync.WaitGroup) {
+	for idx, cs := range o.clients {
+		wg.Add(1)
+
+		go func(idx int, cs kubernetes.Interface) {
+			defer wg.Done()
+
+			// spread the canaries of the observers over the interval
+			select {
+			case <-stop:
+				return
+			case <-time.After(o.interval * time.Duration(idx) / time.Duration(len(o.clients))):
+			}
+
+			ticker := time.NewTicker(o.interval)
+			defer ticker.Stop()
+
+			for seq := 0; ; seq++ {
+				ctx, cancel := context.WithTimeout(context.TODO(), o.interval)
+				o.canary(ctx, cs, seq)
+				cancel()
+
+				select {
+				case <-stop:
+					return
+				case <-ticker.C:
+				}
+			}
+		}(idx, cs)
+	}
+}
+
+// canary alternates a GET of the default namespace and a small LIST of the
+// namespaces.
+func (o *observers) canary(ctx context.Context, cs kubernetes.Interface, seq int) {
+	if seq%2 == 0 {
+		if err := o.metrics.Time("observer/get", func() error {
+			_, err := cs.CoreV1().Namespaces().Get(ctx, "default", metav1.GetOptions{})
+			return err
+		}); err != nil {
+			o.logger.V(1).Info(fmt.Sprintf("observer get failed, error: %v", err))
+		}
+
+		return
+	}
+
+	if err := o.metrics.Time("observer/list", func() error {
+		_, err := cs.CoreV1().Namespaces().List(ctx, metav1.ListOptions{Limit: 50})
+		return err
+	}); err != nil {
+		o.logger.V(1).Info(fmt.Sprintf("observer list failed, error: %v", err))
+	}
+}
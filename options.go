@@ -0,0 +1,1134 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	restclient "k8s.io/client-go/rest"
+)
+
+// options are the flags of a run, the subcommands describing a run, e.g.
+// plan, take the same flags.
+type options struct {
+	kubeconfig       string
+	concurrent       int
+	duration         int
+	interval         int
+	startJitter      int
+	clean            bool
+	pprof            bool
+	pprofAddr        string
+	pprofToken       string
+	pprofMetrics     bool
+	update           bool
+	patchType        string
+	updateStrategy   string
+	updateClasses    string
+	evictPods        int
+	evictMinAvail    int
+	bindNodeList     string
+	fanoutKind       string
+	fanoutBytes      int
+	stampWrites      bool
+	verifyObjs       bool
+	verifyMinUpdates int
+	rolloutWorks     int
+	workManifests    int
+	feedbackValues   int
+	feedbackBytes    int
+	placementChurn   float64
+	placementCount   int
+	placementPool    int
+	consumeRate      float64
+	rotateEvery      int
+	rotateAccountRef string
+	rotateAccount    types.NamespacedName
+	lifecycleSteps   string
+	lifecycle        []lifecycleStep
+	waitFor          string
+	waitReady        *waitExpr
+	waitTimeout      int
+	targetSelector   string
+	targetLabels     labels.Selector
+	targetVerbList   string
+	targetVerbs      []string
+	targetRefresh    int
+	clusterChurn     string
+	clusterValues    int
+	clusterSet       string
+	workBytes        int
+	rolloutEvery     int
+	boundarySizes    string
+	boundaryMargin   int
+	boundaryField    string
+	mode             string
+	fieldManagers    int
+	quotaHard        int
+	webhook          string
+	csrApprover      string
+	crdChurn         string
+	crdMaxVersions   int
+	discoveryTargets string
+	streamKind       string
+	streamCount      int
+	probeAPIServices string
+	probeInterval    int
+	namespaceLayout  string
+	compareLayouts   bool
+	namespacePrefix  string
+	reuseNamespaces  bool
+	precreateNs      bool
+	precreateWorkers int
+	namespaceLabels  keyValues
+	namespaceAnnos   keyValues
+	tags             keyValues
+	objectTTL        int
+	keySkew          string
+	hotKeys          int
+	hotFraction      float64
+	zipfS            float64
+	schedule         string
+	chaosInterval    int
+	chaosPercent     float64
+	chaosRespawn     int
+	reconnectAt      int
+	reconnectPause   int
+	reconnectWindow  int
+	stuckIntervals   int
+	restartStuck     bool
+	stuckDumpDir     string
+	logDedup         int
+	batchSize        int
+	batchWorkers     int
+	cachedReads      int
+	watchStaleAfter  int
+	restartFraction  float64
+	restartAt        int
+	restartEvery     int
+	spokeKubeconfig  string
+	hubs             hubList
+	tenants          tenantList
+	latencyBudget    string
+	objectLatency    bool
+	latencyConds     string
+	latencyThreshs   string
+	readQPS          float64
+	readBurst        int
+	writeQPS         float64
+	writeBurst       int
+	httpVersion      string
+	h2StrictStreams  bool
+	h2ReadIdle       int
+	compression      bool
+	throughputEvery  int
+	proxyURL         string
+	konnectivity     string
+	endpointList     string
+	endpointPolicy   string
+	konnectivityCA   string
+	konnectivityCert string
+	konnectivityKey  string
+	spokeTimeout     int
+	malformedPercent float64
+	malformedSize    int
+	collidePercent   float64
+	onAlreadyExists  string
+	onNotFound       string
+	reportPath       string
+	requestLogPath   string
+	apfAttribution   bool
+	hedgeAfter       int
+	requestLogSlower int
+	apfIdentities    string
+	apfGroups        string
+	lowPriority      bool
+	runID            string
+	userAgent        string
+	headers          headerList
+	preset           string
+	template         string
+	weights          string
+	overlays         overlayList
+	nameStrategy     string
+	cleanTimeout     int
+	fastClean        bool
+	cleanScope       string
+	stateDir         string
+	resume           string
+	shutdownTimeout  int
+	allowContexts    string
+	protectedServers string
+	confirmed        bool
+	maxObjects       int
+	maxRequests      int
+	observers        int
+	observerInterval int
+	informer         bool
+	resyncInterval   int
+	resyncWorkers    int
+
+	// parsed by complete
+	workload        workload
+	targets         []string
+	scheduleEntries []scheduleEntry
+	chaos           chaos
+	heartbeat       heartbeat
+	reconnect       reconnect
+	identities      []apfIdentity
+	identityGroups  []string
+	uaTemplate      *template.Template
+	layouts         []string
+	guard           safetyGuard
+	runIDSet        bool
+	state           *runState
+	templates       []weightedTemplate
+	effective       map[string]string
+	budgets         latencyBudgets
+	proxy           *url.URL
+	tunnel          *tunnel
+	endpoints       *endpoints
+	bindNodes       []string
+	classes         updateClasses
+	boundaries      []boundary
+
+	// latencyConditions and latencyThresholds are the parsed
+	// object-latency-conditions and object-latency-thresholds
+	latencyConditions []string
+	latencyThresholds []latencyThreshold
+}
+
+func (o *options) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.kubeconfig, "kubeconfig", os.Getenv("KUBECONFIG"), "absolute path to the kubeconfig file")
+	fs.IntVar(&o.concurrent, "concurrent", 10, "number of concurrent clients")
+	fs.IntVar(&o.duration, "duration", 10, "duration for running this test, in second")
+	fs.IntVar(&o.interval, "interval", 5, "wait interval between each update/create, in milliseconds, default is 5")
+	fs.IntVar(&o.startJitter, "start-jitter", 0, "longest random delay of the start of each client, in milliseconds, so their tickers don't tick in lockstep, e.g. the interval")
+	fs.BoolVar(&o.clean, "clean", false, "only do clean up operation")
+	fs.IntVar(&o.cleanTimeout, "clean-timeout", 120, "how long to wait for everything the run created to be gone after the clean up, in seconds, the leftovers are reported; 0 skips the check")
+	fs.BoolVar(&o.fastClean, "fast-clean", false, "clean up by collection, with DeleteAllOf by label in each namespace and parallel namespace deletes, instead of deleting each object")
+	fs.StringVar(&o.cleanScope, "clean-scope", cleanAll, "what the clean up deletes, objects|namespaces|all, objects keeps the namespaces for the next run, namespaces only deletes the namespaces along with their content")
+	fs.StringVar(&o.stateDir, "state-dir", "", "directory of the state files, <run-id>.json records the flags, the secret ones masked, the progress and the objects of each run, needed by resume")
+	fs.StringVar(&o.resume, "resume", "", "run ID of a crashed or interrupted run to resume with its flags for the rest of its duration, along with -clean it deletes every object the run recorded")
+	fs.IntVar(&o.shutdownTimeout, "shutdown-timeout", 120, "how long the clean up can take once the run stops, in seconds, its requests are canceled after that; 0 waits forever")
+	fs.BoolVar(&o.pprof, "pprof", false, "enable pprof or not")
+	fs.StringVar(&o.pprofAddr, "pprof-addr", "localhost:6060", "address of the pprof server, a non loopback address, e.g. 0.0.0.0:6060 for in-cluster runs, needs pprof-token")
+	fs.StringVar(&o.pprofToken, "pprof-token", "", "bearer token the pprof server expects, defaults to $LOAD_SIMULATOR_PPROF_TOKEN")
+	fs.BoolVar(&o.pprofMetrics, "pprof-metrics", false, "also serve the live metrics of the run as JSON on /metrics of the pprof server")
+	fs.BoolVar(&o.update, "update", true, "do continous update after creation")
+	fs.StringVar(&o.updateStrategy, "update-strategy", strategyPatch, "client pattern of the update mode, patch|update|merge-patch|json-patch-test, patch gets then patches with patch-type, update gets and updates retrying on conflicts, merge-patch patches without reading, json-patch-test gets then patches testing the resourceVersion, retrying when the test fails")
+	fs.IntVar(&o.evictPods, "evict-pods", 10, "number of pods of each client the evict mode evicts in rotation")
+	fs.IntVar(&o.evictMinAvail, "evict-min-available", 0, "minAvailable of the PodDisruptionBudget of the evict mode, the budget refuses the evictions leaving fewer running pods")
+	fs.StringVar(&o.bindNodeList, "bind-nodes", "load-simulator-node", "comma separated nodes the bind mode binds the pods to in rotation, they don't have to exist")
+	fs.StringVar(&o.fanoutKind, "fanout-kind", fanoutConfigMap, "kind of the object the fanout mode updates and all the clients watch, configmap|secret")
+	fs.IntVar(&o.fanoutBytes, "fanout-bytes", 1024, "size of the payload of the object of the fanout mode, every update sends it to every watcher")
+	fs.IntVar(&o.workManifests, "work-manifests", 0, "number of ConfigMaps replacing the manifests of the ManifestWork templates, e.g. 20, 0 keeps the manifests of the templates")
+	fs.IntVar(&o.workBytes, "work-manifest-bytes", 1024, "size of the data of each ConfigMap of work-manifests, e.g. 10240")
+	fs.IntVar(&o.rotateEvery, "rotate-credentials", 0, "seconds between the rotations of the credentials of the clients, each client then authenticates with a token of rotate-service-account, renewed on the multiples of the interval, all the clients at once, on a new connection, 0 keeps the credentials of the kubeconfig")
+	fs.StringVar(&o.rotateAccountRef, "rotate-service-account", "default/load-simulator", "<namespace>/<name> of the ServiceAccount the tokens of rotate-credentials are issued for, with the credentials of the kubeconfig, e.g. the one of the rbac command")
+	fs.Float64Var(&o.consumeRate, "watch-consume-rate", 1, "events per second each watcher of the slow-watch mode reads, below the rate of the writes its watch sees, e.g. 0.5")
+	fs.StringVar(&o.lifecycleSteps, "lifecycle", "create,patch=1,delete", "comma separated steps each tick of the lifecycle mode takes a new object through, create, wait=<condition type or JSONPath expression>, patch=<count> and delete, e.g. create,wait=Applied,patch=3,delete")
+	fs.StringVar(&o.waitFor, "wait-for", "", "JSONPath expression each client waits to hold on its object once created, reported as wait/ready, e.g. '.status.phase == Bound', '{.status.conditions[?(@.type==\"Ready\")].status} == True' or '.status.readyReplicas'")
+	fs.IntVar(&o.waitTimeout, "wait-timeout", 60, "seconds the waits, of wait-for and of the lifecycle mode, wait for their expression to hold before failing")
+	fs.StringVar(&o.targetSelector, "target-selector", "", "label selector of the existing objects of the template kinds the target mode drives, in all the namespaces, e.g. app=policy-propagator")
+	fs.StringVar(&o.targetVerbList, "target-verbs", "get,update", "comma separated verbs the target mode sends to the targets in rotation, get|update|delete")
+	fs.IntVar(&o.targetRefresh, "target-refresh", 0, "seconds between the discoveries of the targets, so the new objects are targeted as well, 0 discovers them once at the start")
+	fs.StringVar(&o.clusterChurn, "cluster-churn", clusterChurnLabels, "what the cluster-churn mode changes on the ManagedClusters on every tick, labels|claims|both")
+	fs.IntVar(&o.clusterValues, "cluster-churn-values", 2, "number of values the label and the claim of the cluster-churn mode rotate through, v0 to v<n-1>")
+	fs.StringVar(&o.clusterSet, "cluster-set", "", "ManagedClusterSet of the ManagedClusters of the cluster-churn mode, so the placements bound to it see them")
+	fs.Float64Var(&o.placementChurn, "placement-churn", 0.1, "fraction of the PlacementDecisions of the placement-churn mode flipping a cluster on every tick")
+	fs.IntVar(&o.placementCount, "placement-clusters", 10, "number of clusters of each PlacementDecision of the placement-churn mode")
+	fs.IntVar(&o.placementPool, "placement-pool", 100, "number of clusters, cluster-<i>, the PlacementDecisions of the placement-churn mode pick from, they don't have to exist")
+	fs.IntVar(&o.feedbackValues, "feedback-values", 2, "number of status feedback values of each manifest the status-feedback mode reports, the first one changes on every tick")
+	fs.IntVar(&o.feedbackBytes, "feedback-bytes", 256, "size of the string status feedback values of the status-feedback mode")
+	fs.IntVar(&o.rolloutWorks, "rollout-works", 10, "number of works each client creates at once on every wave of the rollout mode")
+	fs.IntVar(&o.rolloutEvery, "rollout-every", 60, "seconds between the waves of the rollout mode, the first one starts after as long")
+	fs.BoolVar(&o.verifyObjs, "verify-objects", false, "once the load is over, before the clean up, list the objects of the run and check the clients created all of them, concurrent times batch-size up to max-objects, reporting any shortfall")
+	fs.IntVar(&o.verifyMinUpdates, "verify-min-updates", 0, "with verify-objects and stamp-writes, also check each object was updated at least this many times, by its load-simulator/seq annotation")
+	fs.BoolVar(&o.stampWrites, "stamp-writes", false, "stamp each create and update of the update mode with the load-simulator/seq and load-simulator/written-at annotations, so observers, e.g. the analyze command, measure the end to end delay and detect lost or reordered updates")
+	fs.StringVar(&o.boundarySizes, "boundary-sizes", "1Mi,1.5Mi", "comma separated object sizes the boundary mode creates objects just under and just over, the defaults are the ConfigMap and the etcd request limits")
+	fs.IntVar(&o.boundaryMargin, "boundary-margin", 1024, "bytes under and over each of boundary-sizes the objects of the boundary mode are")
+	fs.StringVar(&o.boundaryField, "boundary-field", "spec.padding", "dot separated path of the string field of the template the boundary mode pads, the schema of the kind has to keep it")
+	fs.StringVar(&o.updateClasses, "update-classes", "", "classes of objects with their own tick interval, e.g. 10%=1s,90%=5m, instead of interval, the load-simulator/update-classes annotation of a template takes precedence for its objects")
+	fs.StringVar(&o.patchType, "patch-type", patchMerge, "encoding used for updates, merge|json|strategic|mixed, mixed rotates through all of them; strategic is not supported by custom resources")
+	fs.StringVar(&o.mode, "mode", "update", fmt.Sprintf("workload each client drives, one of %s", strings.Join(workloadNames(), "|")))
+	fs.IntVar(&o.fieldManagers, "field-managers", 10, "number of field managers rotated by the apply-managers mode")
+	fs.IntVar(&o.quotaHard, "quota-hard", 20, "hard limit of each ResourceQuota item in the quota mode")
+	fs.StringVar(&o.webhook, "webhook", "", "name of a ValidatingWebhookConfiguration, attribute the latency of the webhook mode to its webhooks")
+	fs.StringVar(&o.csrApprover, "csr-approver-kubeconfig", "", "kubeconfig of a client allowed to approve CSRs, the csr mode approves every CSR it creates when set")
+	fs.StringVar(&o.crdChurn, "crd-churn", crdChurnInstall, "what the crd-churn mode does on every tick, install|versions, install creates and deletes a CRD, versions adds a served version to it")
+	fs.IntVar(&o.crdMaxVersions, "crd-max-versions", 10, "number of versions the versions crd-churn adds before starting over")
+	fs.StringVar(&o.discoveryTargets, "discovery-targets", "apis,openapi-v2", "comma separated documents the discovery mode fetches in rotation, apis|openapi-v2|openapi-v3")
+	fs.StringVar(&o.streamKind, "stream-kind", streamLogs, fmt.Sprintf("kind of the streams opened by the stream mode, %s", streamKinds))
+	fs.IntVar(&o.streamCount, "streams", 1, "number of streams each client of the stream mode keeps open")
+	fs.StringVar(&o.probeAPIServices, "probe-apiservices", "", "comma separated APIService names, e.g. v1beta1.metrics.k8s.io, probed during the run to report their availability and latency")
+	fs.IntVar(&o.probeInterval, "probe-interval", 1000, "interval between the APIService probes, in milliseconds")
+	fs.StringVar(&o.namespaceLayout, "namespace-layout", namespacePerObject, "where the objects live, per-object puts each object in its own namespace, shared puts all of them in one namespace")
+	fs.BoolVar(&o.compareLayouts, "compare-namespace-layout", false, "run the workload twice, with the per-object and the shared namespace layout, and report the difference")
+	fs.StringVar(&o.namespacePrefix, "namespace-prefix", "", "prefix of the namespaces, <prefix>-<client index> or <prefix>-shared, the namespaces are named after the objects when empty")
+	fs.BoolVar(&o.precreateNs, "precreate-namespaces", false, "create all the namespaces of the run before the load starts, with progress logs, instead of each client creating its own at the start of the measured load")
+	fs.IntVar(&o.precreateWorkers, "precreate-workers", 50, "number of namespaces created at once by precreate-namespaces")
+	fs.BoolVar(&o.reuseNamespaces, "reuse-namespaces", false, "use namespaces created out-of-band, e.g. with quotas, PSS labels or NetworkPolicies, instead of creating and deleting them")
+	fs.Var(&o.namespaceLabels, "namespace-label", "key=value label set on the namespaces the run creates, e.g. pod-security.kubernetes.io/enforce=restricted, repeatable")
+	fs.Var(&o.namespaceAnnos, "namespace-annotation", "key=value annotation set on the namespaces the run creates, repeatable")
+	fs.IntVar(&o.objectTTL, "object-ttl", 0, "lifetime of each object in seconds, an expired object is deleted and created again under a new name, 0 means forever")
+	fs.StringVar(&o.keySkew, "key-skew", skewNone, "how GET/PATCH traffic spreads over the objects, none|hot|zipf, none means each client only touches its own object")
+	fs.IntVar(&o.hotKeys, "hot-keys", 5, "number of hot objects of the hot key skew")
+	fs.Float64Var(&o.hotFraction, "hot-fraction", 0.8, "share of the GET/PATCH traffic going to the hot objects with the hot key skew")
+	fs.Float64Var(&o.zipfS, "zipf-s", 1.1, "exponent of the zipf key skew, has to be greater than 1")
+	fs.StringVar(&o.schedule, "schedule", "", "\";\" separated cron-like entries scaling the load from the matching time on, e.g. \"0 9 * * 1-5 scale=3; 0 17 * * * scale=1\"")
+	fs.IntVar(&o.chaosInterval, "chaos-interval", 0, "interval between the chaos rounds killing runners, in seconds, 0 disables chaos")
+	fs.Float64Var(&o.chaosPercent, "chaos-percent", 10, "percentage of the runners killed by each chaos round, they drop their connections without clean up")
+	fs.IntVar(&o.chaosRespawn, "chaos-respawn-delay", 5, "delay before a killed runner is respawned, in seconds")
+	fs.IntVar(&o.reconnectAt, "reconnect-at", 0, "seconds since the start of the run when all the runners drop their connections, emulating an apiserver rolling restart, 0 disables it")
+	fs.IntVar(&o.reconnectPause, "reconnect-pause", 5, "seconds the traffic is paused after the connections are dropped")
+	fs.IntVar(&o.reconnectWindow, "reconnect-window", 30, "seconds over which the runners reconnect one after the other after the pause")
+	fs.IntVar(&o.stuckIntervals, "stuck-intervals", 0, "number of intervals without progress, and at least 30 seconds, after which a runner is reported stuck along with a goroutine dump, 0 disables the detection")
+	fs.BoolVar(&o.restartStuck, "restart-stuck", false, "restart the stuck runners")
+	fs.StringVar(&o.stuckDumpDir, "stuck-dump-dir", "", "directory of the goroutine dumps of the stuck runners, defaults to the temporary directory")
+	fs.Float64Var(&o.malformedPercent, "malformed-percent", 0, "percentage of the ticks sending an invalid object instead, rotating through a schema violation, an oversized payload and a bad field type")
+	fs.StringVar(&o.onAlreadyExists, "on-already-exists", outcomeIgnore, "how the AlreadyExists of the creates of the objects is handled, ignore|warn|fail, it's reported as <op>/already-exists either way, warn logs it, fail makes it an error of the create")
+	fs.StringVar(&o.onNotFound, "on-not-found", outcomeIgnore, "how the NotFound of the deletes of the objects is handled, ignore|warn|fail, it's reported as <op>/not-found either way, warn logs it, fail makes it an error of the delete")
+	fs.IntVar(&o.malformedSize, "malformed-size", 1600*1024, "size in bytes of the padding of oversized objects, the default is over the 1.5MB etcd request limit")
+	fs.Float64Var(&o.collidePercent, "collide-percent", 0, "percentage of the ticks creating a copy of the object under its name instead, to exercise the AlreadyExists rejections at a known rate, reported as create/collision")
+	fs.Var(&o.tags, "tags", "key=value tag of the run, e.g. etcd=3.5.4, recorded in the report, on the live metrics and in the load-simulator/tags annotation of the objects and namespaces the run creates, to slice the results by experiment variant, repeatable")
+	fs.StringVar(&o.reportPath, "report", "", "path of the JSON report written at the end of the run")
+	fs.IntVar(&o.hedgeAfter, "hedge-after", 0, "milliseconds after which a get or a list not answered yet is sent again, the first response wins and the other request is canceled, 0 doesn't hedge")
+	fs.BoolVar(&o.apfAttribution, "apf-attribution", false, "report the requests on the wire by the APF priority level and FlowSchema the apiserver classified them into, from the headers of the responses")
+	fs.StringVar(&o.requestLogPath, "request-log", "", "path of the NDJSON log of the requests on the wire, one line per request with its verb, resource, status, latency and the Audit-Id the apiserver answered with, to join it with the audit log")
+	fs.IntVar(&o.requestLogSlower, "request-log-slower-than", 0, "only log the requests slower than as many milliseconds, 0 logs all of them")
+	fs.StringVar(&o.apfIdentities, "apf-identities", "", "comma separated name=weight, e.g. hub=20,agent=80, splits the clients into groups impersonating the load-simulator-<name> user, so FlowSchemas can tell them apart; the metrics are broken down by identity")
+	fs.BoolVar(&o.lowPriority, "low-priority", false, "send all the requests as the load-simulator-low-priority user in the load-simulator:low-priority group, which the FlowSchema of the flowschema command matches, so the load yields to the workloads sharing the cluster; it excludes apf-identities")
+	fs.StringVar(&o.apfGroups, "apf-groups", "", "comma separated groups the identities impersonate along with their user, they need RBAC for the workload")
+	fs.StringVar(&o.runID, "run-id", newRunID(), "identifier of the run, defaults to run-<unix time>")
+	fs.StringVar(&o.userAgent, "user-agent", defaultUserAgent, "text/template of the User-Agent of every client, it can refer to {{.RunID}}, {{.Runner}} (the client index), {{.Identity}} and {{.Version}} (the simulator build)")
+	fs.Var(&o.headers, "header", "extra \"Key: Value\" header sent with every request, e.g. impersonation extras, repeatable")
+	fs.StringVar(&o.preset, "preset", "", fmt.Sprintf("named set of flag values, explicit flags take precedence, one of %s", strings.Join(presetNames(), "|")))
+	fs.StringVar(&o.allowContexts, "allow-context", "", "comma separated kubeconfig contexts the run is allowed to use, any context is allowed when empty")
+	fs.StringVar(&o.protectedServers, "protected-servers", defaultProtectedServers, "regular expression of the server URLs the run refuses to load without -yes-i-mean-it, empty disables the check")
+	fs.BoolVar(&o.confirmed, "yes-i-mean-it", false, "confirm the run against a server matching -protected-servers")
+	fs.IntVar(&o.maxObjects, "max-objects", 0, "stop the run once this many objects are created from the template, whatever the duration, 0 means no limit")
+	fs.IntVar(&o.maxRequests, "max-total-requests", 0, "stop the run once this many requests are sent by all the clients, whatever the duration, 0 means no limit; the clean up isn't counted")
+	fs.IntVar(&o.observers, "observers", 0, "number of observer clients sending canary GET/LIST requests during the run, their latency is reported apart from the load")
+	fs.IntVar(&o.observerInterval, "observer-interval", 1000, "interval between the canary requests of each observer, in milliseconds")
+	fs.BoolVar(&o.informer, "informer", false, "read through a controller-runtime cache shared by all the clients, which lists and watches what they read, instead of sending the reads to the apiserver")
+	fs.IntVar(&o.resyncInterval, "resync-interval", 5, "interval between the resync storms of the resync-storm mode, in minutes")
+	fs.IntVar(&o.resyncWorkers, "resync-workers", 10, "number of workers touching the objects during a resync storm")
+	fs.StringVar(&o.httpVersion, "http-version", httpVersion2, "HTTP version of the clients, 2|1.1, with 2 the requests of a client are multiplexed on a connection")
+	fs.BoolVar(&o.h2StrictStreams, "h2-strict-max-streams", false, "queue the HTTP/2 requests over the server's max concurrent streams instead of opening more connections")
+	fs.BoolVar(&o.compression, "compression", true, "ask for gzip compressed responses, the apiserver compresses the large ones, the bandwidth is reported by verb either way")
+	fs.IntVar(&o.throughputEvery, "throughput-interval", 10, "seconds between the samples of the network throughput in the report, 0 disables the sampling")
+	fs.IntVar(&o.h2ReadIdle, "h2-read-idle-timeout", 0, "ping the HTTP/2 connections idle for that many seconds, dropping the dead ones, 0 disables the health checks")
+	fs.StringVar(&o.proxyURL, "proxy-url", "", "http, https or socks5 proxy the requests go through, by default the proxy-url of the kubeconfig or HTTPS_PROXY/NO_PROXY")
+	fs.StringVar(&o.endpointList, "endpoints", "", "comma separated apiserver endpoints, e.g. https://10.0.0.1:6443,https://10.0.0.2:6443, each optionally weighted with =<weight> to skew the load, e.g. https://10.0.0.1:6443=80, the requests are spread over them instead of the server of the kubeconfig and reported by endpoint")
+	fs.StringVar(&o.endpointPolicy, "endpoint-policy", endpointPerClient, "how the requests are spread over the endpoints, per-client|round-robin|failover, per-client sticks each client to an endpoint, round-robin rotates every request, failover moves on when an endpoint refuses connections")
+	fs.StringVar(&o.konnectivity, "konnectivity-address", "", "konnectivity server the requests are tunneled through with HTTP CONNECT, host:port or unix:///path/to/socket, replaces any proxy")
+	fs.StringVar(&o.konnectivityCA, "konnectivity-ca", "", "CA of the konnectivity server over tcp")
+	fs.StringVar(&o.konnectivityCert, "konnectivity-cert", "", "client certificate for the konnectivity server over tcp")
+	fs.StringVar(&o.konnectivityKey, "konnectivity-key", "", "client key for the konnectivity server over tcp")
+	fs.Float64Var(&o.readQPS, "read-qps", 500, "QPS of the client side limiter of the reads (get, list) of each client, with their own connections when the read and write limits differ")
+	fs.IntVar(&o.readBurst, "read-burst", 1000, "burst of the client side limiter of the reads of each client")
+	fs.Float64Var(&o.writeQPS, "write-qps", 500, "QPS of the client side limiter of the writes (create, update, patch, delete) of each client")
+	fs.IntVar(&o.writeBurst, "write-burst", 1000, "burst of the client side limiter of the writes of each client")
+	fs.BoolVar(&o.objectLatency, "object-latency", false, "watch the objects of the run and report, like the kube-burner latency measurements, the quantiles of the time from their creation to their first watch event, as Observed, and to each of object-latency-conditions turning True")
+	fs.StringVar(&o.latencyConds, "object-latency-conditions", "", "comma separated status condition types of the objects measured by object-latency, e.g. Applied,Available")
+	fs.StringVar(&o.latencyThreshs, "object-latency-thresholds", "", "comma separated <condition type or Observed>:<P50|P95|P99|Max|Avg>=duration, e.g. Observed:P95=500ms,Applied:P99=2s, checked against the object-latency quantiles")
+	fs.StringVar(&o.latencyBudget, "latency-budget", "", "comma separated verb=duration, e.g. get=50ms,patch=200ms, the p99 of the requests of each verb on the wire is checked against its budget")
+	fs.Var(&o.tenants, "tenant", "<name>=<concurrent>[:<qps>] tenant of a multi-tenant run with its own clients, repeatable, the clients of a tenant impersonate the load-simulator-<name> user, use the <namespace-prefix or tenant>-<name> namespaces and share a client side limit of qps, the metrics are broken down by tenant and the tenants' clients replace concurrent")
+	fs.Var(&o.hubs, "hub", "<name>=<kubeconfig>:<concurrent> hub of a federated run with its own clients, repeatable, the hubs are reported side by side and their clients replace concurrent")
+	fs.StringVar(&o.spokeKubeconfig, "spoke-kubeconfig", "", "kubeconfig of the managed cluster the ManifestWorks are applied to, the resources they wrap are waited for there and the hub to spoke latency is reported as propagation/manifestwork")
+	fs.IntVar(&o.spokeTimeout, "spoke-timeout", 60, "how long to wait for the resources of a ManifestWork to appear on the spoke, in seconds")
+	fs.IntVar(&o.watchStaleAfter, "watch-stale-after", 60, "seconds after which a watch of the watch-lag mode which hasn't seen a write, by event or bookmark, is flagged as fallen behind")
+	fs.Float64Var(&o.restartFraction, "watch-restart-fraction", 0, "fraction of the watches of the watch-lag mode restarted at once, e.g. 0.5, emulating an apiserver rollout, 0 disables the restarts")
+	fs.IntVar(&o.restartAt, "watch-restart-at", 60, "seconds since the start of the run of the first watch restart storm")
+	fs.IntVar(&o.restartEvery, "watch-restart-every", 0, "minutes between the watch restart storms, 0 only restarts once")
+	fs.IntVar(&o.cachedReads, "cached-reads", cachedReadsDefault, "percentage of the clients reading from the watch cache with resourceVersion=0 in the cached-get mode, the others read from etcd")
+	fs.IntVar(&o.batchSize, "batch-size", 1, "number of objects of each client, each tick drives all of them concurrently on the client's connection, only for the update, apply-managers and webhook modes")
+	fs.IntVar(&o.batchWorkers, "batch-workers", 0, "number of goroutines of each client driving the objects of its batch, each object ticking as soon as it's done with its previous tick rather than all of them waiting for the slowest one, 0 drives all of them at once on every tick")
+	fs.IntVar(&o.logDedup, "log-dedup-window", 30, "window in seconds aggregating identical errors, the first one is logged and then how many times it occurred in the window, 0 logs every error")
+	fs.StringVar(&o.template, "template", "./testdata/manifestwork-template.yaml", "comma separated paths to the template files, default is ./testdata/manifestwork-template.yaml")
+	fs.Var(&o.overlays, "overlay", "<first>-<last>=<path> YAML snippet merged into the template of the clients in the index range, e.g. 0-99=big.yaml or 100-=small.yaml, repeatable, merged in order")
+	fs.StringVar(&o.nameStrategy, "name-strategy", nameSequential, "how the object names are generated, sequential|random|uuid|hash, sequential is <template name>-<client index>, random and uuid are derived from the run ID")
+	fs.StringVar(&o.weights, "weights", "", "comma separated kind=weight, e.g. manifestwork=70,secret=30, splits the clients between the templates, evenly by default")
+}
+
+// complete applies the preset, then validates the flags and parses the
+// composite ones. fs has to be parsed already.
+func (o *options) complete(fs *flag.FlagSet) error {
+	if err := applyPreset(fs, o.preset); err != nil {
+		return err
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "run-id" {
+			o.runIDSet = true
+		}
+	})
+
+	o.effective = effectiveConfig(fs)
+
+	for k, v := range o.tags {
+		if strings.Contains(k+v, ",") {
+			return fmt.Errorf("invalid tag %s=%s, the tags can't contain a comma", k, v)
+		}
+	}
+
+	// the namespaces are tagged with the objects
+	if len(o.tags) != 0 {
+		if o.namespaceAnnos == nil {
+			o.namespaceAnnos = keyValues{}
+		}
+
+		o.namespaceAnnos[tagsAnnotation] = o.tags.String()
+	}
+
+	if err := validatePatchType(o.patchType); err != nil {
+		return err
+	}
+
+	if err := validateUpdateStrategy(o.updateStrategy); err != nil {
+		return err
+	}
+
+	if o.evictPods < 1 || o.evictMinAvail < 0 {
+		return fmt.Errorf("evict-pods has to be at least 1 and evict-min-available can't be negative")
+	}
+
+	if err := validateFanoutKind(o.fanoutKind); err != nil {
+		return err
+	}
+
+	if o.fanoutBytes < 0 {
+		return fmt.Errorf("fanout-bytes can't be negative")
+	}
+
+	if err := validateCRDChurn(o.crdChurn); err != nil {
+		return err
+	}
+
+	targets, err := parseDiscoveryTargets(o.discoveryTargets)
+	if err != nil {
+		return err
+	}
+
+	o.targets = targets
+
+	if err := validateStreamKind(o.streamKind); err != nil {
+		return err
+	}
+
+	if err := validateKeySkew(o.keySkew); err != nil {
+		return err
+	}
+
+	if o.keySkew == skewZipf && o.zipfS <= 1 {
+		return fmt.Errorf("zipf-s has to be greater than 1, got %v", o.zipfS)
+	}
+
+	if o.scheduleEntries, err = parseSchedule(o.schedule); err != nil {
+		return err
+	}
+
+	o.chaos = chaos{
+		interval:     time.Duration(o.chaosInterval) * time.Second,
+		percent:      o.chaosPercent,
+		respawnDelay: time.Duration(o.chaosRespawn) * time.Second,
+	}
+
+	if err := validateReconnect(o.reconnectAt, o.reconnectPause, o.reconnectWindow); err != nil {
+		return err
+	}
+
+	o.reconnect = reconnect{
+		at:     time.Duration(o.reconnectAt) * time.Second,
+		pause:  time.Duration(o.reconnectPause) * time.Second,
+		window: time.Duration(o.reconnectWindow) * time.Second,
+	}
+
+	if o.pprofToken == "" {
+		o.pprofToken = os.Getenv("LOAD_SIMULATOR_PPROF_TOKEN")
+	}
+
+	if o.pprof {
+		if err := validateDebugAddr(o.pprofAddr, o.pprofToken); err != nil {
+			return err
+		}
+	}
+
+	if err := validateHTTPVersion(o.httpVersion); err != nil {
+		return err
+	}
+
+	if o.proxy, err = parseProxyURL(o.proxyURL); err != nil {
+		return err
+	}
+
+	if o.endpoints, err = parseEndpoints(o.endpointList, o.endpointPolicy); err != nil {
+		return err
+	}
+
+	if o.classes, err = parseUpdateClasses(o.updateClasses); err != nil {
+		return err
+	}
+
+	if o.bindNodes, err = parseBindNodes(o.bindNodeList); err != nil {
+		return err
+	}
+
+	if o.boundaries, err = parseBoundaries(o.boundarySizes); err != nil {
+		return err
+	}
+
+	if o.workManifests < 0 || o.workBytes < 0 {
+		return fmt.Errorf("work-manifests and work-manifest-bytes can't be negative")
+	}
+
+	if o.feedbackValues < 1 || o.feedbackBytes < 0 {
+		return fmt.Errorf("feedback-values has to be at least 1 and feedback-bytes can't be negative")
+	}
+
+	if o.hedgeAfter < 0 {
+		return fmt.Errorf("hedge-after can't be negative")
+	}
+
+	if o.requestLogSlower < 0 {
+		return fmt.Errorf("request-log-slower-than can't be negative")
+	}
+
+	if o.startJitter < 0 {
+		return fmt.Errorf("start-jitter can't be negative")
+	}
+
+	if o.rotateEvery < 0 {
+		return fmt.Errorf("rotate-credentials can't be negative")
+	}
+
+	if o.rotateAccount, err = parseServiceAccount(o.rotateAccountRef); err != nil {
+		return err
+	}
+
+	// the rotation swaps the client the batch workers use
+	if o.rotateEvery > 0 && o.batchWorkers > 0 {
+		return fmt.Errorf("rotate-credentials isn't supported with batch-workers")
+	}
+
+	if o.consumeRate <= 0 {
+		return fmt.Errorf("watch-consume-rate has to be positive")
+	}
+
+	if o.lifecycle, err = parseLifecycle(o.lifecycleSteps); err != nil {
+		return err
+	}
+
+	if o.waitFor != "" {
+		if o.waitReady, err = parseWaitExpr(o.waitFor); err != nil {
+			return err
+		}
+	}
+
+	if o.waitTimeout < 1 {
+		return fmt.Errorf("wait-timeout has to be at least 1")
+	}
+
+	if (o.mode == "target") != (o.targetSelector != "") {
+		return fmt.Errorf("target-selector and the target mode go together")
+	}
+
+	if o.targetLabels, err = labels.Parse(o.targetSelector); err != nil {
+		return fmt.Errorf("invalid target-selector %q, error: %w", o.targetSelector, err)
+	}
+
+	if o.targetVerbs, err = parseTargetVerbs(o.targetVerbList); err != nil {
+		return err
+	}
+
+	if o.targetRefresh < 0 {
+		return fmt.Errorf("target-refresh can't be negative")
+	}
+
+	if err := validateClusterChurn(o.clusterChurn); err != nil {
+		return err
+	}
+
+	if o.clusterValues < 2 {
+		return fmt.Errorf("cluster-churn-values has to be at least 2")
+	}
+
+	if o.precreateWorkers < 1 {
+		return fmt.Errorf("precreate-workers has to be at least 1")
+	}
+
+	if o.precreateNs && o.reuseNamespaces {
+		return fmt.Errorf("precreate-namespaces and reuse-namespaces can't be used together, the reused namespaces exist already")
+	}
+
+	if o.precreateNs && len(o.hubs) != 0 {
+		return fmt.Errorf("precreate-namespaces doesn't support hub, the namespaces are spread over the hubs")
+	}
+
+	if o.placementChurn < 0 || o.placementChurn > 1 {
+		return fmt.Errorf("placement-churn has to be between 0 and 1")
+	}
+
+	if o.placementCount < 1 || o.placementPool <= o.placementCount {
+		return fmt.Errorf("placement-clusters has to be at least 1 and placement-pool over placement-clusters")
+	}
+
+	if o.rolloutWorks < 1 || o.rolloutEvery < 1 {
+		return fmt.Errorf("rollout-works and rollout-every have to be at least 1")
+	}
+
+	if o.boundaryMargin < 0 || o.boundaryField == "" {
+		return fmt.Errorf("boundary-margin can't be negative and boundary-field can't be empty")
+	}
+
+	if o.konnectivity != "" {
+		if o.tunnel, err = newTunnel(o.konnectivity, o.konnectivityCA, o.konnectivityCert, o.konnectivityKey); err != nil {
+			return err
+		}
+	}
+
+	if o.readQPS <= 0 || o.writeQPS <= 0 || o.readBurst < 1 || o.writeBurst < 1 {
+		return fmt.Errorf("read-qps, write-qps have to be positive, read-burst, write-burst at least 1")
+	}
+
+	if o.budgets, err = parseLatencyBudgets(o.latencyBudget); err != nil {
+		return err
+	}
+
+	for _, t := range strings.Split(o.latencyConds, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			o.latencyConditions = append(o.latencyConditions, t)
+		}
+	}
+
+	if o.latencyThresholds, err = parseLatencyThresholds(o.latencyThreshs); err != nil {
+		return err
+	}
+
+	if !o.objectLatency && (len(o.latencyConditions) != 0 || len(o.latencyThresholds) != 0) {
+		return fmt.Errorf("object-latency-conditions and object-latency-thresholds need object-latency")
+	}
+
+	for _, t := range o.latencyThresholds {
+		measured := t.conditionType == observedQuantile
+		for _, c := range o.latencyConditions {
+			measured = measured || c == t.conditionType
+		}
+
+		if !measured {
+			return fmt.Errorf("the latency threshold of %s isn't measured, expecting %s or one of object-latency-conditions", t.conditionType, observedQuantile)
+		}
+	}
+
+	if len(o.hubs) != 0 {
+		o.concurrent = o.hubs.concurrent()
+	}
+
+	if len(o.tenants) != 0 {
+		if len(o.hubs) != 0 {
+			return fmt.Errorf("tenant and hub can't be used together")
+		}
+
+		o.concurrent = o.tenants.concurrent()
+	}
+
+	if o.endpoints != nil {
+		o.endpoints.clients = o.concurrent
+	}
+
+	if o.spokeKubeconfig != "" && o.spokeTimeout <= 0 {
+		return fmt.Errorf("spoke-timeout has to be positive, got %v", o.spokeTimeout)
+	}
+
+	if o.watchStaleAfter < 1 {
+		return fmt.Errorf("watch-stale-after has to be positive, got %v", o.watchStaleAfter)
+	}
+
+	if err := validateWatchRestarts(o.restartFraction, o.restartAt, o.restartEvery); err != nil {
+		return err
+	}
+
+	if o.cachedReads < 0 || o.cachedReads > 100 {
+		return fmt.Errorf("cached-reads has to be between 0 and 100, got %v", o.cachedReads)
+	}
+
+	if o.batchSize < 1 {
+		return fmt.Errorf("batch-size has to be at least 1, got %v", o.batchSize)
+	}
+
+	if o.batchWorkers < 0 || (o.batchWorkers > 0 && o.batchSize == 1) {
+		return fmt.Errorf("batch-workers can't be negative and needs a batch-size, got %v", o.batchWorkers)
+	}
+
+	if o.batchWorkers > 0 && o.malformedPercent > 0 {
+		return fmt.Errorf("malformed-percent isn't supported with batch-workers")
+	}
+
+	if err := validateOutcome("on-already-exists", o.onAlreadyExists); err != nil {
+		return err
+	}
+
+	if err := validateOutcome("on-not-found", o.onNotFound); err != nil {
+		return err
+	}
+
+	if o.collidePercent < 0 || o.collidePercent > 100 {
+		return fmt.Errorf("collide-percent has to be between 0 and 100, got %v", o.collidePercent)
+	}
+
+	if o.batchWorkers > 0 && o.collidePercent > 0 {
+		return fmt.Errorf("collide-percent isn't supported with batch-workers")
+	}
+
+	if o.logDedup < 0 {
+		return fmt.Errorf("log-dedup-window can't be negative, got %v", o.logDedup)
+	}
+
+	if o.stuckIntervals < 0 {
+		return fmt.Errorf("stuck-intervals can't be negative, got %v", o.stuckIntervals)
+	}
+
+	o.heartbeat = heartbeat{
+		intervals: o.stuckIntervals,
+		restart:   o.restartStuck,
+		dumpDir:   o.stuckDumpDir,
+	}
+
+	if o.identities, err = parseIdentities(o.apfIdentities); err != nil {
+		return err
+	}
+
+	o.identityGroups = []string{}
+	for _, g := range strings.Split(o.apfGroups, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			o.identityGroups = append(o.identityGroups, g)
+		}
+	}
+
+	if o.lowPriority {
+		if len(o.identities) != 0 {
+			return fmt.Errorf("low-priority and apf-identities can't be used together")
+		}
+
+		o.identities = []apfIdentity{{name: lowPriorityIdentity, weight: 1}}
+		o.identityGroups = append(o.identityGroups, lowPriorityGroup)
+	}
+
+	// the tenants are identities of their own
+	if len(o.tenants) != 0 {
+		if len(o.identities) != 0 {
+			return fmt.Errorf("tenant can't be used with apf-identities or low-priority")
+		}
+
+		o.identities = o.tenants.identities()
+	}
+
+	if o.uaTemplate, err = parseUserAgent(o.userAgent); err != nil {
+		return err
+	}
+
+	wl, ok := workloads[o.mode]
+	if !ok {
+		return fmt.Errorf("unknown mode %q", o.mode)
+	}
+
+	o.workload = wl
+
+	if o.batchSize > 1 && !o.workload.batch {
+		return fmt.Errorf("batch-size isn't supported by the %s mode", o.mode)
+	}
+
+	if o.collidePercent > 0 && o.workload.setup != nil {
+		return fmt.Errorf("collide-percent isn't supported by the %s mode, it doesn't create the template", o.mode)
+	}
+
+	if o.verifyObjs && o.workload.setup != nil && !o.workload.template {
+		return fmt.Errorf("verify-objects isn't supported by the %s mode, it doesn't create the template", o.mode)
+	}
+
+	if o.verifyMinUpdates < 0 || (o.verifyMinUpdates > 0 && (!o.verifyObjs || !o.stampWrites)) {
+		return fmt.Errorf("verify-min-updates can't be negative, it needs verify-objects and stamp-writes")
+	}
+
+	o.layouts = []string{o.namespaceLayout}
+	if o.compareLayouts {
+		o.layouts = []string{namespacePerObject, namespaceShared}
+	}
+
+	for _, l := range o.layouts {
+		if err := validateNamespaceLayout(l); err != nil {
+			return err
+		}
+
+		if l != namespaceShared && o.workload.shared {
+			return fmt.Errorf("the %s mode needs -namespace-layout %s", o.mode, namespaceShared)
+		}
+	}
+
+	if err := validateCleanScope(o.cleanScope); err != nil {
+		return err
+	}
+
+	if err := validateNameStrategy(o.nameStrategy); err != nil {
+		return err
+	}
+
+	if o.resyncWorkers < 1 {
+		return fmt.Errorf("resync-workers has to be at least 1, got %v", o.resyncWorkers)
+	}
+
+	if o.maxObjects < 0 || o.maxRequests < 0 {
+		return fmt.Errorf("max-objects and max-total-requests can't be negative")
+	}
+
+	if o.guard, err = newSafetyGuard(o.allowContexts, o.protectedServers, o.confirmed); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (o *options) loadTemplates() error {
+	ts, err := loadTemplates(o.template, o.weights)
+	if err != nil {
+		return err
+	}
+
+	o.templates = ts
+
+	payload := workPayload{manifests: o.workManifests, bytes: o.workBytes}
+
+	for i := range o.templates {
+		if err := templateClasses(&o.templates[i], o.classes); err != nil {
+			return err
+		}
+
+		if err := payload.apply(&o.templates[i]); err != nil {
+			return err
+		}
+
+		o.templates[i].lookups = findLookups(o.templates[i].obj.Object, nil)
+	}
+
+	return o.overlays.load()
+}
+
+// runSelector selects everything labeled with the run ID. A -clean without
+// -run-id doesn't know the run it cleans, so it selects everything labeled by
+// any run.
+func (o *options) runSelector() (labels.Selector, error) {
+	req, err := labels.NewRequirement(runLabel, selection.Equals, []string{o.runID})
+	if o.clean && !o.runIDSet {
+		req, err = labels.NewRequirement(runLabel, selection.Exists, nil)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the run selector, error: %w", err)
+	}
+
+	return labels.NewSelector().Add(*req), nil
+}
+
+func (o *options) templateKinds() []schema.GroupVersionKind {
+	kinds := []schema.GroupVersionKind{}
+	for _, t := range o.templates {
+		kinds = append(kinds, t.obj.GroupVersionKind())
+	}
+
+	return kinds
+}
+
+// verifyCleanup waits for everything the run created to be gone, from each
+// of the clusters.
+func (o *options) verifyCleanup(ctx context.Context, clusters []cluster, logger logr.Logger) (*CleanupReport, error) {
+	if o.cleanTimeout <= 0 {
+		return nil, nil
+	}
+
+	selector, err := o.runSelector()
+	if err != nil {
+		return nil, err
+	}
+
+	kinds := append(append([]schema.GroupVersionKind{}, clusterScopedKinds...), o.templateKinds()...)
+
+	// the namespaces are meant to outlive the clean up of the objects
+	if o.cleanScope != cleanObjects {
+		kinds = append(kinds, namespaceGVK)
+	}
+
+	out := &CleanupReport{Verified: true}
+	for _, cl := range clusters {
+		c, err := verifyCleanup(ctx, cl.config, selector, kinds, time.Duration(o.cleanTimeout)*time.Second, cl.logger(logger))
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range c.Leaks {
+			c.Leaks[i].Hub = cl.hub
+		}
+
+		out.Verified = out.Verified && c.Verified
+		out.Duration += c.Duration
+		out.Leaks = append(out.Leaks, c.Leaks...)
+	}
+
+	return out, nil
+}
+
+// cleanByCollection deletes everything the run created by collection.
+func (o *options) cleanByCollection(ctx context.Context, config *restclient.Config, logger logr.Logger) error {
+	selector, err := o.runSelector()
+	if err != nil {
+		return err
+	}
+
+	return fastClean(ctx, config, selector, o.cleanScope, o.templateKinds(), clusterScopedKinds, o.concurrent, logger)
+}
+
+// runnerOptions are the options shared by all the runners of a run.
+func (o *options) runnerOptions(layout string, metrics *Metrics, scale *loadScale) []Option {
+	return []Option{
+		WithInterval(o.interval),
+		WithStartJitter(o.startJitter),
+		WithHedging(o.hedgeAfter),
+		WithKubePath(o.kubeconfig),
+		WithCleanOption(o.clean),
+		WithUpdateOption(o.update),
+		WithPatchType(o.patchType),
+		WithUpdateStrategy(o.updateStrategy),
+		WithEviction(o.evictPods, o.evictMinAvail),
+		WithBindNodes(o.bindNodes),
+		WithFanout(o.fanoutKind, o.fanoutBytes),
+		WithBoundaries(o.boundaries, o.boundaryMargin, o.boundaryField),
+		WithStampWrites(o.stampWrites),
+		WithFeedback(o.feedbackValues, o.feedbackBytes),
+		WithLifecycle(o.lifecycle),
+		WithConsumeRate(o.consumeRate),
+		WithCredentialRotation(time.Duration(o.rotateEvery)*time.Second, o.rotateAccount),
+		WithWait(o.waitReady, time.Duration(o.waitTimeout)*time.Second),
+		WithDistinctManifests(o.workManifests > 0),
+		WithClusterChurn(o.clusterChurn, o.clusterValues, o.clusterSet),
+		WithPlacementChurn(o.placementChurn, o.placementCount, o.placementPool),
+		WithMetrics(metrics),
+		WithWorkload(o.workload),
+		WithFieldManagers(o.fieldManagers),
+		WithQuotaHard(o.quotaHard),
+		WithCSRApprover(o.csrApprover),
+		WithCRDChurn(o.crdChurn, o.crdMaxVersions),
+		WithDiscoveryTargets(o.targets),
+		WithStreams(o.streamKind, o.streamCount),
+		WithSharedNamespace(layout == namespaceShared),
+		WithNamespaces(o.namespacePrefix, o.reuseNamespaces),
+		WithNamespaceMetadata(o.namespaceLabels, o.namespaceAnnos),
+		WithTags(o.tags),
+		WithPrecreatedNamespaces(o.precreate()),
+		WithObjectTTL(o.objectTTL),
+		WithLoadScale(scale),
+		WithMalformed(o.malformedPercent, o.malformedSize),
+		WithCollisions(o.collidePercent),
+		WithOutcomes(o.onAlreadyExists, o.onNotFound),
+		WithBatchSize(o.batchSize),
+		WithBatchWorkers(o.batchWorkers),
+		WithWatchStaleAfter(time.Duration(o.watchStaleAfter) * time.Second),
+		WithTransportSettings(transportSettings{
+			httpVersion:      o.httpVersion,
+			strictMaxStreams: o.h2StrictStreams,
+			readIdleTimeout:  time.Duration(o.h2ReadIdle) * time.Second,
+			compression:      o.compression,
+			proxyURL:         o.proxy,
+			tunnel:           o.tunnel,
+		}),
+		WithQPS(float32(o.readQPS), o.readBurst, float32(o.writeQPS), o.writeBurst),
+		WithUserAgent(o.runID, o.uaTemplate),
+		WithHeaders(o.headers),
+		WithResync(time.Duration(o.resyncInterval)*time.Minute, o.resyncWorkers),
+		WithNameStrategy(o.nameStrategy),
+		WithFastClean(o.fastClean),
+		WithCleanScope(o.cleanScope),
+		WithState(o.state),
+	}
+}
+
+// allocate returns the options of runner idx: its template and identity. The
+// hot keys are picked among the objects of the same template, so each run
+// needs its own allocation.
+func (o *options) allocate(metrics *Metrics) func(idx int) []Option {
+	keys := make([]*keyspace, len(o.templates))
+	for i := range keys {
+		keys[i] = newKeyspace()
+	}
+
+	// the skew of each template spans the range of indexes of its runners
+	skews := make([]keySkew, len(o.templates))
+	for i := range skews {
+		skews[i] = keySkew{
+			kind:        o.keySkew,
+			hotKeys:     o.hotKeys,
+			hotFraction: o.hotFraction,
+			zipfS:       o.zipfS,
+			offset:      -1,
+		}
+	}
+
+	for idx := 0; idx < o.concurrent; idx++ {
+		s := &skews[templateFor(o.templates, idx, o.concurrent)]
+		if s.offset < 0 {
+			s.offset = idx
+		}
+
+		s.runners += 1
+	}
+
+	// the runners with the same template and overlays share the merged
+	// template
+	merged := map[string]*unstructured.Unstructured{}
+	mu := sync.Mutex{}
+
+	return func(idx int) []Option {
+		t := templateFor(o.templates, idx, o.concurrent)
+
+		w := o.templates[t].obj
+		overlays := o.overlays.matching(idx)
+		if len(overlays) != 0 {
+			key := fmt.Sprintf("%v/%v", t, overlays)
+
+			mu.Lock()
+			if merged[key] == nil {
+				merged[key] = o.overlays.apply(w, overlays)
+			}
+
+			w = merged[key]
+			mu.Unlock()
+		}
+
+		// and the ones with the same looked up objects as well
+		lookedUp := o.templates[t].resolved()
+		if lookedUp {
+			values := o.templates[t].lookupValues(idx)
+			key := fmt.Sprintf("%v/%v/%s", t, overlays, strings.Join(values, "/"))
+
+			mu.Lock()
+			if merged[key] == nil {
+				merged[key] = o.templates[t].lookedUp(w, values)
+			}
+
+			w = merged[key]
+			mu.Unlock()
+		}
+
+		opts := []Option{
+			WithTemplate(w),
+			WithLookupNamespace(lookedUp && o.templates[t].namespaceLookedUp()),
+			WithKeySkew(keys[t], skews[t]),
+			WithIdentity(identityFor(o.identities, idx, o.concurrent), o.identityGroups),
+			WithCachedReads(weightedIndex([]int{o.cachedReads, 100 - o.cachedReads}, idx, o.concurrent) == 0),
+		}
+
+		m := metrics
+
+		if len(o.tenants) != 0 {
+			opts = append(opts, WithTenant(tenantFor(o.tenants, idx), o.namespacePrefix))
+		}
+
+		// with several hubs, the operations are reported per hub
+		if len(o.hubs) != 0 {
+			h := hubFor(o.hubs, idx)
+			opts = append(opts, WithKubePath(h.kubeconfig))
+
+			if m != nil {
+				m = m.Scoped(h.name)
+			}
+		}
+
+		// with several templates, the operations are reported per kind
+		if m != nil && len(o.templates) > 1 {
+			m = m.Scoped(o.templates[t].name)
+		}
+
+		// and with several update classes, per class
+		if classes := o.templates[t].classes; len(classes) != 0 {
+			class := classes.classFor(idx, o.concurrent)
+			opts = append(opts, WithInterval(int(class.interval/time.Millisecond)))
+
+			if m != nil && len(classes) > 1 {
+				m = m.Scoped(class.name())
+			}
+		}
+
+		if m != metrics {
+			opts = append(opts, WithMetrics(m))
+		}
+
+		return opts
+	}
+}
+
+// parseOptions parses the flags of a run. With -resume, the flags of the
+// resumed run are parsed first, so the ones given now take precedence.
+func parseOptions(name string, args []string) (*options, error) {
+	o := &options{}
+	fs := newFlagSet(name, o)
+	fs.Usage = usage(fs)
+	fs.Parse(args)
+
+	if o.resume != "" {
+		if o.stateDir == "" {
+			return nil, fmt.Errorf("resume needs the state-dir of the resumed run")
+		}
+
+		st, err := loadRunState(o.stateDir, o.resume)
+		if err != nil {
+			return nil, err
+		}
+
+		o = &options{}
+		fs = newFlagSet(name, o)
+		fs.Usage = usage(fs)
+		// the masked flags are given again along with resume
+		fs.Parse(append(append(append([]string{}, unmaskedArgs(st.Args)...), "-run-id", st.RunID), args...))
+
+		o.state = st
+		o.duration -= int(st.Elapsed.Seconds())
+		if o.duration < 0 {
+			o.duration = 0
+		}
+	}
+
+	if err := o.complete(fs); err != nil {
+		return nil, err
+	}
+
+	if o.state == nil && o.stateDir != "" && !o.clean {
+		st, err := newRunState(o.stateDir, o.runID, maskArgs(args))
+		if err != nil {
+			return nil, err
+		}
+
+		o.state = st
+	}
+
+	return o, nil
+}
+
+// newFlagSet returns the flag set of a run, or of a subcommand taking the
+// same flags.
+func newFlagSet(name string, o *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	o.addFlags(fs)
+
+	return fs
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// the handlings of the AlreadyExists of the creates and the NotFound of the
+// deletes of the runner's objects, see -on-already-exists and -on-not-found.
+const (
+	outcomeIgnore = "ignore"
+	outcomeWarn   = "warn"
+	outcomeFail   = "fail"
+)
+
+func validateOutcome(flag, handling string) error {
+	switch handling {
+	case outcomeIgnore, outcomeWarn, outcomeFail:
+		return nil
+	}
+
+	return fmt.Errorf("unknown %s %q, expecting %s|%s|%s", flag, handling, outcomeIgnore, outcomeWarn, outcomeFail)
+}
+
+// swallowed reports err, the AlreadyExists of a create or the NotFound of a
+// delete of the object key, as <op>/already-exists or <op>/not-found, and
+// tells whether the caller goes on as if the request succeeded. With
+// handling fail, it's reported as an error and the caller fails, with warn,
+// it's logged.
+func (r *Runner) swallowed(op, key string, err error, d time.Duration, handling string) bool {
+	switch {
+	case k8serrors.IsAlreadyExists(err):
+		op += "/already-exists"
+	case k8serrors.IsNotFound(err):
+		op += "/not-found"
+	default:
+		return false
+	}
+
+	switch handling {
+	case outcomeFail:
+		r.metrics.Observe(op, d, err)
+		r.logger.Error(err, fmt.Sprintf("%s of %s", op, key))
+
+		return false
+
+	case outcomeWarn:
+		r.logger.Info(fmt.Sprintf("%s of %s, error: %v", op, key, err))
+	}
+
+	r.metrics.Observe(op, d, nil)
+
+	return true
+}
+
+// createObject creates obj, reported as op, an AlreadyExists is handled with
+// handling, see swallowed.
+func (r *Runner) createObject(ctx context.Context, op string, obj client.Object, handling string) error {
+	start := time.Now()
+	err := r.Client.Create(ctx, obj)
+	d := time.Since(start)
+
+	switch {
+	case err == nil:
+		r.metrics.Observe(op, d, nil)
+	case r.swallowed(op, client.ObjectKeyFromObject(obj).String(), err, d, handling):
+		return nil
+	case !k8serrors.IsAlreadyExists(err):
+		r.metrics.Observe(op, d, err)
+	}
+
+	return err
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// overlayList is a repeatable "<first>-<last>=<path>" flag, the overlays are
+// YAML snippets merged into the template of the runners in the index range.
+type overlayList []overlay
+
+type overlay struct {
+	// last is -1 for an open range, e.g. "100-"
+	first, last int
+	path        string
+	patch       map[string]interface{}
+}
+
+func (l *overlayList) String() string {
+	out := []string{}
+	for _, o := range *l {
+		last := ""
+		if o.last >= 0 {
+			last = strconv.Itoa(o.last)
+		}
+
+		out = append(out, fmt.Sprintf("%v-%s=%s", o.first, last, o.path))
+	}
+
+	return strings.Join(out, ", ")
+}
+
+func (l *overlayList) Set(s string) error {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[1] == "" {
+		return fmt.Errorf("invalid overlay %q, expecting <first>-<last>=<path>", s)
+	}
+
+	bounds := strings.SplitN(kv[0], "-", 2)
+	if len(bounds) != 2 {
+		return fmt.Errorf("invalid overlay range %q, expecting <first>-<last>, e.g. 0-99 or 100-", kv[0])
+	}
+
+	o := overlay{last: -1, path: kv[1]}
+
+	first, err := strconv.Atoi(bounds[0])
+	if err != nil || first < 0 {
+		return fmt.Errorf("invalid first runner of overlay range %q", kv[0])
+	}
+
+	o.first = first
+
+	if bounds[1] != "" {
+		last, err := strconv.Atoi(bounds[1])
+		if err != nil || last < first {
+			return fmt.Errorf("invalid last runner of overlay range %q", kv[0])
+		}
+
+		o.last = last
+	}
+
+	*l = append(*l, o)
+
+	return nil
+}
+
+// load reads the overlay snippets.
+func (l overlayList) load() error {
+	for idx := range l {
+		dat, err := ioutil.ReadFile(l[idx].path)
+		if err != nil {
+			return fmt.Errorf("failed to read overlay, error: %w", err)
+		}
+
+		patch := map[string]interface{}{}
+		if err := yaml.Unmarshal(dat, &patch); err != nil {
+			return fmt.Errorf("failed to parse overlay %s, error: %w", l[idx].path, err)
+		}
+
+		l[idx].patch = patch
+	}
+
+	return nil
+}
+
+// matching returns the indexes of the overlays of runner idx, in order.
+func (l overlayList) matching(idx int) []int {
+	out := []int{}
+	for i, o := range l {
+		if idx >= o.first && (o.last < 0 || idx <= o.last) {
+			out = append(out, i)
+		}
+	}
+
+	return out
+}
+
+// apply returns a copy of w with the overlays merged in order, the way a JSON
+// merge patch does: maps are merged, null removes a field, anything else
+// replaces it.
+func (l overlayList) apply(w *unstructured.Unstructured, overlays []int) *unstructured.Unstructured {
+	out := w.DeepCopy()
+	for _, i := range overlays {
+		mergeOverlay(out.Object, l[i].patch)
+	}
+
+	return out
+}
+
+func mergeOverlay(dst, patch map[string]interface{}) {
+	for k, v := range patch {
+		if v == nil {
+			delete(dst, k)
+			continue
+		}
+
+		pm, ok := v.(map[string]interface{})
+		if !ok {
+			dst[k] = v
+			continue
+		}
+
+		dm, ok := dst[k].(map[string]interface{})
+		if !ok {
+			dm = map[string]interface{}{}
+			dst[k] = dm
+		}
+
+		mergeOverlay(dm, pm)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	patchMerge     = "merge"
+	patchJSON      = "json"
+	patchStrategic = "strategic"
+	patchMixed     = "mixed"
+)
+
+// patchTypes is the rotation used by the mixed mode.
+var patchTypes = []string{patchMerge, patchJSON, patchStrategic}
+
+func validatePatchType(t string) error {
+	switch t {
+	case patchMerge, patchJSON, patchStrategic, patchMixed:
+		return nil
+	}
+
+	return fmt.Errorf("unknown patch type %q, expecting one of %s", t, strings.Join(append(patchTypes, patchMixed), "|"))
+}
+
+// pickPatchType resolves the mixed mode to a concrete encoding, cycling by the
+// update sequence so each encoding gets the same share of the traffic.
+func pickPatchType(t string, seq int) string {
+	if t != patchMixed {
+		return t
+	}
+
+	return patchTypes[seq%len(patchTypes)]
+}
+
+// labelPatch builds a patch setting label key=value on obj, encoded as
+// patchType. The logical mutation is the same for all encodings, so the
+// latency difference is down to the apiserver patch handling. annotations,
+// e.g. the stamp of the write, are set along with the label.
+func labelPatch(patchType string, obj *unstructured.Unstructured, key, value string, annotations map[string]string) (client.Patch, error) {
+	switch patchType {
+	case patchMerge:
+		original := obj.DeepCopy()
+
+		labels := obj.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+
+		labels[key] = value
+		obj.SetLabels(labels)
+		setAnnotations(obj, annotations)
+
+		return client.MergeFrom(original), nil
+
+	case patchJSON:
+		var ops []map[string]interface{}
+		if obj.GetLabels() == nil {
+			ops = append(ops, map[string]interface{}{
+				"op": "add", "path": "/metadata/labels", "value": map[string]string{key: value},
+			})
+		} else {
+			ops = append(ops, map[string]interface{}{
+				"op": "add", "path": "/metadata/labels/" + escapeJSONPointer(key), "value": value,
+			})
+		}
+
+		ops = append(ops, annotationOps(obj, annotations)...)
+
+		dat, err := json.Marshal(ops)
+		if err != nil {
+			return nil, err
+		}
+
+		return client.RawPatch(types.JSONPatchType, dat), nil
+
+	case patchStrategic:
+		// custom resources don't support strategic merge patch, the apiserver
+		// will reject it with 415
+		meta := map[string]interface{}{
+			"labels": map[string]string{key: value},
+		}
+
+		if len(annotations) != 0 {
+			meta["annotations"] = annotations
+		}
+
+		dat, err := json.Marshal(map[string]interface{}{"metadata": meta})
+		if err != nil {
+			return nil, err
+		}
+
+		return client.RawPatch(types.StrategicMergePatchType, dat), nil
+	}
+
+	return nil, fmt.Errorf("unknown patch type %q", patchType)
+}
+
+// annotationOps are the JSON patch operations adding annotations to obj.
+func annotationOps(obj *unstructured.Unstructured, annotations map[string]string) []map[string]interface{} {
+	if len(annotations) == 0 {
+		return nil
+	}
+
+	if obj.GetAnnotations() == nil {
+		return []map[string]interface{}{
+			{"op": "add", "path": "/metadata/annotations", "value": annotations},
+		}
+	}
+
+	ops := []map[string]interface{}{}
+	for k, v := range annotations {
+		ops = append(ops, map[string]interface{}{
+			"op": "add", "path": "/metadata/annotations/" + escapeJSONPointer(k), "value": v,
+		})
+	}
+
+	return ops
+}
+
+func setAnnotations(obj *unstructured.Unstructured, annotations map[string]string) {
+	if len(annotations) == 0 {
+		return
+	}
+
+	current := obj.GetAnnotations()
+	if current == nil {
+		current = map[string]string{}
+	}
+
+	for k, v := range annotations {
+		current[k] = v
+	}
+
+	obj.SetAnnotations(current)
+}
+
+func escapeJSONPointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
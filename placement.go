@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	placementObjectPrefix = "load-simulator-placement"
+
+	// placementLabel tells the consumers which Placement a decision is of
+	placementLabel = "cluster.open-cluster-management.io/placement"
+)
+
+var placementDecisionGVK = schema.GroupVersionKind{Group: "cluster.open-cluster-management.io", Version: "v1beta1", Kind: "PlacementDecision"}
+
+// placementDecision is the PlacementDecision of the runner, without status.
+func (r *Runner) placementDecision() *unstructured.Unstructured {
+	name := fmt.Sprintf("%s-%v", placementObjectPrefix, r.index)
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(placementDecisionGVK)
+	obj.SetNamespace(r.template.GetNamespace())
+	obj.SetName(name + "-decision-1")
+	obj.SetLabels(r.labels(map[string]string{placementLabel: name}))
+
+	return obj
+}
+
+// placementSetup creates the namespace and the PlacementDecision of the
+// runner, with its first r.placementClusters clusters.
+func (r *Runner) placementSetup() error {
+	ctx := r.context()
+
+	if err := r.createNamespace(ctx, r.template.GetNamespace()); err != nil {
+		return err
+	}
+
+	obj := r.placementDecision()
+	if err := r.createObject(ctx, "placement/create", obj, r.onAlreadyExists); err != nil {
+		return fmt.Errorf("failed to create PlacementDecision %s, error: %w", obj.GetName(), err)
+	}
+
+	// the offset of the runners are spread over the pool
+	r.placementOffset = r.index % r.placementPool
+
+	return r.placementDecide()
+}
+
+// placementTick flips the membership of the PlacementDecision with a
+// probability of r.placementChurn: one cluster leaves the decisions and the
+// next one of the pool joins, reported as placement/flip. The consumers of
+// the decisions, e.g. the policy and application controllers, then react as
+// if the placement moved.
+func (r *Runner) placementTick(seq int) {
+	if r.random().Float64() >= r.placementChurn {
+		return
+	}
+
+	r.placementOffset = (r.placementOffset + 1) % r.placementPool
+
+	if err := r.placementDecide(); err != nil {
+		r.logger.Error(err, "failed to flip the placement decisions")
+	}
+}
+
+// placementDecide sets the decisions to the r.placementClusters clusters of
+// the pool from the offset on.
+func (r *Runner) placementDecide() error {
+	decisions := []interface{}{}
+	for i := 0; i < r.placementClusters; i++ {
+		decisions = append(decisions, map[string]interface{}{
+			"clusterName": fmt.Sprintf("cluster-%v", (r.placementOffset+i)%r.placementPool),
+			"reason":      "",
+		})
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{"decisions": decisions},
+	})
+	if err != nil {
+		return err
+	}
+
+	obj := r.placementDecision()
+
+	return r.metrics.Time("placement/flip", func() error {
+		return r.Client.Status().Patch(r.context(), obj, client.RawPatch(types.MergePatchType, patch))
+	})
+}
+
+func (r *Runner) placementTeardown() {
+	if !r.fastClean {
+		if err := r.Client.Delete(r.context(), r.placementDecision()); err != nil && !k8serrors.IsNotFound(err) {
+			r.logger.Error(err, "failed to delete the PlacementDecision")
+		}
+	}
+
+	r.delete()
+}
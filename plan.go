@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/go-logr/logr"
+)
+
+// planListLimit caps the objects listed one by one, the counts cover all of
+// them.
+const planListLimit = 20
+
+// planCommand prints what a run with the same flags would create, so a scale
+// test can be reviewed before it runs against a shared cluster.
+func planCommand(args []string, logger logr.Logger) error {
+	o, err := parseOptions("plan", args)
+	if err != nil {
+		return err
+	}
+
+	// the plan doesn't run, it has nothing to record
+	o.state = nil
+
+	if err := o.loadTemplates(); err != nil {
+		return err
+	}
+
+	return printPlan(os.Stdout, o)
+}
+
+func printPlan(out io.Writer, o *options) error {
+
+	fmt.Fprintf(out, "run:         %s\n", o.runID)
+	fmt.Fprintf(out, "mode:        %s\n", o.mode)
+	fmt.Fprintf(out, "clients:     %v\n", o.concurrent)
+	fmt.Fprintf(out, "duration:    %vs\n", o.duration)
+	fmt.Fprintf(out, "interval:    %vms\n", o.interval)
+
+	for _, t := range o.tenants {
+		limit := "their own limits"
+		if t.qps > 0 {
+			limit = fmt.Sprintf("%v QPS", t.qps)
+		}
+
+		fmt.Fprintf(out, "tenant:      %s, %v clients as %s%s in %s-*, %s\n", t.name, t.concurrent, apfUserPrefix, t.name, t.namespacePrefix(o.namespacePrefix), limit)
+	}
+
+	for _, t := range o.templates {
+		dat, err := json.Marshal(t.obj)
+		if err != nil {
+			return fmt.Errorf("failed to marshal template, error: %w", err)
+		}
+
+		fmt.Fprintf(out, "template:    %s %s, %v bytes, weight %v\n", t.obj.GroupVersionKind().String(), t.path, len(dat), t.weight)
+
+		for _, c := range t.classes {
+			fmt.Fprintf(out, "             %v%% of the objects updated every %v\n", c.percent, c.interval)
+		}
+	}
+
+	for _, layout := range o.layouts {
+		fmt.Fprintf(out, "\nnamespace layout %s:\n", layout)
+
+		if o.mode == "target" {
+			fmt.Fprintf(out, "  the target mode creates no object\n")
+		} else if o.workload.setup != nil && !o.workload.template {
+			fmt.Fprintf(out, "  the %s mode doesn't create the template, it creates its own objects\n", o.mode)
+		} else {
+			printObjects(out, o, layout)
+		}
+	}
+
+	ticks := ticksPerSecond(o)
+
+	fmt.Fprintf(out, "\nrequests (%.1f ticks per second per client):\n", ticks)
+
+	clients := float64(o.concurrent * o.batchSize)
+
+	rates := map[string]float64{}
+	for v, n := range o.workload.verbs {
+		rates[v] = n * ticks * clients
+	}
+
+	if o.workload.periodic != nil {
+		if period, verbs := o.workload.periodic(o); period > 0 {
+			for v, n := range verbs {
+				rates[v] += n / period.Seconds() * clients
+			}
+		}
+	}
+
+	verbs := []string{}
+	for v := range rates {
+		verbs = append(verbs, v)
+	}
+
+	sort.Strings(verbs)
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "  VERB\tPER SECOND\tTOTAL\n")
+
+	totalRate := 0.0
+	for _, v := range verbs {
+		rate := rates[v]
+		totalRate += rate
+
+		fmt.Fprintf(tw, "  %s\t%.0f\t%.0f\n", v, rate, rate*float64(o.duration))
+	}
+
+	fmt.Fprintf(tw, "  all\t%.0f\t%.0f\n", totalRate, totalRate*float64(o.duration))
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, t := range o.templates {
+		for _, l := range t.lookups {
+			fmt.Fprintf(out, "\n%s of template %s is looked up from the %s objects when the run starts, the names above don't show them\n", strings.Join(l.path, "."), t.path, l)
+		}
+	}
+
+	if o.mode == "resync-storm" {
+		if o.namespaceLayout == namespaceShared {
+			fmt.Fprintf(out, "\nevery %v minutes, a resync storm lists the objects of the run in the shared namespace and patches all %v of them\n", o.resyncInterval, o.concurrent)
+		} else {
+			fmt.Fprintf(out, "\nevery %v minutes, a resync storm lists the objects of the run in the namespace of the first client and patches its object, the shared namespace layout has it patch all of them\n", o.resyncInterval)
+		}
+	}
+
+	if o.mode == "cached-get" {
+		fmt.Fprintf(out, "\n%v%% of the clients read from the watch cache, the others from etcd\n", o.cachedReads)
+	}
+
+	if o.mode == "rollout" {
+		fmt.Fprintf(out, "\nevery %vs, each client creates %v works at once, %v in all, then deletes them on the next wave\n", o.rolloutEvery, o.rolloutWorks, o.rolloutWorks*o.concurrent)
+	}
+
+	if o.mode == "slow-watch" {
+		fmt.Fprintf(out, "\neach watcher reads %v events per second, the events of the writes above it sees in its namespace pile up in the apiserver\n", o.consumeRate)
+	}
+
+	if o.mode == "lifecycle" {
+		fmt.Fprintf(out, "\neach tick takes a new object through %s, the patch steps send as many patches and the waits hold the next ticks back\n", o.lifecycleSteps)
+	}
+
+	if o.mode == "target" {
+		fmt.Fprintf(out, "\nno object is created, the clients send %s in rotation to the existing objects matching %q\n", strings.Join(o.targetVerbs, ", "), o.targetSelector)
+	}
+
+	if o.mode == "cluster-churn" && o.clusterChurn == clusterChurnBoth {
+		fmt.Fprintf(out, "\neach tick patches both the labels and the status of the ManagedCluster, twice the patches above\n")
+	}
+
+	if o.mode == "placement-churn" {
+		fmt.Fprintf(out, "\nonly %.0f%% of the ticks flip a cluster of a PlacementDecision, the patches above are at most\n", o.placementChurn*100)
+	}
+
+	if o.mode == "fanout" {
+		fmt.Fprintf(out, "\nonly the first client updates the %s, %.1f times per second, every client receives every update\n", o.fanoutKind, ticks)
+	}
+
+	if o.maxObjects > 0 {
+		fmt.Fprintf(out, "\nthe run stops once %v objects are created\n", o.maxObjects)
+	}
+
+	if o.maxRequests > 0 {
+		fmt.Fprintf(out, "\nthe run stops after %v requests\n", o.maxRequests)
+	}
+
+	if o.objectTTL > 0 {
+		fmt.Fprintf(out, "\neach object is recreated every %vs, about %.0f times during the run\n", o.objectTTL, float64(o.duration)/float64(o.objectTTL))
+	}
+
+	if o.malformedPercent > 0 {
+		fmt.Fprintf(out, "%.1f%% of the ticks send a malformed object instead\n", o.malformedPercent)
+	}
+
+	if o.collidePercent > 0 {
+		fmt.Fprintf(out, "%.1f%% of the ticks create a copy of the object under its name instead, rejected as AlreadyExists\n", o.collidePercent)
+	}
+
+	return nil
+}
+
+// printObjects lists the namespaces and objects of the runners, computed the
+// same way the runners do.
+func printObjects(out io.Writer, o *options, layout string) {
+	namespaces := map[string]bool{}
+	kinds := map[string]int{}
+	allocate := o.allocate(nil)
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "  NAMESPACE\tKIND\tNAME\n")
+
+	for idx := 0; idx < o.concurrent; idx++ {
+		opts := append([]Option{WithNameSuffix(idx)}, o.runnerOptions(layout, nil, nil)...)
+
+		r := NewRunner(append(opts, allocate(idx)...)...)
+		r.prepare()
+
+		kinds[r.template.GetKind()] += 1 + len(r.batch)
+
+		ns := r.template.GetNamespace()
+		if ns != "" && !namespaces[ns] {
+			namespaces[ns] = true
+
+			if idx < planListLimit {
+				fmt.Fprintf(tw, "  \tNamespace\t%s\n", ns)
+			}
+		}
+
+		if idx < planListLimit {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", ns, r.template.GetKind(), r.template.GetName())
+
+			for _, m := range r.batch {
+				fmt.Fprintf(tw, "  %s\t%s\t%s\n", ns, m.template.GetKind(), m.template.GetName())
+			}
+		}
+	}
+
+	tw.Flush()
+
+	if o.concurrent > planListLimit {
+		fmt.Fprintf(out, "  ... and %v more\n", o.concurrent-planListLimit)
+	}
+
+	counts := []string{}
+	for _, t := range o.templates {
+		counts = append(counts, fmt.Sprintf("%v %s objects", kinds[t.obj.GetKind()], t.obj.GetKind()))
+	}
+
+	fmt.Fprintf(out, "  %v namespaces, %s\n", len(namespaces), strings.Join(counts, ", "))
+}
+
+// ticksPerSecond is the average ticks per second of a client, with the update
+// classes of the templates.
+func ticksPerSecond(o *options) float64 {
+	base := 0.0
+	if o.interval > 0 {
+		base = 1000 / float64(o.interval)
+	}
+
+	if o.concurrent == 0 {
+		return base
+	}
+
+	sum := 0.0
+	for idx := 0; idx < o.concurrent; idx++ {
+		classes := o.templates[templateFor(o.templates, idx, o.concurrent)].classes
+		if len(classes) == 0 {
+			sum += base
+			continue
+		}
+
+		sum += 1 / classes.classFor(idx, o.concurrent).interval.Seconds()
+	}
+
+	return sum / float64(o.concurrent)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	runnerRunning  = "running"
+	runnerKilled   = "killed"
+	runnerRetired  = "retired"
+	runnerStopped  = "stopped"
+	runnerPanicked = "panicked"
+	runnerStuck    = "stuck"
+
+	// delay before a runner which panicked is restarted
+	panicRestartDelay = time.Second
+)
+
+// runnerHealth is the status of the runner of an index.
+type runnerHealth struct {
+	status   string
+	since    time.Time
+	restarts int
+	panic    string
+	// stalls counts how often the runner got stuck
+	stalls int
+}
+
+// pool manages the runners of a run: it starts a runner per index, restarts
+// the ones which panic, and can be resized or have some runners killed while
+// the run goes on.
+type pool struct {
+	mu      sync.Mutex
+	spawn   func(idx int, opts ...Option) *Runner
+	runners map[int]*Runner
+	health  map[int]*runnerHealth
+	size    int
+
+	stop   <-chan struct{}
+	wg     *sync.WaitGroup
+	logger logr.Logger
+}
+
+func newPool(spawn func(idx int, opts ...Option) *Runner, logger logr.Logger, stop <-chan struct{}, wg *sync.WaitGroup) *pool {
+	return &pool{
+		spawn:   spawn,
+		runners: map[int]*Runner{},
+		health:  map[int]*runnerHealth{},
+		stop:    stop,
+		wg:      wg,
+		logger:  logger,
+	}
+}
+
+// start runs a fresh runner for idx, replacing the previous one. The runner
+// is prepared in its goroutine, a panic there restarts it like one of its
+// work.
+func (p *pool) start(idx int, opts ...Option) {
+	r := p.spawn(idx, opts...)
+	// the supervision doesn't take it for stuck before it's prepared
+	r.beat()
+
+	p.mu.Lock()
+	p.runners[idx] = r
+	p.setStatus(idx, runnerRunning)
+	p.mu.Unlock()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		defer func() {
+			if v := recover(); v != nil {
+				p.panicked(idx, r, v)
+			}
+		}()
+
+		r.prepare()
+		r.work()
+
+		p.mu.Lock()
+		if p.runners[idx] == r && p.health[idx].status == runnerRunning {
+			p.setStatus(idx, runnerStopped)
+		}
+		p.mu.Unlock()
+	}()
+}
+
+// setStatus expects p.mu to be held.
+func (p *pool) setStatus(idx int, status string) {
+	h, ok := p.health[idx]
+	if !ok {
+		h = &runnerHealth{}
+		p.health[idx] = h
+	}
+
+	h.status = status
+	h.since = time.Now()
+}
+
+// panicked restarts the runner after panicRestartDelay, unless the run is
+// over or the runner was replaced meanwhile.
+func (p *pool) panicked(idx int, r *Runner, v interface{}) {
+	p.logger.Error(fmt.Errorf("%v", v), fmt.Sprintf("runner %v panicked, restarting it\n%s", idx, debug.Stack()))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.runners[idx] != r {
+		return
+	}
+
+	p.setStatus(idx, runnerPanicked)
+	p.health[idx].restarts += 1
+	p.health[idx].panic = fmt.Sprintf("%v", v)
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		select {
+		case <-p.stop:
+		case <-time.After(panicRestartDelay):
+			p.mu.Lock()
+			current := p.runners[idx] == r && idx < p.size
+			p.mu.Unlock()
+
+			if current {
+				p.start(idx)
+			}
+		}
+	}()
+}
+
+// resize starts runners up to n, or retires the runners over n, which clean
+// up what they created.
+func (p *pool) resize(n int) {
+	p.mu.Lock()
+	old := p.size
+	p.size = n
+
+	retired := []*Runner{}
+	for idx := n; idx < old; idx++ {
+		if r, ok := p.runners[idx]; ok && p.health[idx].status == runnerRunning {
+			retired = append(retired, r)
+			p.setStatus(idx, runnerRetired)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, r := range retired {
+		r.retire()
+	}
+
+	for idx := old; idx < n; idx++ {
+		p.start(idx)
+	}
+}
+
+func (p *pool) len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.size
+}
+
+// kill stops the runner of idx without any clean up, like a crashing agent.
+// It returns false if the runner wasn't running.
+func (p *pool) kill(idx int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r, ok := p.runners[idx]
+	if !ok {
+		return false
+	}
+
+	if s := p.health[idx].status; s != runnerRunning && s != runnerStuck {
+		return false
+	}
+
+	p.setStatus(idx, runnerKilled)
+	r.kill()
+
+	return true
+}
+
+// report logs how many runners are in each status, and the ones which
+// panicked.
+func (p *pool) report(logger logr.Logger) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	counts := map[string]int{}
+	restarts, stalls := 0, 0
+	for idx, h := range p.health {
+		counts[h.status] += 1
+		restarts += h.restarts
+		stalls += h.stalls
+
+		if h.restarts != 0 {
+			logger.Info(fmt.Sprintf("runner %v restarted %v times after panics, last: %s", idx, h.restarts, h.panic))
+		}
+	}
+
+	out := []string{}
+	for status, n := range counts {
+		out = append(out, fmt.Sprintf("%v %s", n, status))
+	}
+
+	sort.Strings(out)
+
+	logger.Info(fmt.Sprintf("runners: %s, %v restarts, %v stalls", strings.Join(out, ", "), restarts, stalls))
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	restclient "k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// precreateProgressInterval is the interval between the progress logs of the
+// namespace pre-creation.
+const precreateProgressInterval = 5 * time.Second
+
+// createsNamespaces tells whether the runners create their namespaces, with
+// the default setup or the one of their mode.
+func (o *options) createsNamespaces() bool {
+	return !o.reuseNamespaces && (o.workload.setup == nil || modeCreatesNamespaces[o.mode])
+}
+
+// precreate tells whether the namespaces are created before the load.
+func (o *options) precreate() bool {
+	return o.precreateNs && !o.clean && o.createsNamespaces()
+}
+
+// layoutNamespaces are the namespaces of the runners with the namespace
+// layout, computed the same way the runners do.
+func (o *options) layoutNamespaces(layout string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	allocate := o.allocate(nil)
+
+	for idx := 0; idx < o.concurrent; idx++ {
+		opts := append([]Option{WithNameSuffix(idx)}, o.runnerOptions(layout, nil, nil)...)
+
+		r := NewRunner(append(opts, allocate(idx)...)...)
+		r.prepare()
+
+		if ns := r.template.GetNamespace(); ns != "" && !seen[ns] {
+			seen[ns] = true
+			out = append(out, ns)
+		}
+	}
+
+	return out
+}
+
+// precreateNamespaces creates the namespaces of the runners with the
+// namespace layout before the load starts, with o.precreateWorkers requests
+// in flight, so the namespace creation doesn't skew the first minute of the
+// measured load. The progress is logged every precreateProgressInterval.
+func (o *options) precreateNamespaces(ctx context.Context, config *restclient.Config, layout string, logger logr.Logger) error {
+	cl, err := client.New(config, client.Options{})
+	if err != nil {
+		return fmt.Errorf("failed to create client, error: %w", err)
+	}
+
+	names := o.layoutNamespaces(layout)
+
+	labels := map[string]string{}
+	for k, v := range o.namespaceLabels {
+		labels[k] = v
+	}
+
+	if o.runID != "" {
+		labels[runLabel] = o.runID
+	}
+
+	var created, failed int64
+	var lastErr atomic.Value
+
+	start := time.Now()
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(precreateProgressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			logger.Info(fmt.Sprintf("pre-created %v/%v namespaces, %v failed, in %v", atomic.LoadInt64(&created), len(names), atomic.LoadInt64(&failed), time.Since(start).Round(time.Second)))
+		}
+	}()
+
+	parallel(o.precreateWorkers, len(names), func(i int) {
+		ns := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        names[i],
+				Labels:      copyMap(labels),
+				Annotations: copyMap(o.namespaceAnnos),
+			},
+		}
+
+		if err := cl.Create(ctx, ns); err != nil && !k8serrors.IsAlreadyExists(err) {
+			atomic.AddInt64(&failed, 1)
+			lastErr.Store(fmt.Errorf("failed to create namespace %s, error: %w", names[i], err))
+
+			return
+		}
+
+		atomic.AddInt64(&created, 1)
+	})
+
+	close(done)
+
+	if failed != 0 {
+		return fmt.Errorf("%v of the %v namespaces weren't pre-created, the last error: %w", failed, len(names), lastErr.Load().(error))
+	}
+
+	logger.Info(fmt.Sprintf("pre-created the %v namespaces in %v", len(names), time.Since(start).Round(time.Millisecond)))
+
+	return nil
+}
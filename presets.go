@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// presets are named sets of flag values, flags given explicitly on the command
+// line take precedence over the preset.
+var presets = map[string]map[string]string{
+	// load the quota admission controller and the quota status update loop
+	"quota": {
+		"mode":     "quota",
+		"interval": "50",
+	},
+	// a ConfigMap mounted by the pods of 2000 nodes, each kubelet watching it,
+	// updated every second for 10 minutes
+	"configmap-fanout": {
+		"mode":             "fanout",
+		"namespace-layout": "shared",
+		"namespace-prefix": "fanout",
+		"concurrent":       "2000",
+		"fanout-bytes":     "16384",
+		"interval":         "1000",
+		"duration":         "600",
+	},
+	// a hub managing 2000 clusters: a namespace per cluster holding the
+	// ManifestWorks of its addons, whose status the work agents update every
+	// minute, for an hour
+	"acm-2k-clusters": {
+		"mode":             "update",
+		"update":           "true",
+		"template":         "./testdata/manifestwork-template.yaml",
+		"concurrent":       "2000",
+		"batch-size":       "8",
+		"namespace-prefix": "cluster",
+		"interval":         "60000",
+		"duration":         "3600",
+	},
+	// an application rolled out to a fleet of 2000 clusters: every 5 minutes,
+	// 20 new ManifestWorks land in each cluster namespace at once, for half
+	// an hour
+	"acm-2k-clusters-rollout": {
+		"mode":             "rollout",
+		"template":         "./testdata/manifestwork-template.yaml",
+		"concurrent":       "2000",
+		"namespace-prefix": "cluster",
+		"rollout-works":    "20",
+		"rollout-every":    "300",
+		"interval":         "100",
+		"duration":         "1800",
+	},
+	// a hub managing 3500 single node clusters with the policies replicated
+	// to every cluster namespace, the policy framework updating the status of
+	// each replicated policy every 30s, for an hour
+	"acm-3500-clusters-policies": {
+		"mode":             "update",
+		"update":           "true",
+		"template":         "./testdata/policy-template.yaml",
+		"concurrent":       "3500",
+		"batch-size":       "5",
+		"namespace-prefix": "cluster",
+		"interval":         "30000",
+		"duration":         "3600",
+	},
+}
+
+func presetNames() []string {
+	out := []string{}
+	for name := range presets {
+		out = append(out, name)
+	}
+
+	sort.Strings(out)
+
+	return out
+}
+
+func applyPreset(fs *flag.FlagSet, name string) error {
+	if name == "" {
+		return nil
+	}
+
+	values, ok := presets[name]
+	if !ok {
+		return fmt.Errorf("unknown preset %q, expecting one of %s", name, strings.Join(presetNames(), "|"))
+	}
+
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	for k, v := range values {
+		if explicit[k] {
+			continue
+		}
+
+		if err := fs.Set(k, v); err != nil {
+			return fmt.Errorf("preset %s failed to set %s=%s, error: %w", name, k, v, err)
+		}
+	}
+
+	return nil
+}
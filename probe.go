@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+// apiServiceProbe periodically fetches the discovery document of aggregated
+// APIs while the load runs, the extension apiservers tend to fall over before
+// the kube-apiserver does.
+type apiServiceProbe struct {
+	cs       kubernetes.Interface
+	paths    map[string]string
+	interval time.Duration
+	metrics  *Metrics
+	logger   logr.Logger
+}
+
+// newAPIServiceProbe takes APIService names, e.g. v1beta1.metrics.k8s.io.
+func newAPIServiceProbe(config *restclient.Config, apiservices []string, interval time.Duration, metrics *Metrics, logger logr.Logger) (*apiServiceProbe, error) {
+	cs, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset, error: %w", err)
+	}
+
+	p := &apiServiceProbe{
+		cs:       cs,
+		paths:    map[string]string{},
+		interval: interval,
+		metrics:  metrics,
+		logger:   logger,
+	}
+
+	for _, name := range apiservices {
+		parts := strings.SplitN(name, ".", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid APIService name %q, expecting <version>.<group>", name)
+		}
+
+		p.paths[name] = fmt.Sprintf("/apis/%s/%s", parts[1], parts[0])
+	}
+
+	return p, nil
+}
+
+func (p *apiServiceProbe) run(stop <-chan struct{}, wg *sync.WaitGroup) {
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				for name, path := range p.paths {
+					ctx, cancel := context.WithTimeout(context.TODO(), p.interval)
+
+					if err := p.metrics.Time("probe/"+name, func() error {
+						_, err := p.cs.Discovery().RESTClient().Get().AbsPath(path).DoRaw(ctx)
+						return err
+					}); err != nil {
+						p.logger.V(1).Info(fmt.Sprintf("probe %s failed, error: %v", name, err))
+					}
+
+					cancel()
+				}
+			}
+		}
+	}()
+}
+
+func (p *apiServiceProbe) report(logger logr.Logger) {
+	for _, s := range p.metrics.Summary() {
+		if !strings.HasPrefix(s.Op, "probe/") || s.Count == 0 {
+			continue
+		}
+
+		logger.Info(fmt.Sprintf("%s available %.2f%% of %v probes", strings.TrimPrefix(s.Op, "probe/"),
+			float64(s.Count-s.Errors)/float64(s.Count)*100, s.Count))
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const quotaObjectPrefix = "load-simulator-quota"
+
+// quotaSetup creates the namespace with a ResourceQuota and a LimitRange, so
+// the following ticks go through the quota and limit ranger admission.
+func (r *Runner) quotaSetup() error {
+	ctx := r.context()
+	ns := r.template.GetNamespace()
+
+	if err := r.createNamespace(ctx, ns); err != nil {
+		return err
+	}
+
+	hard := resource.MustParse(fmt.Sprintf("%v", r.quotaHard))
+
+	quota := &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: quotaObjectPrefix, Namespace: ns},
+		Spec: corev1.ResourceQuotaSpec{
+			Hard: corev1.ResourceList{
+				corev1.ResourceConfigMaps:            hard,
+				corev1.ResourcePods:                  hard,
+				corev1.ResourceRequestsCPU:           resource.MustParse(fmt.Sprintf("%vm", 10*r.quotaHard)),
+				corev1.ResourceRequestsMemory:        resource.MustParse(fmt.Sprintf("%vMi", 10*r.quotaHard)),
+				corev1.ResourceName("count/secrets"): hard,
+			},
+		},
+	}
+
+	limits := &corev1.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{Name: quotaObjectPrefix, Namespace: ns},
+		Spec: corev1.LimitRangeSpec{
+			Limits: []corev1.LimitRangeItem{
+				{
+					Type: corev1.LimitTypeContainer,
+					DefaultRequest: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("10m"),
+						corev1.ResourceMemory: resource.MustParse("10Mi"),
+					},
+					Default: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("20m"),
+						corev1.ResourceMemory: resource.MustParse("20Mi"),
+					},
+				},
+			},
+		},
+	}
+
+	for _, obj := range []client.Object{quota, limits} {
+		if err := r.Client.Create(ctx, obj); err != nil {
+			if !k8serrors.IsAlreadyExists(err) {
+				return fmt.Errorf("failed to create %s in %s, error: %w", obj.GetObjectKind().GroupVersionKind().Kind, ns, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// quotaTick creates a quota consuming object, alternating between a ConfigMap
+// and a Pod relying on the LimitRange defaults, and deletes the one created
+// r.quotaHard ticks ago. This keeps the namespace around the quota boundary,
+// so the quota controller has to keep the usage up to date and some of the
+// creates get rejected.
+func (r *Runner) quotaTick(seq int) {
+	ctx := r.context()
+
+	if err := r.metrics.Time("quota/create-"+quotaKind(seq), func() error {
+		return r.Client.Create(ctx, r.quotaObject(seq))
+	}); err != nil && !k8serrors.IsForbidden(err) && !k8serrors.IsAlreadyExists(err) {
+		r.logger.Error(err, "failed to create quota consuming object")
+	}
+
+	old := seq - r.quotaHard
+	if old <= 0 {
+		return
+	}
+
+	if err := r.metrics.Time("quota/delete-"+quotaKind(old), func() error {
+		return r.Client.Delete(ctx, r.quotaObject(old))
+	}); err != nil && !k8serrors.IsNotFound(err) {
+		r.logger.Error(err, "failed to delete quota consuming object")
+	}
+}
+
+func quotaKind(seq int) string {
+	if seq%2 == 0 {
+		return "pod"
+	}
+
+	return "configmap"
+}
+
+func (r *Runner) quotaObject(seq int) client.Object {
+	meta := metav1.ObjectMeta{
+		Name:      fmt.Sprintf("%s-%v", quotaObjectPrefix, seq),
+		Namespace: r.template.GetNamespace(),
+	}
+
+	if quotaKind(seq) == "configmap" {
+		return &corev1.ConfigMap{
+			ObjectMeta: meta,
+			Data:       map[string]string{"seq": fmt.Sprintf("%v", seq)},
+		}
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: meta,
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "pause", Image: "k8s.gcr.io/pause:3.5"},
+			},
+		},
+	}
+}
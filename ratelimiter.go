@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	clientmetrics "k8s.io/client-go/tools/metrics"
+)
+
+// limiterWaits records the time the requests wait in the client side QPS
+// limiter of client-go, by verb and resource, since that wait inflates the
+// apparent server latency of the operations. client-go reports it through a
+// process wide hook, so a single run records at a time.
+type limiterWaits struct {
+	mu      sync.Mutex
+	metrics *Metrics
+}
+
+var rateLimiterWaits = &limiterWaits{}
+
+func init() {
+	clientmetrics.RateLimiterLatency = rateLimiterWaits
+}
+
+// set makes m record the waits, nil stops recording.
+func (l *limiterWaits) set(m *Metrics) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.metrics = m
+}
+
+// Observe implements the client-go LatencyMetric, u is the URL template of
+// the request, e.g. /apis/<group>/<version>/namespaces/{namespace}/<resource>/{name}.
+func (l *limiterWaits) Observe(_ context.Context, method string, u url.URL, latency time.Duration) {
+	l.mu.Lock()
+	m := l.metrics
+	l.mu.Unlock()
+
+	if m == nil {
+		return
+	}
+
+	verb, resource := requestVerb(&http.Request{Method: method, URL: &u})
+	m.Observe(verb+"/"+resource, latency, nil)
+}
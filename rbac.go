@@ -0,0 +1,554 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"github.com/go-logr/logr"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// templateResource stands for the resources of the template kinds in
+// modePermissions.
+const templateResource = "<template>"
+
+// permission is a row of the verb/GVK matrix of a run: the verbs it sends to
+// a resource, e.g. pods/eviction.
+type permission struct {
+	group    string
+	resource string
+	verbs    []string
+	// cluster tells the permission is needed in the whole cluster, for a
+	// cluster scoped resource or a list across the namespaces, the other
+	// ones are only needed in the namespaces of the run
+	cluster bool
+	// names restricts the permission to these objects
+	names []string
+}
+
+// modePermissions are the requests of the ticks, and of the setup and the
+// teardown, of each mode. Discovery needs no permission, every
+// authenticated user can read it.
+var modePermissions = map[string][]permission{
+	"update": {
+		{resource: templateResource, verbs: []string{"get", "create", "update", "patch", "delete"}},
+	},
+	"apply-managers": {
+		{resource: templateResource, verbs: []string{"create", "patch", "delete"}},
+	},
+	"webhook": {
+		{resource: templateResource, verbs: []string{"create", "delete"}},
+	},
+	"csr": {
+		{group: "certificates.k8s.io", resource: "certificatesigningrequests", verbs: []string{"create", "delete"}, cluster: true},
+	},
+	"crd-churn": {
+		{group: "apiextensions.k8s.io", resource: "customresourcedefinitions", verbs: []string{"get", "create", "update", "delete"}, cluster: true},
+	},
+	"discovery": {},
+	"stream": {
+		{group: "apps", resource: "deployments", verbs: []string{"create", "delete"}},
+		{resource: "pods", verbs: []string{"list"}},
+		{resource: "pods/exec", verbs: []string{"create"}},
+		{resource: "pods/portforward", verbs: []string{"create"}},
+	},
+	"watch-lag": {
+		{resource: templateResource, verbs: []string{"get", "list", "watch", "create", "patch", "delete"}},
+	},
+	"slow-watch": {
+		{resource: templateResource, verbs: []string{"list", "watch", "create", "patch", "delete"}},
+	},
+	"fanout": {
+		{resource: "configmaps", verbs: []string{"create", "patch", "list", "watch", "delete"}},
+	},
+	"rollout": {
+		{resource: templateResource, verbs: []string{"list", "watch", "create", "delete"}},
+	},
+	"status-feedback": {
+		{resource: templateResource, verbs: []string{"create", "delete"}},
+		{resource: templateResource + "/status", verbs: []string{"patch"}},
+	},
+	"resync-storm": {
+		{resource: templateResource, verbs: []string{"list", "create", "patch", "delete"}},
+	},
+	"cached-get": {
+		{resource: templateResource, verbs: []string{"get", "list", "create", "delete"}},
+	},
+	"bind": {
+		{resource: "pods", verbs: []string{"create", "delete"}},
+		{resource: "pods/binding", verbs: []string{"create"}},
+	},
+	"evict": {
+		{group: "policy", resource: "poddisruptionbudgets", verbs: []string{"create"}},
+		{resource: "nodes", verbs: []string{"list"}, cluster: true},
+		{resource: "pods", verbs: []string{"get", "create"}},
+		{resource: "pods/status", verbs: []string{"patch"}},
+		{resource: "pods/eviction", verbs: []string{"create"}},
+	},
+	"quota": {
+		{resource: "resourcequotas", verbs: []string{"create"}},
+		{resource: "limitranges", verbs: []string{"create"}},
+		{resource: "configmaps", verbs: []string{"create", "delete"}},
+		{resource: "pods", verbs: []string{"create", "delete"}},
+	},
+	"boundary": {
+		{resource: templateResource, verbs: []string{"create", "delete"}},
+	},
+	"placement-churn": {
+		{group: "cluster.open-cluster-management.io", resource: "placementdecisions", verbs: []string{"create", "delete"}},
+		{group: "cluster.open-cluster-management.io", resource: "placementdecisions/status", verbs: []string{"patch"}},
+	},
+	"lifecycle": {
+		{resource: templateResource, verbs: []string{"get", "create", "patch", "delete"}},
+	},
+	"target": {
+		{resource: templateResource, verbs: []string{"get", "list", "patch", "delete"}, cluster: true},
+	},
+	"cluster-churn": {
+		{group: "cluster.open-cluster-management.io", resource: "managedclusters", verbs: []string{"create", "patch", "delete"}, cluster: true},
+		{group: "cluster.open-cluster-management.io", resource: "managedclusters/status", verbs: []string{"patch"}, cluster: true},
+	},
+}
+
+// modeCreatesNamespaces are the modes with a custom setup creating the
+// namespace of the runner, the default setup does too.
+var modeCreatesNamespaces = map[string]bool{
+	"bind": true, "evict": true, "fanout": true, "lifecycle": true, "placement-churn": true,
+	"quota": true, "rollout": true, "slow-watch": true, "stream": true,
+}
+
+func resourceOf(gvk schema.GroupVersionKind) string {
+	plural, _ := meta.UnsafeGuessKindToResource(gvk)
+
+	return plural.Resource
+}
+
+// permissions is the verb/GVK matrix of the run: the requests of its mode,
+// of the namespaces, of the clean up and of the impersonation, merged by
+// resource.
+func (o *options) permissions() []permission {
+	perms := []permission{}
+
+	for _, p := range modePermissions[o.mode] {
+		if p.resource == templateResource || p.resource == templateResource+"/status" {
+			sub := p.resource[len(templateResource):]
+			for _, gvk := range o.templateKinds() {
+				perms = append(perms, permission{group: gvk.Group, resource: resourceOf(gvk) + sub, verbs: p.verbs})
+			}
+
+			continue
+		}
+
+		if p.resource == "configmaps" && o.mode == "fanout" && o.fanoutKind == fanoutSecret {
+			p.resource = "secrets"
+		}
+
+		perms = append(perms, p)
+	}
+
+	// the tokens of the rotations are issued with the credentials of the
+	// kubeconfig, in the namespace of the ServiceAccount
+	if o.rotateEvery > 0 {
+		perms = append(perms, permission{resource: "serviceaccounts/token", verbs: []string{"create"}, cluster: true, names: []string{o.rotateAccount.Name}})
+	}
+
+	// the attribution names the UIDs of the responses
+	if o.apfAttribution {
+		perms = append(perms,
+			permission{group: "flowcontrol.apiserver.k8s.io", resource: "flowschemas", verbs: []string{"list"}, cluster: true},
+			permission{group: "flowcontrol.apiserver.k8s.io", resource: "prioritylevelconfigurations", verbs: []string{"list"}, cluster: true},
+		)
+	}
+
+	// the readiness waits get the objects
+	if o.waitReady != nil {
+		for _, gvk := range o.templateKinds() {
+			perms = append(perms, permission{group: gvk.Group, resource: resourceOf(gvk), verbs: []string{"get"}})
+		}
+	}
+
+	// the shared cache lists and watches what the clients read
+	if o.informer {
+		for _, gvk := range o.templateKinds() {
+			perms = append(perms, permission{group: gvk.Group, resource: resourceOf(gvk), verbs: []string{"list", "watch"}, cluster: true})
+		}
+	}
+
+	// the verification lists the objects in all the namespaces
+	if o.verifyObjs {
+		for _, gvk := range o.templateKinds() {
+			perms = append(perms, permission{group: gvk.Group, resource: resourceOf(gvk), verbs: []string{"list"}, cluster: true})
+		}
+	}
+
+	// the latency measurement watches the objects in all the namespaces
+	if o.objectLatency {
+		for _, gvk := range o.templateKinds() {
+			perms = append(perms, permission{group: gvk.Group, resource: resourceOf(gvk), verbs: []string{"list", "watch"}, cluster: true})
+		}
+	}
+
+	if o.createsNamespaces() {
+		perms = append(perms, permission{resource: "namespaces", verbs: []string{"create", "delete"}, cluster: true})
+	}
+
+	// the clean up lists what the run created in all the namespaces, and the
+	// fast one deletes it by collection
+	if o.cleanTimeout > 0 || o.fastClean {
+		verbs := []string{"list"}
+		if o.fastClean {
+			verbs = append(verbs, "deletecollection")
+		}
+
+		for _, gvk := range o.templateKinds() {
+			perms = append(perms, permission{group: gvk.Group, resource: resourceOf(gvk), verbs: verbs, cluster: true})
+		}
+
+		for _, gvk := range clusterScopedKinds {
+			perms = append(perms, permission{group: gvk.Group, resource: resourceOf(gvk), verbs: verbs, cluster: true})
+		}
+
+		if o.cleanScope != cleanObjects {
+			verbs := []string{"list"}
+			if o.fastClean {
+				verbs = append(verbs, "delete")
+			}
+
+			perms = append(perms, permission{resource: "namespaces", verbs: verbs, cluster: true})
+		}
+	}
+
+	if len(o.identities) != 0 {
+		users := []string{}
+		for _, id := range o.identities {
+			users = append(users, apfUserPrefix+id.name)
+		}
+
+		perms = append(perms, permission{resource: "users", verbs: []string{"impersonate"}, cluster: true, names: users})
+
+		if len(o.identityGroups) != 0 {
+			perms = append(perms, permission{resource: "groups", verbs: []string{"impersonate"}, cluster: true, names: o.identityGroups})
+		}
+	}
+
+	return mergePermissions(perms)
+}
+
+func permissionKey(p permission) string {
+	return fmt.Sprintf("%s/%s/%v/%v", p.group, p.resource, p.cluster, p.names)
+}
+
+// mergePermissions merges the verbs of the permissions of the same resource,
+// sorted by resource.
+func mergePermissions(perms []permission) []permission {
+	merged := map[string]*permission{}
+	verbs := map[string]map[string]bool{}
+	keys := []string{}
+
+	for _, p := range perms {
+		key := permissionKey(p)
+
+		if _, ok := merged[key]; !ok {
+			merged[key] = &permission{group: p.group, resource: p.resource, cluster: p.cluster, names: p.names}
+			verbs[key] = map[string]bool{}
+			keys = append(keys, key)
+		}
+
+		for _, v := range p.verbs {
+			if !verbs[key][v] {
+				verbs[key][v] = true
+				merged[key].verbs = append(merged[key].verbs, v)
+			}
+		}
+	}
+
+	sort.Strings(keys)
+
+	out := []permission{}
+	for _, key := range keys {
+		p := merged[key]
+		sort.Strings(p.verbs)
+		out = append(out, *p)
+	}
+
+	return out
+}
+
+// policyRules are the rules of the permissions of the namespaced resources,
+// or of the cluster scoped ones.
+func policyRules(perms []permission, cluster bool) []rbacv1.PolicyRule {
+	rules := []rbacv1.PolicyRule{}
+	for _, p := range perms {
+		if p.cluster != cluster {
+			continue
+		}
+
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups:     []string{p.group},
+			Resources:     []string{p.resource},
+			ResourceNames: p.names,
+			Verbs:         p.verbs,
+		})
+	}
+
+	return rules
+}
+
+// runNamespaces are the namespaces of the runners with all the namespace
+// layouts.
+func (o *options) runNamespaces() []string {
+	out := []string{}
+	for _, layout := range o.layouts {
+		out = mergeStrings(out, o.layoutNamespaces(layout))
+	}
+
+	return out
+}
+
+// rbacObjects are the ServiceAccount of a least privilege run and what grants
+// it the permissions of the run: a ClusterRole of the namespaced rules, bound
+// in each namespace of the run when the namespaces are reused or for the
+// whole cluster when the run creates them, and a ClusterRole of the cluster
+// scoped rules, bound for the whole cluster.
+type rbacObjects struct {
+	name      string
+	namespace string
+	perms     []permission
+	// namespaces are the namespaces the namespaced rules are bound in, all
+	// of them when empty
+	namespaces []string
+	// users are the impersonated identities, which need the rules as well
+	users []string
+}
+
+// runRBAC are the objects granting the permissions of the run of args.
+func runRBAC(command, name, namespace string, args []string) (rbacObjects, error) {
+	b := rbacObjects{name: name, namespace: namespace}
+
+	o, err := parseOptions(command, args)
+	if err != nil {
+		return b, err
+	}
+
+	// the RBAC is derived from the flags, there's no run to record
+	o.state = nil
+
+	if err := o.loadTemplates(); err != nil {
+		return b, err
+	}
+
+	b.perms = o.permissions()
+
+	if o.reuseNamespaces {
+		b.namespaces = o.runNamespaces()
+	}
+
+	for _, id := range o.identities {
+		b.users = append(b.users, apfUserPrefix+id.name)
+	}
+
+	return b, nil
+}
+
+func (b rbacObjects) subjects() []rbacv1.Subject {
+	subjects := []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: b.name, Namespace: b.namespace}}
+	for _, u := range b.users {
+		subjects = append(subjects, rbacv1.Subject{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: u})
+	}
+
+	return subjects
+}
+
+func (b rbacObjects) objects() []client.Object {
+	objectMeta := func(name, namespace string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: map[string]string{"app.kubernetes.io/managed-by": "load-simulator"}}
+	}
+
+	objs := []client.Object{&corev1.ServiceAccount{ObjectMeta: objectMeta(b.name, b.namespace)}}
+
+	if rules := policyRules(b.perms, false); len(rules) != 0 {
+		role := rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: b.name}
+
+		objs = append(objs, &rbacv1.ClusterRole{ObjectMeta: objectMeta(b.name, ""), Rules: rules})
+
+		if len(b.namespaces) == 0 {
+			objs = append(objs, &rbacv1.ClusterRoleBinding{ObjectMeta: objectMeta(b.name, ""), RoleRef: role, Subjects: b.subjects()})
+		}
+
+		for _, ns := range b.namespaces {
+			objs = append(objs, &rbacv1.RoleBinding{ObjectMeta: objectMeta(b.name, ns), RoleRef: role, Subjects: b.subjects()})
+		}
+	}
+
+	if rules := policyRules(b.perms, true); len(rules) != 0 {
+		name := b.name + "-cluster"
+		role := rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: name}
+
+		objs = append(objs,
+			&rbacv1.ClusterRole{ObjectMeta: objectMeta(name, ""), Rules: rules},
+			&rbacv1.ClusterRoleBinding{ObjectMeta: objectMeta(name, ""), RoleRef: role, Subjects: b.subjects()},
+		)
+	}
+
+	return objs
+}
+
+// install creates the objects, the rules of the existing ClusterRoles are
+// updated and the other existing objects kept.
+func (b rbacObjects) install(ctx context.Context, cl client.Client) error {
+	for _, obj := range b.objects() {
+		if role, ok := obj.(*rbacv1.ClusterRole); ok {
+			if err := createOrUpdate(ctx, cl, role, &rbacv1.ClusterRole{}, func(current client.Object) {
+				current.(*rbacv1.ClusterRole).Rules = role.Rules
+			}); err != nil {
+				return fmt.Errorf("failed to install ClusterRole %s, error: %w", role.Name, err)
+			}
+
+			continue
+		}
+
+		if err := cl.Create(ctx, obj); err != nil && !k8serrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create %T %s, error: %w", obj, obj.GetName(), err)
+		}
+	}
+
+	return nil
+}
+
+// uninstall deletes the objects in the reverse order, the missing ones are
+// skipped.
+func (b rbacObjects) uninstall(ctx context.Context, cl client.Client) error {
+	objs := b.objects()
+	for i := len(objs) - 1; i >= 0; i-- {
+		if err := cl.Delete(ctx, objs[i]); err != nil && !k8serrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete %T %s, error: %w", objs[i], objs[i].GetName(), err)
+		}
+	}
+
+	return nil
+}
+
+// kubeconfig is a kubeconfig of the server of config authenticating as the
+// ServiceAccount with a token valid for ttl seconds.
+func (b rbacObjects) kubeconfig(ctx context.Context, config *restclient.Config, ttl int64) ([]byte, error) {
+	cs, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset, error: %w", err)
+	}
+
+	token, err := cs.CoreV1().ServiceAccounts(b.namespace).CreateToken(ctx, b.name, &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{ExpirationSeconds: &ttl},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to request a token of ServiceAccount %s/%s, error: %w", b.namespace, b.name, err)
+	}
+
+	ca := config.CAData
+	if len(ca) == 0 && config.CAFile != "" {
+		if ca, err = ioutil.ReadFile(config.CAFile); err != nil {
+			return nil, fmt.Errorf("failed to read the CA of the server, error: %w", err)
+		}
+	}
+
+	kc := clientcmdapi.NewConfig()
+	kc.Clusters[b.name] = &clientcmdapi.Cluster{Server: config.Host, CertificateAuthorityData: ca, InsecureSkipTLSVerify: config.Insecure}
+	kc.AuthInfos[b.name] = &clientcmdapi.AuthInfo{Token: token.Status.Token}
+	kc.Contexts[b.name] = &clientcmdapi.Context{Cluster: b.name, AuthInfo: b.name, Namespace: b.namespace}
+	kc.CurrentContext = b.name
+
+	return clientcmd.Write(*kc)
+}
+
+// rbacCommand creates a ServiceAccount with the permissions the run given
+// after "--" needs and nothing more, writes and prints a kubeconfig of it,
+// then removes it all once interrupted, so scale tests run with least
+// privilege.
+func rbacCommand(args []string, logger logr.Logger) error {
+	fs := flag.NewFlagSet("rbac", flag.ContinueOnError)
+
+	kubeconfig := fs.String("kubeconfig", os.Getenv("KUBECONFIG"), "absolute path to the kubeconfig file, its user needs to manage ServiceAccounts and RBAC and to grant the permissions of the run")
+	name := fs.String("name", "load-simulator", "name of the ServiceAccount, the ClusterRoles and their bindings")
+	namespace := fs.String("namespace", "default", "namespace of the ServiceAccount")
+	out := fs.String("kubeconfig-out", "./load-simulator-rbac.kubeconfig", "path the kubeconfig of the ServiceAccount is written to")
+	ttl := fs.Int64("token-ttl", 86400, "seconds the token of the kubeconfig is valid for, the apiserver may shorten it")
+	newGuard := guardFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	guard, err := newGuard()
+	if err != nil {
+		return err
+	}
+
+	b, err := runRBAC("rbac", *name, *namespace, fs.Args())
+	if err != nil {
+		return err
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to load rest.Config, error: %w", err)
+	}
+
+	if err := guard.check(*kubeconfig, config.Host); err != nil {
+		return err
+	}
+
+	cl, err := client.New(config, client.Options{})
+	if err != nil {
+		return fmt.Errorf("failed to create client, error: %w", err)
+	}
+
+	ctx := context.TODO()
+
+	if err := b.install(ctx, cl); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := b.uninstall(ctx, cl); err != nil {
+			logger.Error(err, "failed to remove the ServiceAccount and its permissions")
+			return
+		}
+
+		logger.Info(fmt.Sprintf("removed ServiceAccount %s/%s and its permissions", b.namespace, b.name))
+	}()
+
+	dat, err := b.kubeconfig(ctx, config, *ttl)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(*out, dat, 0600); err != nil {
+		return fmt.Errorf("failed to write %s, error: %w", *out, err)
+	}
+
+	fmt.Printf("%s\n", dat)
+
+	logger.Info(fmt.Sprintf("created ServiceAccount %s/%s with %v permissions, its kubeconfig is %s; interrupt to remove them once the run is done", b.namespace, b.name, len(b.perms), *out))
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	<-c
+
+	return nil
+}
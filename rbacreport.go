@@ -0,0 +1,179 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ghodss/yaml"
+	"github.com/go-logr/logr"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+const (
+	rbacReportTable = "table"
+	rbacReportYAML  = "yaml"
+)
+
+// rbacReportCommand prints the permissions the phases of a scenario, or the
+// run given after "--", need, without touching the cluster, so they can be
+// reviewed before granting them.
+func rbacReportCommand(args []string, logger logr.Logger) error {
+	fs := flag.NewFlagSet("rbac-report", flag.ContinueOnError)
+
+	path := fs.String("f", "", "path to the scenario YAML file, the run given after -- when empty")
+	output := fs.String("o", rbacReportTable, "output format, table lists the permissions with the phases needing them, yaml prints the RBAC objects the rbac command would create")
+	name := fs.String("name", "load-simulator", "name of the ServiceAccount, the ClusterRoles and their bindings of the yaml output")
+	namespace := fs.String("namespace", "default", "namespace of the ServiceAccount of the yaml output")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *output != rbacReportTable && *output != rbacReportYAML {
+		return fmt.Errorf("unknown output %q, expecting %s|%s", *output, rbacReportTable, rbacReportYAML)
+	}
+
+	phases := []phase{{Name: "run", Args: fs.Args()}}
+	if *path != "" {
+		s, err := loadScenario(*path)
+		if err != nil {
+			return err
+		}
+
+		phases = s.order()
+	}
+
+	all := rbacObjects{name: *name, namespace: *namespace}
+	needed := map[string][]string{}
+
+	for i, p := range phases {
+		b, err := runRBAC("rbac-report", *name, *namespace, p.args())
+		if err != nil {
+			return fmt.Errorf("failed to parse the flags of phase %s, error: %w", p.Name, err)
+		}
+
+		for _, perm := range b.perms {
+			key := permissionKey(perm)
+			needed[key] = append(needed[key], p.Name)
+		}
+
+		if i == 0 {
+			all = b
+			continue
+		}
+
+		all = all.merge(b)
+	}
+
+	if *output == rbacReportYAML {
+		return printRBACObjects(all)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "API GROUP\tRESOURCE\tVERBS\tSCOPE\tNAMES\tPHASES\n")
+
+	for _, p := range all.perms {
+		group := p.group
+		if group == "" {
+			group = "core"
+		}
+
+		scope := "run namespaces"
+		if p.cluster {
+			scope = "cluster"
+		} else if len(all.namespaces) == 0 {
+			// the run creates its namespaces, they can't be bound beforehand
+			scope = "cluster (namespaces created by the run)"
+		}
+
+		names := strings.Join(p.names, ",")
+		if names == "" {
+			names = "*"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", group, p.resource, strings.Join(p.verbs, ","), scope, names, strings.Join(needed[permissionKey(p)], ","))
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(all.namespaces) != 0 {
+		fmt.Printf("\nthe namespaced permissions are bound in %v namespaces: %s\n", len(all.namespaces), strings.Join(all.namespaces, ", "))
+	}
+
+	if len(all.users) != 0 {
+		fmt.Printf("\nthe impersonated users %s need the permissions as well\n", strings.Join(all.users, ", "))
+	}
+
+	return nil
+}
+
+// merge grants the permissions of both b and other. The namespaced ones are
+// bound for the whole cluster as soon as one of them is.
+func (b rbacObjects) merge(other rbacObjects) rbacObjects {
+	out := rbacObjects{name: b.name, namespace: b.namespace}
+	out.perms = mergePermissions(append(append([]permission{}, b.perms...), other.perms...))
+	out.users = mergeStrings(b.users, other.users)
+
+	if b.clusterWide() || other.clusterWide() {
+		return out
+	}
+
+	out.namespaces = mergeStrings(b.namespaces, other.namespaces)
+
+	return out
+}
+
+// clusterWide tells the namespaced permissions are bound for the whole
+// cluster.
+func (b rbacObjects) clusterWide() bool {
+	return len(b.namespaces) == 0 && len(policyRules(b.perms, false)) != 0
+}
+
+func mergeStrings(a, b []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+
+	for _, s := range append(append([]string{}, a...), b...) {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+
+	sort.Strings(out)
+
+	return out
+}
+
+// printRBACObjects prints the objects as a multi-document YAML, which kubectl
+// applies.
+func printRBACObjects(b rbacObjects) error {
+	docs := []string{}
+
+	for _, obj := range b.objects() {
+		gvk, err := apiutil.GVKForObject(obj, scheme.Scheme)
+		if err != nil {
+			return err
+		}
+
+		obj.GetObjectKind().SetGroupVersionKind(gvk)
+
+		dat, err := yaml.Marshal(obj)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s %s, error: %w", gvk.Kind, obj.GetName(), err)
+		}
+
+		docs = append(docs, string(dat))
+	}
+
+	fmt.Print(strings.Join(docs, "---\n"))
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+
+	restclient "k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// splitClient reads with a client of its own, with the read QPS/Burst and
+// its own connections, and writes with writer, so that reads keep flowing
+// while writes are throttled, or the other way around.
+func (r *Runner) splitClient(config *restclient.Config, writer client.Client) (client.Client, error) {
+	readConfig := restclient.CopyConfig(config)
+	readConfig.QPS = r.readQPS
+	readConfig.Burst = r.readBurst
+
+	// the HTTP/2 connections of the clone would still be shared
+	r.readTransport = r.transport.Clone()
+	r.readTransport.TLSNextProto = nil
+
+	if err := r.transportSettings.configure(r.readTransport); err != nil {
+		return nil, err
+	}
+
+	readConfig.Transport = r.readTransport
+
+	reader, err := client.New(readConfig, client.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to create read client, error: %w", r.name, err)
+	}
+
+	return client.NewDelegatingClient(client.NewDelegatingClientInput{
+		CacheReader:       reader,
+		Client:            writer,
+		CacheUnstructured: true,
+	})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	// the throughput is compared over this window once the clients
+	// reconnect
+	reconnectSampleWindow = 5 * time.Second
+	// the throughput recovered once it's back to this share of the baseline
+	reconnectRecovered = 0.9
+	// the baseline is the throughput over up to this long before the restart
+	reconnectBaseline = 30 * time.Second
+)
+
+// reconnect emulates an apiserver rolling restart from the client side: at
+// some point of the run, all the runners drop their connections and pause,
+// then reconnect one after the other over a window. The time until the
+// throughput is back to what it was before is reported.
+type reconnect struct {
+	at     time.Duration
+	pause  time.Duration
+	window time.Duration
+
+	// requests counts the requests of the runners, see Metrics.Count
+	requests *Metrics
+	report   *ReconnectReport
+}
+
+// ReconnectReport is the outcome of the reconnect of a run.
+type ReconnectReport struct {
+	Start time.Time `json:"start"`
+	// Baseline is the requests per second before the restart
+	Baseline float64 `json:"baseline"`
+	// RecoveredAfter is the time since the restart until the throughput was
+	// back to 90% of the baseline
+	RecoveredAfter time.Duration `json:"recoveredAfter,omitempty"`
+	Recovered      bool          `json:"recovered"`
+}
+
+func (c reconnect) enabled() bool {
+	return c.at > 0 && c.requests != nil && c.report != nil
+}
+
+func validateReconnect(at, pause, window int) error {
+	if at < 0 || pause < 0 || window < 0 {
+		return fmt.Errorf("reconnect-at, reconnect-pause and reconnect-window can't be negative")
+	}
+
+	return nil
+}
+
+// run restarts the runners of the pool at c.at and then follows the
+// throughput until it recovers, or the run is over.
+func (c reconnect) run(p *pool, logger logr.Logger, stop <-chan struct{}, wg *sync.WaitGroup) {
+	baseline := reconnectBaseline
+	if c.at/2 < baseline {
+		baseline = c.at / 2
+	}
+
+	wait := func(d time.Duration) bool {
+		select {
+		case <-stop:
+			return false
+		case <-time.After(d):
+			return true
+		}
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		if !wait(c.at - baseline) {
+			return
+		}
+
+		before := c.requests.Count()
+		if !wait(baseline) {
+			return
+		}
+
+		c.report.Start = time.Now()
+		c.report.Baseline = float64(c.requests.Count()-before) / baseline.Seconds()
+
+		killed := []int{}
+		for idx := 0; idx < p.len(); idx++ {
+			if p.kill(idx) {
+				killed = append(killed, idx)
+			}
+		}
+
+		logger.Info(fmt.Sprintf("dropped the connections of %v runners, at %.1f requests per second, reconnecting in %v over %v", len(killed), c.report.Baseline, c.pause, c.window))
+
+		wg.Add(1)
+		go c.respawn(p, killed, logger, stop, wg)
+
+		c.follow(logger, stop)
+	}()
+}
+
+// respawn starts the killed runners again after the pause, spread over the
+// window. Once the run is over, the ones left only clean up.
+func (c reconnect) respawn(p *pool, killed []int, logger logr.Logger, stop <-chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	step := time.Duration(0)
+	if len(killed) > 0 {
+		step = c.window / time.Duration(len(killed))
+	}
+
+	next := c.pause
+	for _, idx := range killed {
+		select {
+		case <-stop:
+			p.start(idx, WithCleanOption(true))
+			continue
+		case <-time.After(next):
+		}
+
+		next = step
+		p.start(idx)
+	}
+
+	logger.Info(fmt.Sprintf("reconnected %v runners", len(killed)))
+}
+
+// follow samples the throughput every second over reconnectSampleWindow,
+// until it's back to reconnectRecovered of the baseline.
+func (c reconnect) follow(logger logr.Logger, stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	samples := []int{c.requests.Count()}
+	window := int(reconnectSampleWindow / time.Second)
+
+	for {
+		select {
+		case <-stop:
+			logger.Info(fmt.Sprintf("the throughput didn't recover to %.1f requests per second before the end of the run", c.report.Baseline))
+			return
+		case <-ticker.C:
+		}
+
+		samples = append(samples, c.requests.Count())
+		if len(samples) <= window {
+			continue
+		}
+
+		samples = samples[len(samples)-window-1:]
+		rate := float64(samples[window]-samples[0]) / reconnectSampleWindow.Seconds()
+
+		if rate >= reconnectRecovered*c.report.Baseline {
+			c.report.Recovered = true
+			c.report.RecoveredAfter = time.Since(c.report.Start)
+
+			logger.Info(fmt.Sprintf("the throughput recovered to %.1f requests per second %v after the restart", rate, c.report.RecoveredAfter.Round(time.Second)))
+
+			return
+		}
+	}
+}
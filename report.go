@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// Report is the outcome of all the runs, written to -report as JSON.
+type Report struct {
+	RunID    string            `json:"runID"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Metadata *RunMetadata      `json:"metadata,omitempty"`
+	Runs     []*RunReport      `json:"runs"`
+}
+
+// RunReport is the outcome of a single run.
+type RunReport struct {
+	NamespaceLayout string             `json:"namespaceLayout"`
+	Start           time.Time          `json:"start"`
+	End             time.Time          `json:"end"`
+	Interrupted     bool               `json:"interrupted,omitempty"`
+	LimitReached    string             `json:"limitReached,omitempty"`
+	Operations      []Summary          `json:"operations"`
+	Requests        []Summary          `json:"requests,omitempty"`
+	Bandwidth       []BandwidthSummary `json:"bandwidth,omitempty"`
+	Throughput      []ThroughputSample `json:"throughput,omitempty"`
+	LimiterWaits    []Summary          `json:"limiterWaits,omitempty"`
+	Endpoints       []Summary          `json:"endpoints,omitempty"`
+	PriorityLevels  []Summary          `json:"priorityLevels,omitempty"`
+	Budgets         []BudgetResult     `json:"budgets,omitempty"`
+	ObjectLatency   []LatencyQuantiles `json:"objectLatency,omitempty"`
+	Thresholds      []ThresholdResult  `json:"latencyThresholds,omitempty"`
+	Reconnect       *ReconnectReport   `json:"reconnect,omitempty"`
+	Consistency     *SequenceReport    `json:"consistency,omitempty"`
+	Observers       []Summary          `json:"observers,omitempty"`
+	Storage         *StorageGrowth     `json:"storage,omitempty"`
+	Verification    *VerifyReport      `json:"verification,omitempty"`
+	Cleanup         *CleanupReport     `json:"cleanup,omitempty"`
+
+	// HubStorage is the storage growth of each hub of a federated run, in
+	// place of Storage
+	HubStorage map[string]*StorageGrowth `json:"hubStorage,omitempty"`
+}
+
+func (r *Report) write(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	dat, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal report, error: %w", err)
+	}
+
+	if err := ioutil.WriteFile(path, dat, 0644); err != nil {
+		return fmt.Errorf("failed to write report to %s, error: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// auditIDHeader is the header the apiserver returns the ID of the audit
+// events of the request in.
+const auditIDHeader = "Audit-Id"
+
+// requestLogEntry is a line of the request log.
+type requestLogEntry struct {
+	Time      time.Time `json:"time"`
+	Verb      string    `json:"verb"`
+	Resource  string    `json:"resource"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status,omitempty"`
+	LatencyMs float64   `json:"latencyMs"`
+	// AuditID joins the request with the audit events of the apiserver
+	AuditID   string `json:"auditID,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// requestLog writes a JSON line per request on the wire slower than
+// slowerThan, for the slow requests to be looked up in the audit log of the
+// apiserver by their audit ID.
+type requestLog struct {
+	mu         sync.Mutex
+	file       *os.File
+	w          *bufio.Writer
+	slowerThan time.Duration
+	logger     logr.Logger
+	failed     bool
+	// closed drops the entries of the requests still in flight, e.g. the
+	// watches, once the log is closed
+	closed bool
+}
+
+func openRequestLog(path string, slowerThan time.Duration, logger logr.Logger) (*requestLog, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request log %s, error: %w", path, err)
+	}
+
+	return &requestLog{file: f, w: bufio.NewWriter(f), slowerThan: slowerThan, logger: logger}, nil
+}
+
+func (l *requestLog) write(e requestLogEntry) {
+	dat, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.failed || l.closed {
+		return
+	}
+
+	if _, err := l.w.Write(append(dat, '\n')); err != nil {
+		// a full disk doesn't fail the run, the log just stops
+		l.failed = true
+		l.logger.Error(err, "failed to write the request log, it stops here")
+	}
+}
+
+func (l *requestLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return nil
+	}
+
+	l.closed = true
+
+	if err := l.w.Flush(); err != nil {
+		l.file.Close()
+		return err
+	}
+
+	return l.file.Close()
+}
+
+type requestLogRoundTripper struct {
+	log  *requestLog
+	next http.RoundTripper
+}
+
+func (rt *requestLogRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := rt.next.RoundTrip(req)
+	latency := time.Since(start)
+
+	if latency < rt.log.slowerThan {
+		return resp, err
+	}
+
+	verb, resource := requestVerb(req)
+	e := requestLogEntry{
+		Time:      start,
+		Verb:      verb,
+		Resource:  resource,
+		Path:      req.URL.Path,
+		LatencyMs: float64(latency) / float64(time.Millisecond),
+		UserAgent: req.UserAgent(),
+	}
+
+	if err != nil {
+		e.Error = err.Error()
+	} else {
+		e.Status = resp.StatusCode
+		e.AuditID = resp.Header.Get(auditIDHeader)
+	}
+
+	rt.log.write(e)
+
+	return resp, err
+}
+
+func wrapRequestLog(l *requestLog) func(http.RoundTripper) http.RoundTripper {
+	return func(next http.RoundTripper) http.RoundTripper {
+		if l == nil {
+			return next
+		}
+
+		return &requestLogRoundTripper{log: l, next: next}
+	}
+}
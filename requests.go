@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// errThrottled marks the requests APF rejected with a 429.
+var errThrottled = errors.New("throttled")
+
+// requestRoundTripper records the time each request spends on the wire, from
+// sending it to the response headers, by verb and resource, e.g.
+// "patch/manifestworks". Unlike the operations, it doesn't include the time
+// spent waiting in the client, so both tell whether the bottleneck is the
+// client or the server. The requests rejected by APF are recorded as
+// "<verb>/<resource>/throttled".
+type requestRoundTripper struct {
+	metrics *Metrics
+	next    http.RoundTripper
+}
+
+func (rt *requestRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	verb, resource := requestVerb(req)
+
+	start := time.Now()
+	resp, err := rt.next.RoundTrip(req)
+
+	// a watch lasts as long as its stream
+	if verb == "watch" {
+		return resp, err
+	}
+
+	op := verb + "/" + resource
+	switch {
+	case err != nil:
+		rt.metrics.Observe(op, time.Since(start), err)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		rt.metrics.Observe(op+"/throttled", time.Since(start), errThrottled)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		rt.metrics.Observe(op, time.Since(start), fmt.Errorf("status %v", resp.StatusCode))
+	default:
+		rt.metrics.Observe(op, time.Since(start), nil)
+	}
+
+	return resp, err
+}
+
+func wrapRequests(m *Metrics) func(http.RoundTripper) http.RoundTripper {
+	return func(next http.RoundTripper) http.RoundTripper {
+		if m == nil {
+			return next
+		}
+
+		return &requestRoundTripper{metrics: m, next: next}
+	}
+}
+
+// requestVerb tells the kubernetes verb and the resource of a request, from
+// /api/v1/namespaces/<ns>/<resource>/<name> or
+// /apis/<group>/<version>/namespaces/<ns>/<resource>/<name>/<subresource>.
+func requestVerb(req *http.Request) (string, string) {
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+
+	switch {
+	case len(parts) >= 2 && parts[0] == "api":
+		parts = parts[2:]
+	case len(parts) >= 3 && parts[0] == "apis":
+		parts = parts[3:]
+	default:
+		// discovery, openapi, metrics...
+		return strings.ToLower(req.Method), "/" + strings.Join(parts, "/")
+	}
+
+	if len(parts) >= 3 && parts[0] == "namespaces" {
+		parts = parts[2:]
+	}
+
+	if len(parts) == 0 {
+		return strings.ToLower(req.Method), "discovery"
+	}
+
+	resource := parts[0]
+	named := len(parts) >= 2
+	if len(parts) >= 3 {
+		resource += "/" + parts[2]
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		if req.URL.Query().Get("watch") == "true" {
+			return "watch", resource
+		}
+
+		if named {
+			return "get", resource
+		}
+
+		return "list", resource
+	case http.MethodPost:
+		return "create", resource
+	case http.MethodPut:
+		return "update", resource
+	case http.MethodPatch:
+		return "patch", resource
+	case http.MethodDelete:
+		if named {
+			return "delete", resource
+		}
+
+		return "deletecollection", resource
+	}
+
+	return strings.ToLower(req.Method), resource
+}
+
+// latencyBudgets is the -latency-budget flag, verb=duration, e.g.
+// get=50ms,patch=200ms.
+type latencyBudgets map[string]time.Duration
+
+func parseLatencyBudgets(s string) (latencyBudgets, error) {
+	out := latencyBudgets{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid latency budget %q, expecting verb=duration", item)
+		}
+
+		d, err := time.ParseDuration(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid latency budget %q, error: %w", item, err)
+		}
+
+		out[strings.TrimSpace(kv[0])] = d
+	}
+
+	return out, nil
+}
+
+// BudgetResult compares the worst p99 of the resources of a verb with its
+// budget.
+type BudgetResult struct {
+	Verb      string        `json:"verb"`
+	Budget    time.Duration `json:"budget"`
+	P99       time.Duration `json:"p99"`
+	Throttled int           `json:"throttled"`
+	Met       bool          `json:"met"`
+}
+
+func (b latencyBudgets) check(requests []Summary) []BudgetResult {
+	p99 := map[string]time.Duration{}
+	throttled := map[string]int{}
+
+	for _, s := range requests {
+		verb := strings.SplitN(s.Op, "/", 2)[0]
+
+		if strings.HasSuffix(s.Op, "/throttled") {
+			throttled[verb] += s.Count
+			continue
+		}
+
+		if s.P99 > p99[verb] {
+			p99[verb] = s.P99
+		}
+	}
+
+	verbs := []string{}
+	for verb := range b {
+		verbs = append(verbs, verb)
+	}
+
+	sort.Strings(verbs)
+
+	out := []BudgetResult{}
+	for _, verb := range verbs {
+		out = append(out, BudgetResult{
+			Verb:      verb,
+			Budget:    b[verb],
+			P99:       p99[verb],
+			Throttled: throttled[verb],
+			Met:       p99[verb] <= b[verb],
+		})
+	}
+
+	return out
+}
+
+func logBudgets(logger logr.Logger, results []BudgetResult) {
+	for _, r := range results {
+		if !r.Met {
+			logger.Error(fmt.Errorf("p99 %v over the %v budget", r.P99, r.Budget), fmt.Sprintf("%s is over budget, %v throttled", r.Verb, r.Throttled))
+			continue
+		}
+
+		logger.Info(fmt.Sprintf("%s: p99 %v within the %v budget, %v throttled", r.Verb, r.P99, r.Budget, r.Throttled))
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// resyncedAtAnnotation is touched on every object by a resync storm.
+const resyncedAtAnnotation = "load-simulator/resynced-at"
+
+// resyncTick emulates a controller restarting every r.resyncInterval: the
+// first runner relists the objects of the run in its namespace, all of them
+// with the shared namespace layout, then touches every one of them with
+// r.resyncWorkers workers. The other runners only hold their object.
+func (r *Runner) resyncTick(seq int) {
+	if r.index != 0 || time.Since(r.lastResync) < r.resyncInterval {
+		return
+	}
+
+	r.lastResync = time.Now()
+
+	start := time.Now()
+	touched, err := r.resyncStorm()
+	r.metrics.Observe("resync/storm", time.Since(start), err)
+
+	if err != nil {
+		r.logger.Error(err, "resync storm failed")
+		return
+	}
+
+	r.logger.Info(fmt.Sprintf("resync storm touched %v objects in %v", touched, time.Since(start)))
+}
+
+func (r *Runner) resyncStorm() (int, error) {
+	ctx := r.context()
+
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(r.template.GroupVersionKind())
+
+	// only the objects of the run, other runs and what isn't the
+	// simulator's are left alone
+	if err := r.metrics.Time("resync/list", func() error {
+		return r.Client.List(ctx, list, client.InNamespace(r.template.GetNamespace()), client.MatchingLabels{runLabel: r.runID})
+	}); err != nil {
+		return 0, fmt.Errorf("failed to relist, error: %w", err)
+	}
+
+	items := make(chan *unstructured.Unstructured)
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < r.resyncWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for obj := range items {
+				patch := []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, resyncedAtAnnotation, time.Now().UTC().Format(time.RFC3339Nano)))
+
+				if err := r.metrics.Time("resync/patch", func() error {
+					return r.Client.Patch(ctx, obj, client.RawPatch(types.MergePatchType, patch))
+				}); err != nil && !k8serrors.IsNotFound(err) {
+					r.logger.V(1).Info(fmt.Sprintf("failed to touch %s/%s, error: %v", obj.GetNamespace(), obj.GetName(), err))
+				}
+			}
+		}()
+	}
+
+	touched := 0
+
+loop:
+	for idx := range list.Items {
+		obj := &list.Items[idx]
+
+		select {
+		case <-r.stop:
+			break loop
+		case items <- obj:
+			touched += 1
+		}
+	}
+
+	close(items)
+	wg.Wait()
+
+	return touched, nil
+}
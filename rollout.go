@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// rolloutLabel tells the works of a runner apart in a shared namespace.
+const rolloutLabel = "load-simulator/rollout"
+
+// rollout starts the waves of the rollout mode: on every wave, all the
+// runners create their works at once, like an application rolled out to the
+// whole fleet.
+type rollout struct {
+	every time.Duration
+	wave  int64
+}
+
+func newRollout(every time.Duration) *rollout {
+	return &rollout{every: every}
+}
+
+func (w *rollout) current() int64 {
+	return atomic.LoadInt64(&w.wave)
+}
+
+// run starts a wave every w.every until stop, the first one after w.every so
+// the runners are set up.
+func (w *rollout) run(logger logr.Logger, stop <-chan struct{}, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(w.every)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			logger.Info(fmt.Sprintf("rollout wave %v", atomic.AddInt64(&w.wave, 1)))
+		}
+	}()
+}
+
+// rolloutState are the works of the runner's wave, by name, until they're
+// applied.
+type rolloutState struct {
+	mu      sync.Mutex
+	wave    int64
+	start   time.Time
+	pending map[string]bool
+	names   []string
+}
+
+// rolloutSetup creates the namespace and starts watching the works of the
+// runner for their Applied condition.
+func (r *Runner) rolloutSetup() error {
+	if err := r.createNamespace(r.context(), r.template.GetNamespace()); err != nil {
+		return err
+	}
+
+	wc, err := client.NewWithWatch(r.config, client.Options{})
+	if err != nil {
+		return fmt.Errorf("failed to create watch client, error: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(r.context())
+	r.watchCancel = cancel
+	r.rolloutState = &rolloutState{pending: map[string]bool{}}
+
+	go r.rolloutWatch(ctx, wc)
+
+	return nil
+}
+
+// rolloutTick checks whether a new wave started, and then deletes the works
+// of the previous wave and creates the r.rolloutWorks works of the new one
+// concurrently, each create being reported as rollout/create.
+func (r *Runner) rolloutTick(seq int) {
+	wave := r.rollout.current()
+
+	s := r.rolloutState
+	s.mu.Lock()
+	if wave <= s.wave {
+		s.mu.Unlock()
+		return
+	}
+
+	previous := s.names
+	if len(s.pending) != 0 {
+		r.logger.Info(fmt.Sprintf("%v works of wave %v weren't applied before wave %v", len(s.pending), s.wave, wave))
+	}
+
+	s.wave, s.start, s.pending, s.names = wave, time.Now(), map[string]bool{}, nil
+	for j := 0; j < r.rolloutWorks; j++ {
+		name := fmt.Sprintf("%s-w%v-%v", r.template.GetName(), wave, j)
+		s.pending[name] = true
+		s.names = append(s.names, name)
+	}
+
+	names := s.names
+	s.mu.Unlock()
+
+	r.rolloutDelete(previous)
+
+	ctx := r.context()
+	wg := &sync.WaitGroup{}
+
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+
+			obj := r.rolloutWork(name)
+			if err := r.createObject(ctx, "rollout/create", obj, r.onAlreadyExists); err != nil {
+				r.logger.Error(err, fmt.Sprintf("failed to create %s", name))
+			}
+		}(name)
+	}
+
+	wg.Wait()
+}
+
+func (r *Runner) rolloutWork(name string) *unstructured.Unstructured {
+	obj := r.object()
+	obj.SetName(name)
+
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	labels[rolloutLabel] = strconv.Itoa(r.index)
+	obj.SetLabels(labels)
+
+	return obj
+}
+
+func (r *Runner) rolloutDelete(names []string) {
+	for _, name := range names {
+		if err := r.metrics.Time("rollout/delete", func() error {
+			return r.Client.Delete(r.context(), r.rolloutWork(name))
+		}); err != nil && !k8serrors.IsNotFound(err) {
+			r.logger.Error(err, fmt.Sprintf("failed to delete %s", name))
+		}
+	}
+}
+
+// rolloutWatch follows the works of the runner until ctx is done. The time
+// from the start of the wave until a work is Applied, by the work agent of
+// the cluster, is reported as rollout/applied, and until all the works of the
+// wave are as rollout/namespace.
+func (r *Runner) rolloutWatch(ctx context.Context, wc client.WithWatch) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(r.template.GroupVersionKind())
+
+	for ctx.Err() == nil {
+		w, err := wc.Watch(ctx, list,
+			client.InNamespace(r.template.GetNamespace()),
+			client.MatchingLabels{rolloutLabel: strconv.Itoa(r.index)},
+		)
+		if err != nil {
+			r.metrics.Observe("rollout/watch", 0, err)
+			time.Sleep(time.Second)
+
+			continue
+		}
+
+		for ev := range w.ResultChan() {
+			if ev.Type != watch.Added && ev.Type != watch.Modified {
+				continue
+			}
+
+			obj, ok := ev.Object.(*unstructured.Unstructured)
+			if !ok || !conditionTrue(obj, "Applied") {
+				continue
+			}
+
+			r.rolloutApplied(obj.GetName())
+		}
+
+		w.Stop()
+	}
+}
+
+func (r *Runner) rolloutApplied(name string) {
+	s := r.rolloutState
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.pending[name] {
+		return
+	}
+
+	delete(s.pending, name)
+	r.metrics.Observe("rollout/applied", time.Since(s.start), nil)
+
+	if len(s.pending) == 0 {
+		r.metrics.Observe("rollout/namespace", time.Since(s.start), nil)
+	}
+}
+
+// conditionTrue tells whether the status condition t of obj is True.
+func conditionTrue(obj *unstructured.Unstructured, t string) bool {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		m, ok := c.(map[string]interface{})
+		if ok && m["type"] == t {
+			return m["status"] == "True"
+		}
+	}
+
+	return false
+}
+
+func (r *Runner) rolloutTeardown() {
+	if r.watchCancel != nil {
+		r.watchCancel()
+	}
+
+	if s := r.rolloutState; s != nil {
+		s.mu.Lock()
+		names, pending := s.names, len(s.pending)
+		s.mu.Unlock()
+
+		if pending != 0 {
+			r.logger.Info(fmt.Sprintf("%v works of the last wave weren't applied, is the work agent of %s running?", pending, r.template.GetNamespace()))
+		}
+
+		if !r.fastClean {
+			r.rolloutDelete(names)
+		}
+	}
+
+	r.delete()
+}
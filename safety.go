@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// defaultProtectedServers matches the server URLs which look like a
+// production cluster, with a prod or production label, or a dash separated
+// part of one, in their host, e.g. api.prod.example.com or prod-east, but not
+// product-dev.
+const defaultProtectedServers = `(^|[/.@-])prod(uction)?([-.:/]|$)`
+
+// safetyGuard refuses to run against a cluster which wasn't meant to be
+// loaded, since a run against the wrong kubeconfig can create thousands of
+// namespaces in a shared cluster.
+type safetyGuard struct {
+	// allowedContexts, when not empty, are the only kubeconfig contexts a run
+	// can use.
+	allowedContexts []string
+	// protected matches the server URLs a run has to be confirmed for.
+	protected *regexp.Regexp
+	confirmed bool
+}
+
+func newSafetyGuard(allowContexts, protectedServers string, confirmed bool) (safetyGuard, error) {
+	g := safetyGuard{confirmed: confirmed}
+
+	for _, c := range strings.Split(allowContexts, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			g.allowedContexts = append(g.allowedContexts, c)
+		}
+	}
+
+	if protectedServers != "" {
+		re, err := regexp.Compile(protectedServers)
+		if err != nil {
+			return g, fmt.Errorf("failed to parse protected-servers, error: %w", err)
+		}
+
+		g.protected = re
+	}
+
+	return g, nil
+}
+
+// guardFlags registers the flags of the safety guard on the flag set of a
+// command writing to the cluster, the guard is built once they're parsed.
+func guardFlags(fs *flag.FlagSet) func() (safetyGuard, error) {
+	allowContexts := fs.String("allow-context", "", "comma separated kubeconfig contexts the command is allowed to use, any context is allowed when empty")
+	protectedServers := fs.String("protected-servers", defaultProtectedServers, "regular expression of the server URLs the command refuses to write to without -yes-i-mean-it, empty disables the check")
+	confirmed := fs.Bool("yes-i-mean-it", false, "confirm the command against a server matching -protected-servers")
+
+	return func() (safetyGuard, error) {
+		return newSafetyGuard(*allowContexts, *protectedServers, *confirmed)
+	}
+}
+
+// check returns an error when the current context of kubeconfig isn't
+// allowed, or when server is protected and the run isn't confirmed.
+func (g safetyGuard) check(kubeconfig, server string) error {
+	if len(g.allowedContexts) != 0 {
+		rules := clientcmd.NewDefaultClientConfigLoadingRules()
+		rules.ExplicitPath = kubeconfig
+
+		raw, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).RawConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load kubeconfig, error: %w", err)
+		}
+
+		allowed := false
+		for _, c := range g.allowedContexts {
+			if c == raw.CurrentContext {
+				allowed = true
+			}
+		}
+
+		if !allowed {
+			return fmt.Errorf("context %q is not in allow-context %s", raw.CurrentContext, strings.Join(g.allowedContexts, ","))
+		}
+	}
+
+	if g.protected != nil && g.protected.MatchString(server) && !g.confirmed {
+		return fmt.Errorf("server %s matches protected-servers %q, pass -yes-i-mean-it to run against it", server, g.protected.String())
+	}
+
+	return nil
+}
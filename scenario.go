@@ -0,0 +1,386 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/go-logr/logr"
+)
+
+const (
+	phaseSucceeded = "succeeded"
+	phaseFailed    = "failed"
+	phaseSkipped   = "skipped"
+)
+
+// scenario is a sequence of runs, e.g. a steady state and then a spike, read
+// from a YAML file.
+type scenario struct {
+	Phases []phase `json:"phases"`
+}
+
+// phase is a run with its own flags. It starts once the phases it depends on
+// succeeded and its condition holds, among the phases ready to start the one
+// with the highest priority goes first.
+type phase struct {
+	Name      string   `json:"name"`
+	Args      []string `json:"args"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+	// When is "<phase>.<metric> <op> <value>", e.g. "steady.errorRate < 0.01",
+	// the metrics are errorRate, p99 in milliseconds and requests.
+	When     string `json:"when,omitempty"`
+	Priority int    `json:"priority,omitempty"`
+	// Reconnect drops all the connections during the phase and reconnects
+	// them, like an apiserver rolling restart
+	Reconnect *phaseReconnect `json:"reconnect,omitempty"`
+}
+
+// phaseReconnect is in seconds, see -reconnect-at, -reconnect-pause and
+// -reconnect-window.
+type phaseReconnect struct {
+	At     int `json:"at"`
+	Pause  int `json:"pause,omitempty"`
+	Window int `json:"window,omitempty"`
+}
+
+// args are the flags of the phase's run.
+func (p phase) args() []string {
+	args := append([]string{}, p.Args...)
+
+	rc := p.Reconnect
+	if rc == nil {
+		return args
+	}
+
+	args = append(args, "-reconnect-at", strconv.Itoa(rc.At))
+
+	// the flags default to a 5s pause and a 30s window
+	if rc.Pause > 0 {
+		args = append(args, "-reconnect-pause", strconv.Itoa(rc.Pause))
+	}
+
+	if rc.Window > 0 {
+		args = append(args, "-reconnect-window", strconv.Itoa(rc.Window))
+	}
+
+	return args
+}
+
+type phaseResult struct {
+	status string
+	reason string
+	report *Report
+}
+
+// scenarioCommand runs the phases of a scenario one after the other, each of
+// them as a run of its own.
+func scenarioCommand(args []string, logger logr.Logger) error {
+	fs := flag.NewFlagSet("scenario", flag.ContinueOnError)
+
+	path := fs.String("f", "", "path to the scenario YAML file")
+	reportDir := fs.String("report-dir", "", "directory of the reports of the phases, <phase>.json, defaults to a temporary directory")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	s, err := loadScenario(*path)
+	if err != nil {
+		return err
+	}
+
+	if *reportDir == "" {
+		if *reportDir, err = ioutil.TempDir("", "load-simulator-scenario-"); err != nil {
+			return fmt.Errorf("failed to create the report directory, error: %w", err)
+		}
+	}
+
+	bin, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the load-simulator binary, error: %w", err)
+	}
+
+	results := map[string]*phaseResult{}
+	for _, p := range s.order() {
+		res := s.runPhase(p, results, bin, *reportDir, logger)
+		results[p.Name] = res
+
+		logger.Info(fmt.Sprintf("phase %s %s %s", p.Name, res.status, res.reason))
+	}
+
+	failed := []string{}
+	for _, p := range s.Phases {
+		if results[p.Name].status == phaseFailed {
+			failed = append(failed, p.Name)
+		}
+	}
+
+	logger.Info(fmt.Sprintf("the reports of the phases are in %s", *reportDir))
+
+	if len(failed) != 0 {
+		return fmt.Errorf("phases %s failed", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+func loadScenario(path string) (*scenario, error) {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario, error: %w", err)
+	}
+
+	s := &scenario{}
+	if err := yaml.Unmarshal(dat, s); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario, error: %w", err)
+	}
+
+	return s, s.validate()
+}
+
+func (s *scenario) validate() error {
+	if len(s.Phases) == 0 {
+		return fmt.Errorf("the scenario has no phase")
+	}
+
+	names := map[string]bool{}
+	for _, p := range s.Phases {
+		if p.Name == "" {
+			return fmt.Errorf("a phase has no name")
+		}
+
+		if names[p.Name] {
+			return fmt.Errorf("phase %s is defined twice", p.Name)
+		}
+
+		names[p.Name] = true
+
+		if p.Reconnect != nil && p.Reconnect.At <= 0 {
+			return fmt.Errorf("the reconnect of phase %s needs a positive at", p.Name)
+		}
+	}
+
+	for _, p := range s.Phases {
+		for _, d := range p.DependsOn {
+			if !names[d] {
+				return fmt.Errorf("phase %s depends on unknown phase %s", p.Name, d)
+			}
+		}
+
+		if p.When != "" {
+			c, err := parseCondition(p.When)
+			if err != nil {
+				return fmt.Errorf("invalid condition of phase %s, error: %w", p.Name, err)
+			}
+
+			if !names[c.phase] {
+				return fmt.Errorf("the condition of phase %s refers to unknown phase %s", p.Name, c.phase)
+			}
+		}
+	}
+
+	if len(s.order()) != len(s.Phases) {
+		return fmt.Errorf("the dependencies of the phases have a cycle")
+	}
+
+	return nil
+}
+
+// order sorts the phases by their dependencies, the ones referred to by a
+// condition count as dependencies. Among the phases ready to start, the
+// highest priority goes first, then the order of the file. Phases in a cycle
+// are left out.
+func (s *scenario) order() []phase {
+	after := map[string][]string{}
+	for _, p := range s.Phases {
+		after[p.Name] = append([]string{}, p.DependsOn...)
+
+		if c, err := parseCondition(p.When); err == nil && p.When != "" {
+			after[p.Name] = append(after[p.Name], c.phase)
+		}
+	}
+
+	done := map[string]bool{}
+	out := []phase{}
+
+	for len(out) < len(s.Phases) {
+		ready := []int{}
+		for i, p := range s.Phases {
+			if done[p.Name] {
+				continue
+			}
+
+			ok := true
+			for _, d := range after[p.Name] {
+				ok = ok && done[d]
+			}
+
+			if ok {
+				ready = append(ready, i)
+			}
+		}
+
+		if len(ready) == 0 {
+			return out
+		}
+
+		sort.SliceStable(ready, func(i, j int) bool {
+			return s.Phases[ready[i]].Priority > s.Phases[ready[j]].Priority
+		})
+
+		p := s.Phases[ready[0]]
+		done[p.Name] = true
+		out = append(out, p)
+	}
+
+	return out
+}
+
+// runPhase runs the binary with the flags of the phase, unless a dependency
+// didn't succeed or the condition doesn't hold.
+func (s *scenario) runPhase(p phase, results map[string]*phaseResult, bin, reportDir string, logger logr.Logger) *phaseResult {
+	for _, d := range p.DependsOn {
+		if results[d].status != phaseSucceeded {
+			return &phaseResult{status: phaseSkipped, reason: fmt.Sprintf("(%s %s)", d, results[d].status)}
+		}
+	}
+
+	if p.When != "" {
+		c, _ := parseCondition(p.When)
+
+		ok, err := c.holds(results[c.phase])
+		if err != nil {
+			return &phaseResult{status: phaseSkipped, reason: fmt.Sprintf("(%v)", err)}
+		}
+
+		if !ok {
+			return &phaseResult{status: phaseSkipped, reason: fmt.Sprintf("(%s doesn't hold)", p.When)}
+		}
+	}
+
+	reportPath := filepath.Join(reportDir, p.Name+".json")
+
+	logger.Info(fmt.Sprintf("phase %s starts: %s", p.Name, strings.Join(p.args(), " ")))
+
+	cmd := exec.Command(bin, append(p.args(), "-report", reportPath)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	start := time.Now()
+	if err := cmd.Run(); err != nil {
+		return &phaseResult{status: phaseFailed, reason: fmt.Sprintf("(%v)", err)}
+	}
+
+	res := &phaseResult{status: phaseSucceeded, reason: fmt.Sprintf("in %v", time.Since(start).Truncate(time.Second))}
+
+	dat, err := ioutil.ReadFile(reportPath)
+	if err != nil {
+		logger.Error(err, fmt.Sprintf("failed to read the report of phase %s", p.Name))
+		return res
+	}
+
+	res.report = &Report{}
+	if err := json.Unmarshal(dat, res.report); err != nil {
+		logger.Error(err, fmt.Sprintf("failed to parse the report of phase %s", p.Name))
+		res.report = nil
+	}
+
+	return res
+}
+
+// condition is "<phase>.<metric> <op> <value>".
+type condition struct {
+	phase  string
+	metric string
+	op     string
+	value  float64
+}
+
+func parseCondition(s string) (condition, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 3 {
+		return condition{}, fmt.Errorf("%q isn't <phase>.<metric> <op> <value>", s)
+	}
+
+	idx := strings.LastIndex(fields[0], ".")
+	if idx <= 0 {
+		return condition{}, fmt.Errorf("%q isn't <phase>.<metric>", fields[0])
+	}
+
+	c := condition{phase: fields[0][:idx], metric: fields[0][idx+1:], op: fields[1]}
+
+	switch c.metric {
+	case "errorRate", "p99", "requests":
+	default:
+		return condition{}, fmt.Errorf("unknown metric %q, errorRate|p99|requests", c.metric)
+	}
+
+	switch c.op {
+	case "<", "<=", ">", ">=":
+	default:
+		return condition{}, fmt.Errorf("unknown operator %q, <|<=|>|>=", c.op)
+	}
+
+	v, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil {
+		return condition{}, fmt.Errorf("invalid value %q, error: %w", fields[2], err)
+	}
+
+	c.value = v
+
+	return c, nil
+}
+
+// holds evaluates the condition against the report of the phase it refers to,
+// over all the operations of its runs.
+func (c condition) holds(res *phaseResult) (bool, error) {
+	if res == nil || res.report == nil {
+		return false, fmt.Errorf("no report of phase %s", c.phase)
+	}
+
+	count, errs := 0, 0
+	var p99 time.Duration
+	for _, run := range res.report.Runs {
+		for _, op := range run.Operations {
+			count += op.Count
+			errs += op.Errors
+
+			if op.P99 > p99 {
+				p99 = op.P99
+			}
+		}
+	}
+
+	var v float64
+	switch c.metric {
+	case "errorRate":
+		if count != 0 {
+			v = float64(errs) / float64(count)
+		}
+	case "p99":
+		v = float64(p99) / float64(time.Millisecond)
+	case "requests":
+		v = float64(count)
+	}
+
+	switch c.op {
+	case "<":
+		return v < c.value, nil
+	case "<=":
+		return v <= c.value, nil
+	case ">":
+		return v > c.value, nil
+	default:
+		return v >= c.value, nil
+	}
+}
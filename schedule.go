@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// loadScale multiplies the request rate of all the runners, it's shared by
+// them and changed by the schedule.
+type loadScale struct {
+	bits uint64
+}
+
+func newLoadScale() *loadScale {
+	s := &loadScale{}
+	s.set(1)
+
+	return s
+}
+
+func (s *loadScale) get() float64 {
+	if s == nil {
+		return 1
+	}
+
+	return math.Float64frombits(atomic.LoadUint64(&s.bits))
+}
+
+func (s *loadScale) set(v float64) {
+	atomic.StoreUint64(&s.bits, math.Float64bits(v))
+}
+
+// scaleInterval shortens the interval by the scale, e.g. scale=3 ticks 3
+// times as often.
+func scaleInterval(interval time.Duration, scale float64) time.Duration {
+	if scale <= 0 {
+		return interval
+	}
+
+	d := time.Duration(float64(interval) / scale)
+	if d <= 0 {
+		d = time.Nanosecond
+	}
+
+	return d
+}
+
+// scheduleEntry is a cron expression, minute hour day-of-month month
+// day-of-week, followed by the scale which applies from then on, e.g.
+// "0 9 * * 1-5 scale=3".
+type scheduleEntry struct {
+	expr   string
+	fields [5]map[int]bool
+	// day of month and day of week are OR-ed when both are restricted
+	domAny, dowAny bool
+	scale          float64
+}
+
+var cronRanges = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+// parseSchedule parses ";" separated schedule entries.
+func parseSchedule(s string) ([]scheduleEntry, error) {
+	out := []scheduleEntry{}
+
+	for _, e := range strings.Split(s, ";") {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+
+		parts := strings.Fields(e)
+		if len(parts) != 6 || !strings.HasPrefix(parts[5], "scale=") {
+			return nil, fmt.Errorf("invalid schedule entry %q, expecting \"<minute> <hour> <day of month> <month> <day of week> scale=<n>\"", e)
+		}
+
+		scale, err := strconv.ParseFloat(strings.TrimPrefix(parts[5], "scale="), 64)
+		if err != nil || scale <= 0 {
+			return nil, fmt.Errorf("invalid scale in schedule entry %q, it has to be a positive number", e)
+		}
+
+		entry := scheduleEntry{expr: e, scale: scale, domAny: parts[2] == "*", dowAny: parts[4] == "*"}
+		for i := 0; i < 5; i++ {
+			f, err := parseCronField(parts[i], cronRanges[i][0], cronRanges[i][1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid schedule entry %q, error: %w", e, err)
+			}
+
+			entry.fields[i] = f
+		}
+
+		out = append(out, entry)
+	}
+
+	return out, nil
+}
+
+// parseCronField supports *, n, a-b, lists of them and /step.
+func parseCronField(s string, min, max int) (map[int]bool, error) {
+	out := map[int]bool{}
+
+	for _, part := range strings.Split(s, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+
+			step, part = n, part[:i]
+		}
+
+		lo, hi := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+
+			a, err1 := strconv.Atoi(bounds[0])
+			b, err2 := strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("invalid range %q", part)
+			}
+
+			lo, hi = a, b
+		default:
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q", part)
+			}
+
+			lo, hi = n, n
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("%q is out of [%v, %v]", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			out[v] = true
+		}
+	}
+
+	return out, nil
+}
+
+func (e scheduleEntry) matches(t time.Time) bool {
+	if !e.fields[0][t.Minute()] || !e.fields[1][t.Hour()] || !e.fields[3][int(t.Month())] {
+		return false
+	}
+
+	dom, dow := e.fields[2][t.Day()], e.fields[4][int(t.Weekday())]
+	if !e.domAny && !e.dowAny {
+		return dom || dow
+	}
+
+	return dom && dow
+}
+
+// scheduledScale returns the scale of the last entry matching at or before
+// t, looking back a week, or 1 if none matched.
+func scheduledScale(entries []scheduleEntry, t time.Time) float64 {
+	t = t.Truncate(time.Minute)
+
+	for back := 0; back <= 7*24*60; back++ {
+		at := t.Add(-time.Duration(back) * time.Minute)
+
+		// the later entry wins if several match at the same minute
+		for i := len(entries) - 1; i >= 0; i-- {
+			if entries[i].matches(at) {
+				return entries[i].scale
+			}
+		}
+	}
+
+	return 1
+}
+
+// runSchedule keeps the load scale in line with the schedule until stop is
+// closed.
+func runSchedule(entries []scheduleEntry, scale *loadScale, logger logr.Logger, stop <-chan struct{}, wg *sync.WaitGroup) {
+	update := func() {
+		if v := scheduledScale(entries, time.Now()); v != scale.get() {
+			logger.Info(fmt.Sprintf("schedule changes the load scale from %v to %v", scale.get(), v))
+			scale.set(v)
+		}
+	}
+
+	update()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				update()
+			}
+		}
+	}()
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// errWatchExpired marks a watch which couldn't resume from its last event,
+// the apiserver dropped the events in between.
+var errWatchExpired = errors.New("watch expired")
+
+// slowWatchSetup creates the object and starts the slow consumer of the
+// runner, watching the objects of the kind in the namespace.
+func (r *Runner) slowWatchSetup() error {
+	if err := r.create(); err != nil {
+		return err
+	}
+
+	wc, err := client.NewWithWatch(r.config, client.Options{})
+	if err != nil {
+		return fmt.Errorf("failed to create watch client, error: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(r.context())
+	r.watchCancel = cancel
+
+	go r.slowWatch(ctx, wc)
+
+	return nil
+}
+
+// slowWatch reads an event every 1/r.consumeRate seconds, so the events pile
+// up in the apiserver once the writes outpace it, like a controller stuck in
+// its handlers. The events aren't read off the connection in the meantime,
+// the apiserver sees the watcher as slow.
+//
+// The time from a write to the read of its event is reported as
+// slow-watch/delivery. A watch closed by the apiserver is reported as
+// slow-watch/closed, with how long it lasted, and one which can't resume
+// since the apiserver dropped the events in between, a 410 Gone, as
+// slow-watch/expired. The other errors of the watch are slow-watch/watch.
+func (r *Runner) slowWatch(ctx context.Context, wc client.WithWatch) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(r.template.GroupVersionKind())
+
+	delay := time.Duration(float64(time.Second) / r.consumeRate)
+	rv := ""
+
+	for ctx.Err() == nil {
+		opened := time.Now()
+
+		w, err := wc.Watch(ctx, list,
+			client.InNamespace(r.template.GetNamespace()),
+			&client.ListOptions{Raw: &metav1.ListOptions{ResourceVersion: rv}},
+		)
+		if err != nil {
+			r.metrics.Observe("slow-watch/watch", 0, err)
+			time.Sleep(time.Second)
+
+			continue
+		}
+
+		expired := false
+
+		for ev := range w.ResultChan() {
+			if ev.Type == watch.Error {
+				// only a 410 Gone tells the events in between were dropped,
+				// the watch resumes from its last event after the others
+				err := k8serrors.FromObject(ev.Object)
+				if status, ok := err.(k8serrors.APIStatus); ok && status.Status().Code == http.StatusGone {
+					expired = true
+				} else {
+					r.metrics.Observe("slow-watch/watch", 0, err)
+				}
+
+				break
+			}
+
+			obj, ok := ev.Object.(metav1.Object)
+			if !ok {
+				continue
+			}
+
+			rv = obj.GetResourceVersion()
+
+			if ev.Type == watch.Modified {
+				if writtenAt, err := time.Parse(time.RFC3339Nano, obj.GetAnnotations()[writtenAtAnnotation]); err == nil {
+					r.metrics.Observe("slow-watch/delivery", time.Since(writtenAt), nil)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(delay):
+			}
+		}
+
+		w.Stop()
+
+		switch {
+		case ctx.Err() != nil:
+		case expired:
+			// start over from the current objects
+			rv = ""
+			r.metrics.Observe("slow-watch/expired", time.Since(opened), errWatchExpired)
+		default:
+			r.metrics.Observe("slow-watch/closed", time.Since(opened), nil)
+		}
+	}
+}
+
+// slowWatchTick writes the time of the write on the runner's object, for
+// the delivery of its event.
+func (r *Runner) slowWatchTick(seq int) {
+	patch := []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:%q,%q:"%v"}}}`,
+		writtenAtAnnotation, time.Now().UTC().Format(time.RFC3339Nano), seqAnnotation, seq))
+
+	obj := r.template.DeepCopy()
+	if err := r.metrics.Time("slow-watch/update", func() error {
+		return r.Client.Patch(r.context(), obj, client.RawPatch(types.MergePatchType, patch))
+	}); err != nil {
+		r.logger.Error(err, fmt.Sprintf("failed to update %s", r.getKey()))
+	}
+}
+
+func (r *Runner) slowWatchTeardown() {
+	if r.watchCancel != nil {
+		r.watchCancel()
+	}
+
+	r.delete()
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// snapshotFields are the fields set by the apiserver, dropped from the
+// snapshot so the objects can be created again. The owner references are
+// dropped too, the UIDs of the owners change once restored.
+var snapshotFields = [][]string{
+	{"metadata", "resourceVersion"},
+	{"metadata", "uid"},
+	{"metadata", "creationTimestamp"},
+	{"metadata", "deletionTimestamp"},
+	{"metadata", "deletionGracePeriodSeconds"},
+	{"metadata", "generation"},
+	{"metadata", "managedFields"},
+	{"metadata", "selfLink"},
+	{"metadata", "ownerReferences"},
+	{"status"},
+}
+
+// snapshotCommand writes the objects of the run given after "--", labeled
+// with its -run-id, or of any run without one, to a file, a JSON object per
+// line, the namespaces and the cluster scoped objects first, for restore to
+// create them again.
+func snapshotCommand(args []string, logger logr.Logger) error {
+	fs := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+
+	kubeconfig := fs.String("kubeconfig", os.Getenv("KUBECONFIG"), "absolute path to the kubeconfig file")
+	path := fs.String("f", "snapshot.ndjson", "path of the snapshot file")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	o, err := parseOptions("snapshot", fs.Args())
+	if err != nil {
+		return err
+	}
+
+	// the snapshot only reads the cluster, there's no run to record
+	o.state = nil
+
+	if err := o.loadTemplates(); err != nil {
+		return err
+	}
+
+	req, err := labels.NewRequirement(runLabel, selection.Equals, []string{o.runID})
+	if !o.runIDSet {
+		req, err = labels.NewRequirement(runLabel, selection.Exists, nil)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to build the run selector, error: %w", err)
+	}
+
+	selector := labels.NewSelector().Add(*req)
+
+	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to load rest.Config, error: %w", err)
+	}
+
+	cl, err := client.New(config, client.Options{})
+	if err != nil {
+		return fmt.Errorf("failed to create client, error: %w", err)
+	}
+
+	f, err := os.Create(*path)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot %s, error: %w", *path, err)
+	}
+
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	ctx := context.TODO()
+	count := 0
+
+	kinds := append(append([]schema.GroupVersionKind{namespaceGVK}, clusterScopedKinds...), o.templateKinds()...)
+	for _, gvk := range kinds {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk)
+
+		if err := cl.List(ctx, list, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+
+			return fmt.Errorf("failed to list %s, error: %w", gvk.Kind, err)
+		}
+
+		for _, item := range list.Items {
+			if item.GetDeletionTimestamp() != nil {
+				continue
+			}
+
+			for _, field := range snapshotFields {
+				unstructured.RemoveNestedField(item.Object, field...)
+			}
+
+			dat, err := json.Marshal(item.Object)
+			if err != nil {
+				return fmt.Errorf("failed to marshal %s %s, error: %w", gvk.Kind, item.GetName(), err)
+			}
+
+			if _, err := w.Write(append(dat, '\n')); err != nil {
+				return fmt.Errorf("failed to write snapshot %s, error: %w", *path, err)
+			}
+
+			count++
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write snapshot %s, error: %w", *path, err)
+	}
+
+	logger.Info(fmt.Sprintf("wrote %v objects, selected by %s, to %s", count, selector, *path))
+
+	return nil
+}
+
+// restoreCommand creates the objects of a snapshot again, the CRDs first,
+// once established the namespaces and the other cluster scoped objects, the
+// objects already there are left as they are. The objects keep the run
+// label, the clean up of their run deletes them.
+func restoreCommand(args []string, logger logr.Logger) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+
+	kubeconfig := fs.String("kubeconfig", os.Getenv("KUBECONFIG"), "absolute path to the kubeconfig file")
+	path := fs.String("f", "snapshot.ndjson", "path of the snapshot file")
+	workers := fs.Int("workers", 50, "number of objects created in parallel")
+	newGuard := guardFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	guard, err := newGuard()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(*path)
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot %s, error: %w", *path, err)
+	}
+
+	defer f.Close()
+
+	// the objects of the namespaces wait for them, and the custom resources
+	// for their CRDs to be established
+	crds, first, rest := []*unstructured.Unstructured{}, []*unstructured.Unstructured{}, []*unstructured.Unstructured{}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(scanner.Bytes()); err != nil {
+			return fmt.Errorf("failed to parse line %v of snapshot %s, error: %w", line, *path, err)
+		}
+
+		if obj.GroupVersionKind().GroupKind() == crdGVK.GroupKind() {
+			crds = append(crds, obj)
+			continue
+		}
+
+		if obj.GetNamespace() == "" {
+			first = append(first, obj)
+			continue
+		}
+
+		rest = append(rest, obj)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read snapshot %s, error: %w", *path, err)
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to load rest.Config, error: %w", err)
+	}
+
+	if err := guard.check(*kubeconfig, config.Host); err != nil {
+		return err
+	}
+
+	cl, err := client.New(config, client.Options{})
+	if err != nil {
+		return fmt.Errorf("failed to create client, error: %w", err)
+	}
+
+	ctx := context.TODO()
+	var created, existing, failed int64
+
+	for i, objs := range [][]*unstructured.Unstructured{crds, first, rest} {
+		objs := objs
+
+		if i == 1 {
+			if err := waitEstablished(ctx, cl, crds); err != nil {
+				return err
+			}
+		}
+
+		parallel(*workers, len(objs), func(i int) {
+			obj := objs[i]
+
+			err := cl.Create(ctx, obj)
+			switch {
+			case err == nil:
+				atomic.AddInt64(&created, 1)
+			case k8serrors.IsAlreadyExists(err):
+				atomic.AddInt64(&existing, 1)
+			default:
+				atomic.AddInt64(&failed, 1)
+				logger.Error(err, fmt.Sprintf("failed to create %s %s", obj.GetKind(), client.ObjectKeyFromObject(obj)))
+			}
+		})
+	}
+
+	logger.Info(fmt.Sprintf("restored %s, created %v objects, %v already existed, %v failed", *path, created, existing, failed))
+
+	if failed > 0 {
+		return fmt.Errorf("failed to create %v of the %v objects of snapshot %s", failed, len(crds)+len(first)+len(rest), *path)
+	}
+
+	return nil
+}
+
+// waitEstablished waits for the CRDs to be established, so their custom
+// resources can be created, up to crdEstablishedTimeout. The CRDs which
+// couldn't be created are skipped, their failures are counted already.
+func waitEstablished(ctx context.Context, cl client.Client, crds []*unstructured.Unstructured) error {
+	start := time.Now()
+
+	for _, crd := range crds {
+		for {
+			current := &unstructured.Unstructured{}
+			current.SetGroupVersionKind(crdGVK)
+
+			err := cl.Get(ctx, client.ObjectKeyFromObject(crd), current)
+			if k8serrors.IsNotFound(err) || (err == nil && conditionTrue(current, "Established")) {
+				break
+			}
+
+			if time.Since(start) > crdEstablishedTimeout {
+				return fmt.Errorf("crd %s is not established after %v", crd.GetName(), crdEstablishedTimeout)
+			}
+
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	propagationOp = "propagation/manifestwork"
+
+	spokePollInterval = 100 * time.Millisecond
+)
+
+// spoke is the managed cluster the ManifestWorks of the hub are applied to
+// by the work agent.
+type spoke struct {
+	client  client.Client
+	timeout time.Duration
+}
+
+func newSpoke(kubeconfig string, timeout time.Duration) (*spoke, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the spoke rest.Config, error: %w", err)
+	}
+
+	cl, err := client.New(config, client.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the spoke client, error: %w", err)
+	}
+
+	return &spoke{client: cl, timeout: timeout}, nil
+}
+
+func WithSpoke(s *spoke) Option {
+	return func(r *Runner) {
+		r.spoke = s
+		r.spokeWaits = &sync.WaitGroup{}
+		r.distinctManifests = true
+	}
+}
+
+// manifests are the resources wrapped by a ManifestWork.
+func manifests(work *unstructured.Unstructured) []*unstructured.Unstructured {
+	items, _, _ := unstructured.NestedSlice(work.Object, "spec", "workload", "manifests")
+
+	out := []*unstructured.Unstructured{}
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); ok {
+			out = append(out, &unstructured.Unstructured{Object: m})
+		}
+	}
+
+	return out
+}
+
+// verifySpoke waits for the resources of the ManifestWork created at start
+// to appear on the spoke, and records the hub to spoke latency end to end.
+func (r *Runner) verifySpoke(work *unstructured.Unstructured, start time.Time) {
+	if r.spoke == nil || work.GetKind() != "ManifestWork" {
+		return
+	}
+
+	wanted := manifests(work)
+	if len(wanted) == 0 {
+		return
+	}
+
+	r.spokeWaits.Add(1)
+	go func() {
+		defer r.spokeWaits.Done()
+
+		ctx, cancel := context.WithTimeout(r.context(), r.spoke.timeout)
+		defer cancel()
+
+		key := r.getKey()
+
+		for _, m := range wanted {
+			if err := r.spoke.wait(ctx, m); err != nil {
+				r.metrics.Observe(propagationOp, time.Since(start), err)
+				r.logger.Error(err, fmt.Sprintf("%s didn't propagate to the spoke", key))
+
+				return
+			}
+		}
+
+		r.metrics.Observe(propagationOp, time.Since(start), nil)
+	}()
+}
+
+// wait polls the spoke until m exists.
+func (s *spoke) wait(ctx context.Context, m *unstructured.Unstructured) error {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(m.GroupVersionKind())
+
+	key := types.NamespacedName{Namespace: m.GetNamespace(), Name: m.GetName()}
+
+	ticker := time.NewTicker(spokePollInterval)
+	defer ticker.Stop()
+
+	for {
+		err := s.client.Get(ctx, key, obj)
+		if err == nil {
+			return nil
+		}
+
+		if !k8serrors.IsNotFound(err) {
+			return fmt.Errorf("failed to get %s %s from the spoke, error: %w", m.GetKind(), key, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s %s isn't on the spoke after %v", m.GetKind(), key, s.timeout)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const fieldManagerPrefix = "load-simulator"
+
+// applyManagersTick server-side applies a label owned by one of
+// r.fieldManagers managers, rotating the manager on every tick. Each manager
+// owns its own label, so managedFields keeps growing until every manager has
+// applied once, which is the pathology we see on busy ManifestWorks.
+//
+// Latency is recorded by the number of managedFields entries on the object, to
+// show how apply degrades as managedFields grows.
+func (r *Runner) applyManagersTick(seq int) {
+	n := r.fieldManagers
+	if n <= 0 {
+		n = 1
+	}
+
+	manager := fmt.Sprintf("%s-%v", fieldManagerPrefix, seq%n)
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(r.template.GroupVersionKind())
+	obj.SetName(r.template.GetName())
+	obj.SetNamespace(r.template.GetNamespace())
+	obj.SetLabels(map[string]string{
+		fmt.Sprintf("%s/%s", fieldManagerPrefix, manager): fmt.Sprintf("%v", seq),
+	})
+
+	managed := r.managedFields
+
+	err := r.metrics.Time(fmt.Sprintf("apply/managed-fields-%03d", managed), func() error {
+		return r.Client.Patch(r.context(), obj, client.Apply, client.FieldOwner(manager), client.ForceOwnership)
+	})
+	if err != nil {
+		r.logger.Error(err, fmt.Sprintf("failed to apply %s as %s", r.getKey(), manager))
+		return
+	}
+
+	r.managedFields = len(obj.GetManagedFields())
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// seqAnnotation is the sequence of the last write of an object, it goes up by
+// one with every write, along with writtenAtAnnotation.
+const seqAnnotation = "load-simulator/seq"
+
+// stamps are the sequences of the objects of a runner.
+type stamps struct {
+	mu   sync.Mutex
+	seqs map[string]int
+}
+
+// stamp returns the annotations of the next write of the object of key, and
+// its sequence, nil unless the writes are stamped. current, the object as
+// read before the write if any, keeps the sequence going over a restart of
+// the runner.
+func (r *Runner) stamp(key string, current metav1.Object) (map[string]string, int) {
+	if r.stamps == nil {
+		return nil, 0
+	}
+
+	r.stamps.mu.Lock()
+	defer r.stamps.mu.Unlock()
+
+	last := r.stamps.seqs[key]
+	if current != nil {
+		if seq, _, ok := parseStamp(current); ok && seq > last {
+			last = seq
+		}
+	}
+
+	seq := last + 1
+
+	return map[string]string{
+		seqAnnotation:       strconv.Itoa(seq),
+		writtenAtAnnotation: time.Now().UTC().Format(time.RFC3339Nano),
+	}, seq
+}
+
+// stamped records the write of seq went through, a failed write doesn't use
+// up its sequence.
+func (r *Runner) stamped(key string, seq int) {
+	if r.stamps == nil {
+		return
+	}
+
+	r.stamps.mu.Lock()
+	defer r.stamps.mu.Unlock()
+
+	if seq > r.stamps.seqs[key] {
+		r.stamps.seqs[key] = seq
+	}
+}
+
+func parseStamp(obj metav1.Object) (int, time.Time, bool) {
+	annotations := obj.GetAnnotations()
+
+	seq, err := strconv.Atoi(annotations[seqAnnotation])
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+
+	at, err := time.Parse(time.RFC3339Nano, annotations[writtenAtAnnotation])
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+
+	return seq, at, true
+}
+
+// SequenceReport is the consistency of the stamped writes an observer saw.
+type SequenceReport struct {
+	Objects int `json:"objects"`
+	Events  int `json:"events"`
+	// Lost are the writes the observer never saw, a sequence skipped
+	Lost int `json:"lost"`
+	// Reordered are the events older than one seen before
+	Reordered int `json:"reordered"`
+	// Repeated are the events of a write already seen, a duplicate delivery,
+	// or another writer, e.g. a controller updating the status
+	Repeated int `json:"repeated"`
+}
+
+// sequenceCheck follows the sequences of the objects an observer sees.
+type sequenceCheck struct {
+	mu     sync.Mutex
+	last   map[string]int
+	report SequenceReport
+}
+
+func newSequenceCheck() *sequenceCheck {
+	return &sequenceCheck{last: map[string]int{}}
+}
+
+// sequenceVerdict is what an event tells about the writes of its object.
+type sequenceVerdict int
+
+const (
+	// seqFirst is the first event of the object
+	seqFirst sequenceVerdict = iota
+	// seqNext is the write following the last one seen
+	seqNext
+	// seqLost is a newer write, with the ones in between missed
+	seqLost
+	seqRepeated
+	seqReordered
+)
+
+// fresh tells whether the event carries a write following the ones seen
+// before.
+func (v sequenceVerdict) fresh() bool {
+	return v == seqNext || v == seqLost
+}
+
+// observe records an event of the object of key carrying seq. The writes
+// before the first event are none of the observer's business, it may have
+// started late, and the event may be the current state of the object rather
+// than a write.
+func (c *sequenceCheck) observe(key string, seq int) sequenceVerdict {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.report.Events++
+
+	last, ok := c.last[key]
+	if !ok {
+		c.report.Objects++
+		c.last[key] = seq
+
+		return seqFirst
+	}
+
+	switch {
+	case seq == last:
+		c.report.Repeated++
+		return seqRepeated
+	case seq < last:
+		c.report.Reordered++
+		return seqReordered
+	}
+
+	c.last[key] = seq
+
+	if seq > last+1 {
+		c.report.Lost += seq - last - 1
+		return seqLost
+	}
+
+	return seqNext
+}
+
+// resync moves the object of key to seq without an event, e.g. after a
+// relist, the writes in between aren't lost then.
+func (c *sequenceCheck) resync(key string, seq int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.last[key]; !ok {
+		c.report.Objects++
+	}
+
+	if seq > c.last[key] {
+		c.last[key] = seq
+	}
+}
+
+func (c *sequenceCheck) Report() SequenceReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.report
+}
+
+// analyzeCommand watches the objects of a run, given the flags of the run and
+// its -run-id, for -duration seconds. The delay from each stamped write to
+// its event is reported as analyze/delay, along with the writes lost or
+// reordered on the way.
+func analyzeCommand(args []string, logger logr.Logger) error {
+	o, err := parseOptions("analyze", args)
+	if err != nil {
+		return err
+	}
+
+	// the analysis doesn't run, it has nothing to record
+	o.state = nil
+
+	if !o.runIDSet && o.resume == "" {
+		return fmt.Errorf("analyze needs the -run-id of the run to observe")
+	}
+
+	if err := o.loadTemplates(); err != nil {
+		return err
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", o.kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to load rest.Config, error: %w", err)
+	}
+
+	wc, err := client.NewWithWatch(config, client.Options{})
+	if err != nil {
+		return fmt.Errorf("failed to create watch client, error: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(o.duration)*time.Second)
+	defer cancel()
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-c:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	metrics := NewMetrics()
+	check := newSequenceCheck()
+
+	kinds := map[schema.GroupVersionKind]bool{}
+	for _, t := range o.templates {
+		kinds[t.obj.GroupVersionKind()] = true
+	}
+
+	wg := &sync.WaitGroup{}
+	for gvk := range kinds {
+		wg.Add(1)
+		go func(gvk schema.GroupVersionKind) {
+			defer wg.Done()
+			analyzeWatch(ctx, wc, gvk, o.runID, metrics, check)
+		}(gvk)
+	}
+
+	logger.Info(fmt.Sprintf("observing the objects of %s for %vs", o.runID, o.duration))
+
+	wg.Wait()
+
+	metrics.Report(logger)
+
+	r := check.Report()
+	logger.Info(fmt.Sprintf("%v objects, %v events: %v writes lost, %v reordered, %v repeated", r.Objects, r.Events, r.Lost, r.Reordered, r.Repeated))
+
+	return nil
+}
+
+// analyzeWatch watches the objects of kind gvk labeled with the run until ctx
+// is done, resuming from the last event when the apiserver closes the watch.
+func analyzeWatch(ctx context.Context, wc client.WithWatch, gvk schema.GroupVersionKind, runID string, metrics *Metrics, check *sequenceCheck) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(gvk)
+
+	rv := ""
+
+	for ctx.Err() == nil {
+		w, err := wc.Watch(ctx, list,
+			client.MatchingLabels{runLabel: runID},
+			&client.ListOptions{Raw: &metav1.ListOptions{ResourceVersion: rv}},
+		)
+		if err != nil {
+			metrics.Observe("analyze/watch", 0, err)
+			time.Sleep(time.Second)
+
+			continue
+		}
+
+		for ev := range w.ResultChan() {
+			if ev.Type == watch.Error {
+				rv = ""
+				break
+			}
+
+			obj, ok := ev.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+
+			rv = obj.GetResourceVersion()
+
+			if ev.Type != watch.Added && ev.Type != watch.Modified {
+				continue
+			}
+
+			seq, at, ok := parseStamp(obj)
+			if !ok {
+				continue
+			}
+
+			if check.observe(obj.GetNamespace()+"/"+obj.GetName(), seq).fresh() {
+				metrics.Observe("analyze/delay", time.Since(at), nil)
+			}
+		}
+
+		w.Stop()
+	}
+}
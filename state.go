@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// stateFlushInterval is the interval between the writes of the state file, a
+// crash loses at most the progress of one interval.
+const stateFlushInterval = 5 * time.Second
+
+// runState is persisted to <state dir>/<run ID>.json during the run, so a
+// crashed or interrupted run can be resumed, or cleaned precisely, from the
+// objects it recorded instead of the in-memory templates.
+type runState struct {
+	RunID string `json:"runID"`
+	// Args are the flags of the run, a resumed run parses them again
+	Args []string `json:"args"`
+	// Elapsed is the time the load of the current layout ran, over all the
+	// resumptions
+	Elapsed  time.Duration          `json:"elapsed"`
+	Finished bool                   `json:"finished"`
+	Objects  map[string]stateObject `json:"objects"`
+
+	mu   sync.Mutex
+	path string
+	// resumed is the time the load ran before the resumption
+	resumed time.Duration
+}
+
+type stateObject struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+func statePath(dir, runID string) string {
+	return filepath.Join(dir, runID+".json")
+}
+
+func newRunState(dir, runID string, args []string) (*runState, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create state dir, error: %w", err)
+	}
+
+	return &runState{RunID: runID, Args: args, Objects: map[string]stateObject{}, path: statePath(dir, runID)}, nil
+}
+
+func loadRunState(dir, runID string) (*runState, error) {
+	path := statePath(dir, runID)
+
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the state of %s, error: %w", runID, err)
+	}
+
+	s := &runState{path: path}
+	if err := json.Unmarshal(dat, s); err != nil {
+		return nil, fmt.Errorf("failed to parse %s, error: %w", path, err)
+	}
+
+	if s.Objects == nil {
+		s.Objects = map[string]stateObject{}
+	}
+
+	s.resumed = s.Elapsed
+
+	return s, nil
+}
+
+// maskArgs masks the values of the secret flags of args, see secretFlags.
+func maskArgs(args []string) []string {
+	return walkSecretArgs(args, func(name, value string) (string, bool) {
+		return secretFlags[name](value), true
+	})
+}
+
+// unmaskedArgs drops the secret flags maskArgs redacted from args.
+func unmaskedArgs(args []string) []string {
+	return walkSecretArgs(args, func(name, value string) (string, bool) {
+		return value, !strings.Contains(value, "<redacted>")
+	})
+}
+
+// walkSecretArgs replaces the values of the secret flags of args with f,
+// -name=value or -name value, or drops them when f doesn't keep them.
+func walkSecretArgs(args []string, f func(name, value string) (string, bool)) []string {
+	fs := newFlagSet("state", &options{})
+
+	out := []string{}
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" || !strings.HasPrefix(args[i], "-") {
+			return append(out, args[i:]...)
+		}
+
+		name := strings.TrimLeft(args[i], "-")
+		value, inline := "", false
+		if idx := strings.Index(name, "="); idx != -1 {
+			name, value, inline = name[:idx], name[idx+1:], true
+		}
+
+		// the value of a flag is the next arg, unless it's inline or a bool
+		next := !inline && i+1 < len(args)
+		if fl := fs.Lookup(name); fl == nil || isBoolFlag(fl) {
+			next = false
+		}
+
+		if _, ok := secretFlags[name]; !ok {
+			out = append(out, args[i])
+			if next {
+				i++
+				out = append(out, args[i])
+			}
+
+			continue
+		}
+
+		if next {
+			i++
+			value = args[i]
+		}
+
+		if v, keep := f(name, value); keep {
+			out = append(out, "-"+name+"="+v)
+		}
+	}
+
+	return out
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func stateKey(obj *unstructured.Unstructured) string {
+	return fmt.Sprintf("%s/%s/%s/%s", obj.GetAPIVersion(), obj.GetKind(), obj.GetNamespace(), obj.GetName())
+}
+
+// add records a created object.
+func (s *runState) add(obj *unstructured.Unstructured) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Objects[stateKey(obj)] = stateObject{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+	}
+}
+
+// remove forgets a deleted object.
+func (s *runState) remove(obj *unstructured.Unstructured) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.Objects, stateKey(obj))
+}
+
+func (s *runState) flush() error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	dat, err := json.MarshalIndent(s, "", "  ")
+	s.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("failed to marshal state, error: %w", err)
+	}
+
+	// write and rename, so a crash never leaves a truncated state
+	tmp := s.path + ".tmp"
+	// the objects and the flags of the run aren't anyone else's business
+	if err := ioutil.WriteFile(tmp, dat, 0600); err != nil {
+		return fmt.Errorf("failed to write state, error: %w", err)
+	}
+
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write state, error: %w", err)
+	}
+
+	return nil
+}
+
+// track flushes the state every stateFlushInterval until stop is closed,
+// counting the time since start as elapsed on top of the resumed run.
+func (s *runState) track(start time.Time, logger logr.Logger, stop <-chan struct{}, wg *sync.WaitGroup) {
+	// the layouts each run for the whole duration
+	s.mu.Lock()
+	base := s.resumed
+	s.mu.Unlock()
+
+	update := func() {
+		s.mu.Lock()
+		s.Elapsed = base + time.Since(start)
+		s.mu.Unlock()
+
+		if err := s.flush(); err != nil {
+			logger.Error(err, "failed to save the run state")
+		}
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(stateFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				update()
+				return
+			case <-ticker.C:
+				update()
+			}
+		}
+	}()
+}
+
+// cleanRecorded deletes every recorded object from each of the clusters, and
+// the namespaces holding them unless they're kept, e.g. the ones left by a
+// crashed run under names the runners don't know anymore. The state doesn't
+// tell the hub of an object, it's deleted from all of them.
+func (s *runState) cleanRecorded(ctx context.Context, clusters []cluster, keepNamespaces bool, workers int, logger logr.Logger) error {
+	clients := []client.Client{}
+	for _, c := range clusters {
+		cl, err := client.New(c.config, client.Options{})
+		if err != nil {
+			return fmt.Errorf("failed to create client, error: %w", err)
+		}
+
+		clients = append(clients, cl)
+	}
+
+	s.mu.Lock()
+	objects := []stateObject{}
+	for _, o := range s.Objects {
+		objects = append(objects, o)
+	}
+	s.mu.Unlock()
+
+	parallel(workers, len(objects), func(i int) {
+		o := objects[i]
+
+		obj := &metav1.PartialObjectMetadata{}
+		obj.APIVersion, obj.Kind = o.APIVersion, o.Kind
+		obj.Namespace, obj.Name = o.Namespace, o.Name
+
+		for i, cl := range clients {
+			if err := cl.Delete(ctx, obj.DeepCopy()); err != nil && !k8serrors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+				clusters[i].logger(logger).Error(err, fmt.Sprintf("failed to delete recorded %s %s/%s", o.Kind, o.Namespace, o.Name))
+				return
+			}
+		}
+
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion(o.APIVersion)
+		u.SetKind(o.Kind)
+		u.SetNamespace(o.Namespace)
+		u.SetName(o.Name)
+		s.remove(u)
+	})
+
+	if keepNamespaces {
+		return nil
+	}
+
+	namespaces := map[string]bool{}
+	for _, o := range objects {
+		if o.Namespace != "" {
+			namespaces[o.Namespace] = true
+		}
+	}
+
+	for ns := range namespaces {
+		for i, cl := range clients {
+			if err := cl.Delete(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}}); err != nil && !k8serrors.IsNotFound(err) {
+				clusters[i].logger(logger).Error(err, fmt.Sprintf("failed to delete recorded namespace %s", ns))
+			}
+		}
+	}
+
+	logger.Info(fmt.Sprintf("deleted the %v objects recorded by %s", len(objects), s.RunID))
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/go-logr/logr"
+	restclient "k8s.io/client-go/rest"
+)
+
+// storage metrics of the apiserver, the etcd_* ones were renamed in 1.22/1.23
+var (
+	dbSizeMetrics      = []string{"apiserver_storage_db_total_size_in_bytes", "etcd_db_total_size_in_bytes"}
+	objectCountMetrics = []string{"apiserver_storage_objects", "etcd_object_counts"}
+)
+
+type storageSnapshot struct {
+	dbSize  float64
+	objects map[string]float64
+}
+
+// StorageGrowth is how much the storage grew during a run.
+type StorageGrowth struct {
+	DBSizeBefore int64 `json:"dbSizeBefore"`
+	DBSizeAfter  int64 `json:"dbSizeAfter"`
+	// object count growth of the resources which changed
+	Objects map[string]int64 `json:"objects,omitempty"`
+}
+
+func scrapeStorage(ctx context.Context, config *restclient.Config) (*storageSnapshot, error) {
+	samples, err := scrapeAPIServer(ctx, config, append(append([]string{}, dbSizeMetrics...), objectCountMetrics...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &storageSnapshot{objects: map[string]float64{}}
+
+	for _, s := range samples {
+		for _, n := range dbSizeMetrics {
+			// every etcd member reports its own size, keep the largest one
+			if s.name == n && s.value > snap.dbSize {
+				snap.dbSize = s.value
+			}
+		}
+
+		for _, n := range objectCountMetrics {
+			if s.name == n && s.labels["resource"] != "" {
+				snap.objects[s.labels["resource"]] = s.value
+			}
+		}
+	}
+
+	if snap.dbSize == 0 && len(snap.objects) == 0 {
+		return nil, fmt.Errorf("no storage metrics exposed by the apiserver")
+	}
+
+	return snap, nil
+}
+
+func storageGrowth(before, after *storageSnapshot) *StorageGrowth {
+	if before == nil || after == nil {
+		return nil
+	}
+
+	g := &StorageGrowth{
+		DBSizeBefore: int64(before.dbSize),
+		DBSizeAfter:  int64(after.dbSize),
+		Objects:      map[string]int64{},
+	}
+
+	for res, n := range after.objects {
+		if d := int64(n - before.objects[res]); d != 0 {
+			g.Objects[res] = d
+		}
+	}
+
+	for res, n := range before.objects {
+		if _, ok := after.objects[res]; !ok && n != 0 {
+			g.Objects[res] = -int64(n)
+		}
+	}
+
+	return g
+}
+
+func (g *StorageGrowth) log(logger logr.Logger) {
+	if g == nil {
+		return
+	}
+
+	logger.Info(fmt.Sprintf("storage: db size %v -> %v bytes (%+d)", g.DBSizeBefore, g.DBSizeAfter, g.DBSizeAfter-g.DBSizeBefore))
+
+	resources := []string{}
+	for res := range g.Objects {
+		resources = append(resources, res)
+	}
+
+	sort.Strings(resources)
+
+	for _, res := range resources {
+		logger.Info(fmt.Sprintf("storage: %s objects %+d", res, g.Objects[res]))
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// strategyPatch is the default of the update mode, get then patch with
+	// -patch-type
+	strategyPatch      = "patch"
+	strategyUpdate     = "update"
+	strategyMergePatch = "merge-patch"
+	strategyJSONTest   = "json-patch-test"
+
+	// a write losing a conflict is retried up to this many times
+	strategyRetries = 5
+)
+
+func validateUpdateStrategy(s string) error {
+	switch s {
+	case strategyPatch, strategyUpdate, strategyMergePatch, strategyJSONTest:
+		return nil
+	}
+
+	return fmt.Errorf("unknown update strategy %q, expecting %s|%s|%s|%s", s, strategyPatch, strategyUpdate, strategyMergePatch, strategyJSONTest)
+}
+
+// strategyTick sets a label on the object of key the way the client pattern
+// of r.updateStrategy does:
+//
+//   - update: get, modify and update, retrying on conflicts
+//   - merge-patch: a merge patch without any precondition, it can't conflict
+//   - json-patch-test: get, then a JSON patch testing the resourceVersion
+//     before setting the label, retrying when the test fails
+//
+// Each write is recorded as "<strategy>/attempt", the failed attempts being
+// the conflicts, and the whole update, retries included, as "<strategy>".
+func (r *Runner) strategyTick(ctx context.Context, key types.NamespacedName, suffix string, seq int) {
+	value := fmt.Sprintf("world-%v", seq)
+
+	write := r.strategyWrite(ctx, key, value)
+
+	if err := r.metrics.Time(r.updateStrategy+suffix, func() error {
+		for attempt := 0; ; attempt++ {
+			var conflict bool
+			err := r.metrics.Time(r.updateStrategy+"/attempt"+suffix, func() error {
+				var err error
+				conflict, err = write()
+				return err
+			})
+
+			if err == nil || !conflict || attempt == strategyRetries {
+				return err
+			}
+		}
+	}); err != nil {
+		r.logger.Error(err, fmt.Sprintf("failed to %s %s", r.updateStrategy, key))
+	}
+}
+
+// strategyWrite returns a write of the strategy, which tells whether it
+// failed on a conflict.
+func (r *Runner) strategyWrite(ctx context.Context, key types.NamespacedName, value string) func() (bool, error) {
+	if r.updateStrategy == strategyMergePatch {
+		return func() (bool, error) {
+			annotations, seq := r.stamp(key.String(), nil)
+			if err := r.mergeLabel(ctx, key, value, annotations); err != nil {
+				return false, err
+			}
+
+			r.stamped(key.String(), seq)
+
+			return false, nil
+		}
+	}
+
+	return func() (bool, error) {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(r.template.GroupVersionKind())
+
+		if err := r.Client.Get(ctx, key, obj); err != nil {
+			return false, err
+		}
+
+		annotations, seq := r.stamp(key.String(), obj)
+
+		if r.updateStrategy == strategyUpdate {
+			labels := obj.GetLabels()
+			if labels == nil {
+				labels = map[string]string{}
+			}
+
+			labels["hello"] = value
+			obj.SetLabels(labels)
+			setAnnotations(obj, annotations)
+
+			err := r.Client.Update(ctx, obj)
+			if err == nil {
+				r.stamped(key.String(), seq)
+			}
+
+			return k8serrors.IsConflict(err), err
+		}
+
+		patch, err := testedLabelPatch(obj, "hello", value, annotations)
+		if err != nil {
+			return false, err
+		}
+
+		// the apiserver rejects a patch whose test failed as invalid
+		err = r.Client.Patch(ctx, obj, patch)
+		if err == nil {
+			r.stamped(key.String(), seq)
+		}
+
+		return k8serrors.IsConflict(err) || k8serrors.IsInvalid(err), err
+	}
+}
+
+func (r *Runner) mergeLabel(ctx context.Context, key types.NamespacedName, value string, annotations map[string]string) error {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(r.template.GroupVersionKind())
+	obj.SetNamespace(key.Namespace)
+	obj.SetName(key.Name)
+
+	meta := map[string]interface{}{"labels": map[string]string{"hello": value}}
+	if len(annotations) != 0 {
+		meta["annotations"] = annotations
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{"metadata": meta})
+	if err != nil {
+		return err
+	}
+
+	return r.Client.Patch(ctx, obj, client.RawPatch(types.MergePatchType, patch))
+}
+
+// testedLabelPatch is a JSON patch setting label key=value, and annotations,
+// only if obj is still at the resourceVersion it was read at.
+func testedLabelPatch(obj *unstructured.Unstructured, key, value string, annotations map[string]string) (client.Patch, error) {
+	ops := []map[string]interface{}{
+		{"op": "test", "path": "/metadata/resourceVersion", "value": obj.GetResourceVersion()},
+	}
+
+	if obj.GetLabels() == nil {
+		ops = append(ops, map[string]interface{}{
+			"op": "add", "path": "/metadata/labels", "value": map[string]string{key: value},
+		})
+	} else {
+		ops = append(ops, map[string]interface{}{
+			"op": "add", "path": "/metadata/labels/" + escapeJSONPointer(key), "value": value,
+		})
+	}
+
+	ops = append(ops, annotationOps(obj, annotations)...)
+
+	dat, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.RawPatch(types.JSONPatchType, dat), nil
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	streamLogs        = "logs"
+	streamExec        = "exec"
+	streamPortForward = "portforward"
+
+	streamAppName = "load-simulator-nginx"
+
+	// how long the setup waits for the nginx pod to run
+	streamPodTimeout = 2 * time.Minute
+)
+
+// streamKinds is used by the flag description.
+var streamKinds = strings.Join([]string{streamLogs, streamExec, streamPortForward}, "|")
+
+func validateStreamKind(s string) error {
+	switch s {
+	case streamLogs, streamExec, streamPortForward:
+		return nil
+	}
+
+	return fmt.Errorf("unknown stream kind %q, expecting %s|%s|%s", s, streamLogs, streamExec, streamPortForward)
+}
+
+// stream is a long running streaming connection through the apiserver.
+type stream struct {
+	done  chan struct{}
+	close func()
+
+	// stdin of exec sessions
+	stdin io.Writer
+	// local port of port forwards
+	port uint16
+}
+
+func (s *stream) closed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// streamSetup creates the namespace and a nginx Deployment, then waits until
+// its pod runs, so there's something to stream from.
+func (r *Runner) streamSetup() error {
+	ctx := r.context()
+	ns := r.template.GetNamespace()
+
+	if err := r.createNamespace(ctx, ns); err != nil {
+		return err
+	}
+
+	replicas := int32(1)
+	labels := map[string]string{"app": streamAppName}
+
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: streamAppName, Namespace: ns},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "nginx",
+							Image: "nginx:1.21",
+							Ports: []corev1.ContainerPort{{ContainerPort: 80}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if err := r.Client.Create(ctx, deploy); err != nil {
+		if !k8serrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create deployment in %s, error: %w", ns, err)
+		}
+	}
+
+	// the streaming requests are upgraded connections, which don't work with
+	// the custom transport
+	config, err := clientcmd.BuildConfigFromFlags("", r.kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to load rest.Config, error: %w", err)
+	}
+
+	r.streamConfig = config
+
+	cs, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create clientset, error: %w", err)
+	}
+
+	r.clientset = cs
+
+	start := time.Now()
+	for time.Since(start) < streamPodTimeout {
+		pods := &corev1.PodList{}
+		if err := r.Client.List(ctx, pods, client.InNamespace(ns), client.MatchingLabels(labels)); err != nil {
+			return fmt.Errorf("failed to list pods in %s, error: %w", ns, err)
+		}
+
+		for _, p := range pods.Items {
+			if p.Status.Phase == corev1.PodRunning {
+				r.streamPod = p.Name
+				return nil
+			}
+		}
+
+		time.Sleep(time.Second)
+	}
+
+	return fmt.Errorf("no running %s pod in %s after %v", streamAppName, ns, streamPodTimeout)
+}
+
+// streamTick keeps r.streamCount streams open, reopening the ones which got
+// closed, and pushes a bit of traffic through exec and port forward streams.
+func (r *Runner) streamTick(seq int) {
+	for len(r.streams) < r.streamCount {
+		r.streams = append(r.streams, nil)
+	}
+
+	for i, s := range r.streams {
+		if s != nil && !s.closed() {
+			r.streamTraffic(s, seq)
+			continue
+		}
+
+		if s != nil {
+			r.metrics.Observe("stream/"+r.streamKind+"-closed", 0, nil)
+		}
+
+		var err error
+		var opened *stream
+
+		r.metrics.Time("stream/"+r.streamKind+"-open", func() error {
+			opened, err = r.openStream()
+			return err
+		})
+
+		if err != nil {
+			r.logger.Error(err, fmt.Sprintf("failed to open %s stream to %s/%s", r.streamKind, r.template.GetNamespace(), r.streamPod))
+			continue
+		}
+
+		r.streams[i] = opened
+	}
+}
+
+func (r *Runner) streamTraffic(s *stream, seq int) {
+	switch r.streamKind {
+	case streamExec:
+		if _, err := fmt.Fprintf(s.stdin, "%v\n", seq); err != nil {
+			s.close()
+		}
+
+	case streamPortForward:
+		r.metrics.Time("stream/portforward-get", func() error {
+			resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%v/", s.port))
+			if err != nil {
+				return err
+			}
+
+			defer resp.Body.Close()
+			_, err = io.Copy(ioutil.Discard, resp.Body)
+
+			return err
+		})
+	}
+}
+
+func (r *Runner) openStream() (*stream, error) {
+	ns := r.template.GetNamespace()
+	done := make(chan struct{})
+
+	switch r.streamKind {
+	case streamLogs:
+		ctx, cancel := context.WithCancel(context.Background())
+
+		rc, err := r.clientset.CoreV1().Pods(ns).GetLogs(r.streamPod, &corev1.PodLogOptions{Follow: true}).Stream(ctx)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		go func() {
+			defer close(done)
+			defer rc.Close()
+
+			_, _ = io.Copy(ioutil.Discard, rc)
+		}()
+
+		return &stream{done: done, close: cancel}, nil
+
+	case streamExec:
+		req := r.clientset.CoreV1().RESTClient().Post().
+			Resource("pods").Namespace(ns).Name(r.streamPod).SubResource("exec").
+			VersionedParams(&corev1.PodExecOptions{
+				Container: "nginx",
+				Command:   []string{"cat"},
+				Stdin:     true,
+				Stdout:    true,
+			}, scheme.ParameterCodec)
+
+		exec, err := remotecommand.NewSPDYExecutor(r.streamConfig, http.MethodPost, req.URL())
+		if err != nil {
+			return nil, err
+		}
+
+		// cat echos whatever we write to stdin, closing stdin ends the session
+		stdin, w := io.Pipe()
+
+		go func() {
+			defer close(done)
+
+			_ = exec.Stream(remotecommand.StreamOptions{Stdin: stdin, Stdout: ioutil.Discard})
+		}()
+
+		return &stream{done: done, close: func() { w.Close() }, stdin: w}, nil
+
+	case streamPortForward:
+		rt, upgrader, err := spdy.RoundTripperFor(r.streamConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		url := r.clientset.CoreV1().RESTClient().Post().
+			Resource("pods").Namespace(ns).Name(r.streamPod).SubResource("portforward").URL()
+
+		dialer := spdy.NewDialer(upgrader, &http.Client{Transport: rt}, http.MethodPost, url)
+
+		stop, ready := make(chan struct{}), make(chan struct{})
+
+		pf, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{"0:80"}, stop, ready, ioutil.Discard, ioutil.Discard)
+		if err != nil {
+			return nil, err
+		}
+
+		errCh := make(chan error, 1)
+		go func() {
+			defer close(done)
+
+			errCh <- pf.ForwardPorts()
+		}()
+
+		select {
+		case <-ready:
+		case err := <-errCh:
+			return nil, err
+		}
+
+		ports, err := pf.GetPorts()
+		if err != nil || len(ports) == 0 {
+			close(stop)
+			return nil, fmt.Errorf("failed to get the forwarded port, error: %v", err)
+		}
+
+		return &stream{done: done, close: func() { close(stop) }, port: ports[0].Local}, nil
+	}
+
+	return nil, fmt.Errorf("unknown stream kind %q", r.streamKind)
+}
+
+// streamTeardown closes all the streams, then deletes the namespace along
+// with the Deployment.
+func (r *Runner) streamTeardown() {
+	for _, s := range r.streams {
+		if s != nil && !s.closed() {
+			s.close()
+		}
+	}
+
+	r.logger.Info(fmt.Sprintf("closed %v %s streams of %s", len(r.streams), r.streamKind, r.name))
+
+	r.delete()
+}
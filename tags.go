@@ -0,0 +1,33 @@
+package main
+
+// tagsAnnotation records the -tags of the run, e.g. "etcd=3.5.4,variant=b", on
+// the objects and the namespaces it creates.
+const tagsAnnotation = "load-simulator/tags"
+
+// annotations adds the tags annotation to a.
+func (r *Runner) annotations(a map[string]string) map[string]string {
+	if r.tags == "" {
+		return a
+	}
+
+	if a == nil {
+		a = map[string]string{}
+	}
+
+	a[tagsAnnotation] = r.tags
+
+	return a
+}
+
+// tagged sets the tags of the run on each summary.
+func tagged(summary []Summary, tags map[string]string) []Summary {
+	if len(tags) == 0 {
+		return summary
+	}
+
+	for i := range summary {
+		summary[i].Tags = tags
+	}
+
+	return summary
+}
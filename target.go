@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	restclient "k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	targetGet    = "get"
+	targetUpdate = "update"
+	targetDelete = "delete"
+)
+
+func parseTargetVerbs(s string) ([]string, error) {
+	verbs := []string{}
+	for _, v := range strings.Split(s, ",") {
+		switch v = strings.TrimSpace(v); v {
+		case targetGet, targetUpdate, targetDelete:
+			verbs = append(verbs, v)
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown target verb %q, expecting %s|%s|%s", v, targetGet, targetUpdate, targetDelete)
+		}
+	}
+
+	if len(verbs) == 0 {
+		return nil, fmt.Errorf("target-verbs has no verb")
+	}
+
+	return verbs, nil
+}
+
+// targets are the existing objects of the template kinds matching the
+// selector, which the target mode drives instead of creating its own, e.g.
+// the objects of real controllers.
+type targets struct {
+	selector labels.Selector
+	kinds    []schema.GroupVersionKind
+
+	mu   sync.RWMutex
+	keys map[schema.GroupVersionKind][]types.NamespacedName
+}
+
+func newTargets(selector labels.Selector, kinds []schema.GroupVersionKind) *targets {
+	return &targets{selector: selector, kinds: kinds, keys: map[schema.GroupVersionKind][]types.NamespacedName{}}
+}
+
+// discover lists the objects matching the selector in all the namespaces, a
+// kind without any fails the run.
+func (t *targets) discover(ctx context.Context, cl client.Client) error {
+	keys := map[schema.GroupVersionKind][]types.NamespacedName{}
+
+	for _, gvk := range t.kinds {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk)
+
+		if err := cl.List(ctx, list, client.MatchingLabelsSelector{Selector: t.selector}); err != nil {
+			return fmt.Errorf("failed to list the %s targets, error: %w", gvk.Kind, err)
+		}
+
+		if len(list.Items) == 0 {
+			return fmt.Errorf("no %s matches target-selector %q", gvk.Kind, t.selector)
+		}
+
+		for _, item := range list.Items {
+			keys[gvk] = append(keys[gvk], types.NamespacedName{Namespace: item.GetNamespace(), Name: item.GetName()})
+		}
+	}
+
+	t.mu.Lock()
+	t.keys = keys
+	t.mu.Unlock()
+
+	return nil
+}
+
+// run discovers the objects again every interval until stop, so the objects
+// created since then are targeted as well and the deleted ones aren't.
+func (t *targets) run(cl client.Client, interval time.Duration, logger logr.Logger, stop <-chan struct{}, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			if err := t.discover(context.TODO(), cl); err != nil {
+				logger.Error(err, "failed to refresh the targets, keeping the previous ones")
+				continue
+			}
+
+			logger.Info(fmt.Sprintf("refreshed the targets, %v objects", t.count()))
+		}
+	}()
+}
+
+func (t *targets) count() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	n := 0
+	for _, keys := range t.keys {
+		n += len(keys)
+	}
+
+	return n
+}
+
+// pick returns the i-th object of the kind, wrapping around.
+func (t *targets) pick(gvk schema.GroupVersionKind, i int) (types.NamespacedName, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	keys := t.keys[gvk]
+	if len(keys) == 0 {
+		return types.NamespacedName{}, false
+	}
+
+	return keys[i%len(keys)], true
+}
+
+// remove drops a deleted object until the next discovery.
+func (t *targets) remove(gvk schema.GroupVersionKind, key types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	keys := t.keys[gvk]
+	for i, k := range keys {
+		if k == key {
+			t.keys[gvk] = append(append([]types.NamespacedName{}, keys[:i]...), keys[i+1:]...)
+			return
+		}
+	}
+}
+
+// startTargets discovers the targets and refreshes them every
+// o.targetRefresh seconds until stop.
+func (o *options) startTargets(config *restclient.Config, logger logr.Logger, stop <-chan struct{}, wg *sync.WaitGroup) (*targets, error) {
+	cl, err := client.New(config, client.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client, error: %w", err)
+	}
+
+	t := newTargets(o.targetLabels, o.templateKinds())
+	if err := t.discover(context.TODO(), cl); err != nil {
+		return nil, err
+	}
+
+	logger.Info(fmt.Sprintf("targeting %v objects matching %q", t.count(), o.targetSelector))
+
+	if o.targetRefresh > 0 {
+		t.run(cl, time.Duration(o.targetRefresh)*time.Second, logger, stop, wg)
+	}
+
+	return t, nil
+}
+
+// targetTick sends the next of r.targetVerbs to a random target of the kind
+// of the template, reported as the update mode does, get, patch/<type> and
+// delete. The objects are never created by the run, nor deleted at the end.
+func (r *Runner) targetTick(seq int) {
+	ctx := r.context()
+	gvk := r.template.GroupVersionKind()
+
+	key, ok := r.targets.pick(gvk, r.random().Int())
+	if !ok {
+		r.logger.Info(fmt.Sprintf("no %s left to target", gvk.Kind))
+		return
+	}
+
+	switch r.targetVerbs[seq%len(r.targetVerbs)] {
+	case targetGet:
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+
+		if err := r.metrics.Time("get", func() error {
+			return r.Client.Get(ctx, key, obj)
+		}); err != nil {
+			r.logger.Error(err, fmt.Sprintf("failed to get %s", key))
+		}
+
+	case targetUpdate:
+		r.patchTick(ctx, key, "", seq)
+
+	case targetDelete:
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+		obj.SetNamespace(key.Namespace)
+		obj.SetName(key.Name)
+
+		if err := r.metrics.Time("delete", func() error {
+			return r.Client.Delete(ctx, obj)
+		}); err != nil && !k8serrors.IsNotFound(err) {
+			r.logger.Error(err, fmt.Sprintf("failed to delete %s", key))
+			return
+		}
+
+		r.targets.remove(gvk, key)
+	}
+}
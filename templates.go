@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// weightedTemplate is one of the templates of a run, along with its share of
+// the runners.
+type weightedTemplate struct {
+	// name is the lowercased kind, e.g. manifestwork, as used by -weights
+	name   string
+	path   string
+	weight int
+	obj    *unstructured.Unstructured
+	// classes are the update frequencies of the objects, see
+	// -update-classes
+	classes updateClasses
+	// lookups are the fields populated from the cluster
+	lookups []lookup
+}
+
+func loadTemplate(path string) (*unstructured.Unstructured, error) {
+	w := &unstructured.Unstructured{}
+
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template, error: %w", err)
+	}
+
+	if err := yaml.Unmarshal(dat, w); err != nil {
+		return nil, fmt.Errorf("failed to parse template, error: %w", err)
+	}
+
+	return w, nil
+}
+
+// loadTemplates loads the comma separated template paths, and weighs them
+// with "kind=weight,...", e.g. "manifestwork=70,secret=30". Without weights,
+// the templates share the runners evenly.
+func loadTemplates(paths, weights string) ([]weightedTemplate, error) {
+	out := []weightedTemplate{}
+
+	for _, path := range strings.Split(paths, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+
+		w, err := loadTemplate(path)
+		if err != nil {
+			return nil, err
+		}
+
+		name := strings.ToLower(w.GetKind())
+		for _, t := range out {
+			if t.name == name {
+				return nil, fmt.Errorf("templates %s and %s are both of kind %s", t.path, path, w.GetKind())
+			}
+		}
+
+		out = append(out, weightedTemplate{name: name, path: path, weight: 1, obj: w})
+	}
+
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no template given")
+	}
+
+	if weights == "" {
+		return out, nil
+	}
+
+	seen := map[string]bool{}
+	for _, item := range strings.Split(weights, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid weight %q, expecting kind=weight", item)
+		}
+
+		n, err := strconv.Atoi(kv[1])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid weight %q, it has to be a non negative integer", item)
+		}
+
+		found := false
+		for idx := range out {
+			if out[idx].name == strings.ToLower(kv[0]) {
+				out[idx].weight = n
+				found = true
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("weight %q doesn't match the kind of any template", item)
+		}
+
+		seen[strings.ToLower(kv[0])] = true
+	}
+
+	for _, t := range out {
+		if !seen[t.name] {
+			return nil, fmt.Errorf("template %s of kind %s has no weight", t.path, t.name)
+		}
+	}
+
+	return out, nil
+}
+
+// templateFor picks the template of runner idx, splitting the runners by the
+// template weights in order, like the identities.
+func templateFor(ts []weightedTemplate, idx, total int) int {
+	weights := make([]int, len(ts))
+	for i, t := range ts {
+		weights[i] = t.weight
+	}
+
+	return weightedIndex(weights, idx, total)
+}
+
+// templateMeta is the lightweight per-object part of a template: the runners
+// keep the metadata identifying their object, and share the immutable
+// template, since at 100k objects a full copy per runner takes gigabytes.
+func templateMeta(w *unstructured.Unstructured) *unstructured.Unstructured {
+	out := &unstructured.Unstructured{}
+	out.SetGroupVersionKind(w.GroupVersionKind())
+	out.SetName(w.GetName())
+	out.SetNamespace(w.GetNamespace())
+	out.SetLabels(w.GetLabels())
+
+	return out
+}
+
+// object builds the full object of the runner, the shared template with the
+// runner's metadata, for the requests sending the body.
+func (r *Runner) object() *unstructured.Unstructured {
+	out := r.shared.DeepCopy()
+	out.SetName(r.template.GetName())
+	out.SetNamespace(r.template.GetNamespace())
+	out.SetLabels(r.template.GetLabels())
+	// the runner's annotations, e.g. the tags, go over the template's
+	setAnnotations(out, r.template.GetAnnotations())
+
+	return out
+}
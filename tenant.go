@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// tenant is a group of clients sharing an identity, a set of namespaces and,
+// with a QPS, a client side rate limit, like the controllers of a team on a
+// shared hub.
+type tenant struct {
+	name       string
+	concurrent int
+	// qps is the limit of all the requests of the tenant, 0 leaves the
+	// clients to their own limits
+	qps float64
+	// limiter is shared by the clients of the tenant
+	limiter flowcontrol.RateLimiter
+}
+
+// tenantList is the repeatable -tenant flag, <name>=<concurrent>[:<qps>].
+type tenantList []*tenant
+
+func (l *tenantList) String() string {
+	out := []string{}
+	for _, t := range *l {
+		out = append(out, fmt.Sprintf("%s=%v:%v", t.name, t.concurrent, t.qps))
+	}
+
+	return strings.Join(out, ",")
+}
+
+func (l *tenantList) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return fmt.Errorf("invalid tenant %q, expecting <name>=<concurrent>[:<qps>]", s)
+	}
+
+	t := &tenant{name: strings.TrimSpace(parts[0])}
+	if errs := validation.IsDNS1123Label(t.name); len(errs) != 0 {
+		return fmt.Errorf("invalid name of tenant %q, it prefixes its namespaces, %s", s, strings.Join(errs, ", "))
+	}
+
+	values := strings.SplitN(parts[1], ":", 2)
+
+	n, err := strconv.Atoi(values[0])
+	if err != nil || n <= 0 {
+		return fmt.Errorf("invalid concurrent of tenant %q, it has to be a positive integer", s)
+	}
+
+	t.concurrent = n
+
+	if len(values) == 2 {
+		qps, err := strconv.ParseFloat(values[1], 64)
+		if err != nil || qps <= 0 {
+			return fmt.Errorf("invalid qps of tenant %q, it has to be positive", s)
+		}
+
+		t.qps = qps
+
+		burst := int(qps)
+		if burst < 1 {
+			burst = 1
+		}
+
+		t.limiter = flowcontrol.NewTokenBucketRateLimiter(float32(qps), burst)
+	}
+
+	for _, o := range *l {
+		if o.name == t.name {
+			return fmt.Errorf("tenant %s is given twice", t.name)
+		}
+	}
+
+	*l = append(*l, t)
+
+	return nil
+}
+
+func (l tenantList) concurrent() int {
+	total := 0
+	for _, t := range l {
+		total += t.concurrent
+	}
+
+	return total
+}
+
+// identities are the APF identities of the tenants, weighted by their clients
+// so identityFor splits the clients as the tenants do.
+func (l tenantList) identities() []apfIdentity {
+	out := []apfIdentity{}
+	for _, t := range l {
+		out = append(out, apfIdentity{name: t.name, weight: t.concurrent})
+	}
+
+	return out
+}
+
+func (l tenantList) names() []string {
+	out := []string{}
+	for _, t := range l {
+		out = append(out, t.name)
+	}
+
+	return out
+}
+
+// tenantFor returns the tenant of runner idx, the tenants take the runners in
+// order.
+func tenantFor(l tenantList, idx int) *tenant {
+	for _, t := range l {
+		if idx < t.concurrent {
+			return t
+		}
+
+		idx -= t.concurrent
+	}
+
+	return l[len(l)-1]
+}
+
+// namespacePrefix of the namespaces of the tenant, <prefix>-<tenant>, or
+// tenant-<tenant> without a namespace prefix.
+func (t *tenant) namespacePrefix(prefix string) string {
+	if prefix == "" {
+		prefix = "tenant"
+	}
+
+	return prefix + "-" + t.name
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+const (
+	httpVersion2  = "2"
+	httpVersion11 = "1.1"
+)
+
+// transportSettings pick the HTTP version of the clients, to quantify the
+// effects of multiplexing: with HTTP/2 all the requests of a client share a
+// connection, with HTTP/1.1 they open up to MaxConnsPerHost connections.
+type transportSettings struct {
+	httpVersion string
+	// strictMaxStreams queues the requests over the server's max concurrent
+	// streams instead of opening more connections
+	strictMaxStreams bool
+	// readIdleTimeout pings the connections idle for that long, 0 disables
+	// the health checks
+	readIdleTimeout time.Duration
+	// proxyURL takes precedence over the proxy-url of the kubeconfig and
+	// HTTPS_PROXY/NO_PROXY
+	proxyURL *url.URL
+	// tunnel replaces any proxy
+	tunnel *tunnel
+	// compression asks for gzip compressed responses
+	compression bool
+}
+
+func validateHTTPVersion(s string) error {
+	switch s {
+	case httpVersion2, httpVersion11:
+		return nil
+	}
+
+	return fmt.Errorf("unknown http version %q, expecting %s|%s", s, httpVersion2, httpVersion11)
+}
+
+func (s transportSettings) configure(t *http.Transport) error {
+	t.DisableCompression = !s.compression
+
+	if s.tunnel != nil {
+		t.Proxy = nil
+		t.DialContext = s.tunnel.dial
+	}
+
+	if s.httpVersion == httpVersion11 {
+		// a non nil empty map disables HTTP/2
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+
+		return nil
+	}
+
+	h2, err := http2.ConfigureTransports(t)
+	if err != nil {
+		return fmt.Errorf("failed to configure HTTP/2, error: %w", err)
+	}
+
+	h2.StrictMaxConcurrentStreams = s.strictMaxStreams
+	h2.ReadIdleTimeout = s.readIdleTimeout
+
+	return nil
+}
+
+func parseProxyURL(s string) (*url.URL, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url %q, error: %w", s, err)
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy url scheme %q, expecting http|https|socks5", u.Scheme)
+	}
+
+	return u, nil
+}
+
+// proxy is the proxy of the requests, -proxy-url, or the proxy-url of the
+// kubeconfig, or HTTPS_PROXY/NO_PROXY, the way the stock client picks it.
+func (s transportSettings) proxy(fromConfig func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	if s.proxyURL != nil {
+		return http.ProxyURL(s.proxyURL)
+	}
+
+	if fromConfig != nil {
+		return fromConfig
+	}
+
+	return http.ProxyFromEnvironment
+}
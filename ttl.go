@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// expired tells whether the runner's object outlived r.objectTTL.
+func (r *Runner) expired() bool {
+	return r.objectTTL > 0 && time.Since(r.createdAt) >= r.objectTTL
+}
+
+// recreate deletes the runner's object and creates it again under a new
+// name, keeping the object count constant while churning create/delete.
+func (r *Runner) recreate() {
+	ctx := r.context()
+
+	if err := r.metrics.Time("ttl/delete", func() error {
+		return r.Client.Delete(ctx, r.template.DeepCopy())
+	}); err != nil && !k8serrors.IsNotFound(err) {
+		r.logger.Error(err, fmt.Sprintf("failed to delete expired %s", r.getKey()))
+		return
+	}
+
+	r.state.remove(r.template)
+
+	r.generation += 1
+
+	r.template.SetName(fmt.Sprintf("%s-%v", r.baseName, r.generation))
+	r.managedFields = 0
+
+	if err := r.metrics.Time("ttl/create", r.create); err != nil {
+		r.logger.Error(err, fmt.Sprintf("failed to recreate %s", r.getKey()))
+	}
+
+	if r.waitReady != nil {
+		_ = r.waitFor(ctx, r.template.DeepCopy(), r.waitReady, "ttl/ready")
+	}
+
+	r.createdAt = time.Now()
+
+	if r.keys != nil {
+		r.keys.set(r.index, r.getKey())
+	}
+}
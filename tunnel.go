@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// tunnel dials the apiserver through the HTTP CONNECT mode of a konnectivity
+// (apiserver-network-proxy) server, over its unix socket or over mTLS, to load
+// the network proxy, the first bottleneck of hosted control planes.
+type tunnel struct {
+	// address is host:port, or unix:///path/to/konnectivity-server.socket
+	address string
+	tls     *tls.Config
+}
+
+func newTunnel(address, ca, cert, key string) (*tunnel, error) {
+	t := &tunnel{address: address}
+	if strings.HasPrefix(address, "unix://") {
+		return t, nil
+	}
+
+	if cert == "" || key == "" || ca == "" {
+		return nil, fmt.Errorf("a konnectivity server over tcp needs konnectivity-ca, konnectivity-cert and konnectivity-key")
+	}
+
+	pair, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the konnectivity client certificate, error: %w", err)
+	}
+
+	dat, err := ioutil.ReadFile(ca)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the konnectivity CA, error: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(dat) {
+		return nil, fmt.Errorf("no certificate in the konnectivity CA %s", ca)
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid konnectivity address %s, error: %w", address, err)
+	}
+
+	t.tls = &tls.Config{Certificates: []tls.Certificate{pair}, RootCAs: pool, ServerName: host}
+
+	return t, nil
+}
+
+// dial opens a connection to addr through the proxy server.
+func (t *tunnel) dial(ctx context.Context, _, addr string) (net.Conn, error) {
+	d := &net.Dialer{}
+
+	var conn net.Conn
+	var err error
+
+	if path := strings.TrimPrefix(t.address, "unix://"); path != t.address {
+		conn, err = d.DialContext(ctx, "unix", path)
+	} else {
+		conn, err = (&tls.Dialer{NetDialer: d, Config: t.tls}).DialContext(ctx, "tcp", t.address)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial the konnectivity server %s, error: %w", t.address, err)
+	}
+
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", addr, addr)
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read the CONNECT response of %s, error: %w", t.address, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("konnectivity server %s refused to connect to %s: %s", t.address, addr, resp.Status)
+	}
+
+	// the server doesn't speak before the client's TLS hello
+	if br.Buffered() != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected data after the CONNECT response of %s", t.address)
+	}
+
+	return conn, nil
+}
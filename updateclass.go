@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// updateClassesAnnotation on a template takes precedence over
+// -update-classes for the objects of the template, it's removed from the
+// objects.
+const updateClassesAnnotation = "load-simulator/update-classes"
+
+// updateClass is a share of the objects updated at their own interval.
+type updateClass struct {
+	percent  int
+	interval time.Duration
+}
+
+// updateClasses model the skewed updates of real fleets, where a few objects
+// change all the time and most of them rarely.
+type updateClasses []updateClass
+
+// parseUpdateClasses parses "<percent>%=<interval>,...", e.g.
+// "10%=1s,90%=5m", the percentages adding up to 100.
+func parseUpdateClasses(s string) (updateClasses, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	out := updateClasses{}
+	sum := 0
+
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || !strings.HasSuffix(kv[0], "%") {
+			return nil, fmt.Errorf("invalid update class %q, expecting <percent>%%=<interval>", item)
+		}
+
+		percent, err := strconv.Atoi(strings.TrimSuffix(kv[0], "%"))
+		if err != nil || percent < 0 {
+			return nil, fmt.Errorf("invalid update class %q, the percentage has to be a non negative integer", item)
+		}
+
+		interval, err := time.ParseDuration(kv[1])
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid update class %q, the interval has to be a positive duration, e.g. 5m", item)
+		}
+
+		out = append(out, updateClass{percent: percent, interval: interval})
+		sum += percent
+	}
+
+	if sum != 100 {
+		return nil, fmt.Errorf("the update classes %q add up to %v%%, not 100%%", s, sum)
+	}
+
+	return out, nil
+}
+
+// classFor picks the class of runner idx by the percentages. The runners are
+// scattered over the classes, since the templates and the identities split
+// them in order.
+func (c updateClasses) classFor(idx, total int) updateClass {
+	weights := make([]int, len(c))
+	for i, class := range c {
+		weights[i] = class.percent
+	}
+
+	return c[weightedIndex(weights, idx*spreadStep(total)%total, total)]
+}
+
+func (c updateClass) name() string {
+	return fmt.Sprintf("every-%v", c.interval)
+}
+
+// templateClasses takes the update classes of the template annotation out of
+// w, falling back to classes.
+func templateClasses(w *weightedTemplate, classes updateClasses) error {
+	annotations := w.obj.GetAnnotations()
+
+	s, ok := annotations[updateClassesAnnotation]
+	if !ok {
+		w.classes = classes
+		return nil
+	}
+
+	delete(annotations, updateClassesAnnotation)
+	w.obj.SetAnnotations(annotations)
+
+	c, err := parseUpdateClasses(s)
+	if err != nil {
+		return fmt.Errorf("invalid %s annotation of template %s, error: %w", updateClassesAnnotation, w.path, err)
+	}
+
+	w.classes = c
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+const defaultUserAgent = "load-simulator/{{.Version}}{{if .Identity}}/{{.Identity}}{{end}}/{{.RunID}}/runner-{{.Runner}}"
+
+// userAgentData is what the -user-agent template can refer to.
+type userAgentData struct {
+	RunID    string
+	Runner   string
+	Identity string
+	Version  string
+}
+
+func parseUserAgent(s string) (*template.Template, error) {
+	t, err := template.New("user-agent").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user agent template %q, error: %w", s, err)
+	}
+
+	// catch references to unknown fields early
+	if _, err := renderUserAgent(t, userAgentData{}); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func renderUserAgent(t *template.Template, data userAgentData) (string, error) {
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, data); err != nil {
+		return "", fmt.Errorf("failed to render user agent, error: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+func newRunID() string {
+	return fmt.Sprintf("run-%v", time.Now().Unix())
+}
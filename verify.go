@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// maxVerifyExamples is the number of the names of the objects updated too
+// few times the verification reports.
+const maxVerifyExamples = 10
+
+// VerifyReport tells whether the objects the run was expected to create
+// were there at the end of the load, and were updated often enough.
+type VerifyReport struct {
+	Expected int `json:"expected"`
+	Found    int `json:"found"`
+	Missing  int `json:"missing"`
+	// MinUpdates is the least number of updates of each object, counted by
+	// their load-simulator/seq annotation
+	MinUpdates   int      `json:"minUpdates,omitempty"`
+	UnderUpdated int      `json:"underUpdated,omitempty"`
+	Examples     []string `json:"examples,omitempty"`
+	Passed       bool     `json:"passed"`
+}
+
+// expectedObjects is the number of template objects the runners create, the
+// batch members included, up to max-objects.
+func (o *options) expectedObjects() int {
+	n := o.concurrent * o.batchSize
+	if o.maxObjects > 0 && o.maxObjects < n {
+		n = o.maxObjects
+	}
+
+	return n
+}
+
+// verifyObjects lists the objects of the run of the template kinds before the
+// runners delete them, the load being over, and compares them with what the
+// run was expected to create, over the clusters. With o.verifyMinUpdates,
+// each object has to be written at least that many times after its
+// creation, as told by its sequence, see stamp.
+func (o *options) verifyObjects(ctx context.Context, clusters []cluster, logger logr.Logger) (*VerifyReport, error) {
+	selector, err := o.runSelector()
+	if err != nil {
+		return nil, err
+	}
+
+	v := &VerifyReport{Expected: o.expectedObjects(), MinUpdates: o.verifyMinUpdates}
+	under := []string{}
+
+	start := time.Now()
+
+	for _, c := range clusters {
+		cl, err := client.New(c.config, client.Options{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create client, error: %w", err)
+		}
+
+		for _, gvk := range o.templateKinds() {
+			list := &unstructured.UnstructuredList{}
+			list.SetGroupVersionKind(gvk)
+
+			if err := cl.List(ctx, list, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+				return nil, fmt.Errorf("failed to list %s, error: %w", gvk.Kind, err)
+			}
+
+			for i := range list.Items {
+				obj := &list.Items[i]
+				if obj.GetDeletionTimestamp() != nil {
+					continue
+				}
+
+				v.Found += 1
+
+				if o.verifyMinUpdates == 0 {
+					continue
+				}
+
+				// the create is the first write
+				if seq, _, ok := parseStamp(obj); !ok || seq-1 < o.verifyMinUpdates {
+					name := fmt.Sprintf("%s %s", gvk.Kind, client.ObjectKeyFromObject(obj))
+					if c.hub != "" {
+						name = fmt.Sprintf("%s on hub %s", name, c.hub)
+					}
+
+					under = append(under, name)
+				}
+			}
+		}
+	}
+
+	sort.Strings(under)
+
+	if v.Found < v.Expected {
+		v.Missing = v.Expected - v.Found
+	}
+
+	v.UnderUpdated = len(under)
+	if len(under) > maxVerifyExamples {
+		under = under[:maxVerifyExamples]
+	}
+
+	v.Examples = under
+	v.Passed = v.Missing == 0 && v.UnderUpdated == 0
+
+	logger.Info(fmt.Sprintf("verified the objects in %v", time.Since(start).Round(time.Millisecond)))
+
+	return v, nil
+}
+
+func (v *VerifyReport) log(logger logr.Logger) {
+	if v.Passed {
+		logger.Info(fmt.Sprintf("object verification passed, %v/%v objects found, each updated at least %v times", v.Found, v.Expected, v.MinUpdates))
+		return
+	}
+
+	if v.MinUpdates == 0 {
+		logger.Error(fmt.Errorf("%v of %v objects missing", v.Missing, v.Expected), "object verification failed")
+		return
+	}
+
+	logger.Error(fmt.Errorf("%v of %v objects missing, %v updated less than %v times", v.Missing, v.Expected, v.UnderUpdated, v.MinUpdates), "object verification failed")
+
+	for _, name := range v.Examples {
+		logger.Info(fmt.Sprintf("updated less than %v times: %s", v.MinUpdates, name))
+	}
+}
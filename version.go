@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/go-logr/logr"
+)
+
+// set at build time, e.g.
+//
+//	go build -ldflags "-X main.gitCommit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	gitCommit = ""
+	buildDate = "unknown"
+)
+
+// simulatorVersion is the git commit the binary was built from, or the
+// version of the module without it.
+func simulatorVersion() string {
+	if gitCommit != "" {
+		return gitCommit
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	return info.Main.Version
+}
+
+func versionCommand(args []string, logger logr.Logger) error {
+	fmt.Printf("load-simulator %s, built %s with %s\n", simulatorVersion(), buildDate, runtime.Version())
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// waitPoll is the interval between the gets of a wait.
+const waitPoll = 500 * time.Millisecond
+
+// waitExpr is a JSONPath expression on an object, optionally compared to a
+// value, e.g. ".status.phase == Bound", ".status.phase != Pending", or
+// ".status.readyReplicas" which holds once the field is set, to anything but
+// false or 0.
+type waitExpr struct {
+	raw   string
+	path  *jsonpath.JSONPath
+	op    string
+	value string
+}
+
+func (w *waitExpr) String() string {
+	return w.raw
+}
+
+// parseWaitExpr parses "<JSONPath> [==|!= <value>]", the path with or
+// without the braces, e.g. {.status.conditions[?(@.type=="Ready")].status} == True.
+func parseWaitExpr(s string) (*waitExpr, error) {
+	w := &waitExpr{raw: strings.TrimSpace(s)}
+	path := w.raw
+
+	for _, op := range []string{" == ", " != "} {
+		if i := strings.LastIndex(w.raw, op); i != -1 {
+			path, w.op, w.value = strings.TrimSpace(w.raw[:i]), strings.TrimSpace(op), strings.TrimSpace(w.raw[i+len(op):])
+			break
+		}
+	}
+
+	if path == "" {
+		return nil, fmt.Errorf("the wait expression %q has no JSONPath", s)
+	}
+
+	if !strings.HasPrefix(path, "{") {
+		path = "{" + path + "}"
+	}
+
+	w.path = jsonpath.New("wait").AllowMissingKeys(true)
+	if err := w.path.Parse(path); err != nil {
+		return nil, fmt.Errorf("invalid JSONPath of the wait expression %q, error: %w", s, err)
+	}
+
+	return w, nil
+}
+
+// conditionExpr waits for the status condition t to be True.
+func conditionExpr(t string) *waitExpr {
+	w, _ := parseWaitExpr(fmt.Sprintf(`{.status.conditions[?(@.type=="%s")].status} == True`, t))
+	w.raw = t
+
+	return w
+}
+
+// holds evaluates the expression on obj, == holds when one of the values of
+// the path is the value, != when none is.
+func (w *waitExpr) holds(obj *unstructured.Unstructured) (bool, error) {
+	results, err := w.path.FindResults(obj.Object)
+	if err != nil {
+		return false, err
+	}
+
+	values := []string{}
+	for _, res := range results {
+		for _, v := range res {
+			values = append(values, fmt.Sprint(v.Interface()))
+		}
+	}
+
+	switch w.op {
+	case "==":
+		return hasString(values, w.value), nil
+	case "!=":
+		return !hasString(values, w.value), nil
+	}
+
+	for _, v := range values {
+		if v != "" && v != "false" && v != "0" {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func hasString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// waitFor gets obj every waitPoll until the expression holds, for at most
+// r.waitTimeout, obj is updated with the last read. The time until it holds,
+// or the timeout, is reported as op.
+func (r *Runner) waitFor(ctx context.Context, obj *unstructured.Unstructured, w *waitExpr, op string) error {
+	start := time.Now()
+	err := r.poll(ctx, obj, w)
+	r.metrics.Observe(op, time.Since(start), err)
+
+	return err
+}
+
+func (r *Runner) poll(ctx context.Context, obj *unstructured.Unstructured, w *waitExpr) error {
+	deadline := time.Now().Add(r.waitTimeout)
+	key := types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}
+
+	for {
+		if err := r.Client.Get(ctx, key, obj); err != nil {
+			return err
+		}
+
+		ok, err := w.holds(obj)
+		if err != nil {
+			return fmt.Errorf("failed to evaluate %q on %s, error: %w", w, key, err)
+		}
+
+		if ok {
+			return nil
+		}
+
+		// a long wait isn't a stuck runner
+		r.beat()
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%q doesn't hold on %s after %v", w, key, r.waitTimeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(waitPoll):
+		}
+	}
+}
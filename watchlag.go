@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// writtenAtAnnotation is set by the watch-lag writer to the time of the write.
+const writtenAtAnnotation = "load-simulator/written-at"
+
+// errWatchStale marks a watch which hasn't seen a write for longer than
+// -watch-stale-after.
+var errWatchStale = errors.New("watch fell behind")
+
+// watchProgress tracks how far the watch of a runner is behind its writes by
+// resourceVersion. The events and the bookmarks both move the watch forward,
+// so a watch which silently stops getting either shows up as stale even
+// though it's still open.
+type watchProgress struct {
+	mu sync.Mutex
+	// pending are the writes the watch hasn't seen yet, oldest first
+	pending      []pendingWrite
+	seen         int64
+	lastBookmark time.Time
+	bookmarks    int
+	stale        bool
+}
+
+type pendingWrite struct {
+	rv int64
+	at time.Time
+}
+
+func (p *watchProgress) written(rv string, at time.Time) {
+	n, err := strconv.ParseInt(rv, 10, 64)
+	if err != nil {
+		// the resourceVersion is opaque, the apiserver doesn't have to
+		// give a number
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if n > p.seen {
+		p.pending = append(p.pending, pendingWrite{rv: n, at: at})
+	}
+}
+
+// caughtUp tells whether the watch has seen all the writes.
+func (p *watchProgress) caughtUp() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.pending) == 0
+}
+
+func (p *watchProgress) observed(rv string) {
+	n, err := strconv.ParseInt(rv, 10, 64)
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if n > p.seen {
+		p.seen = n
+	}
+
+	i := 0
+	for i < len(p.pending) && p.pending[i].rv <= p.seen {
+		i++
+	}
+
+	p.pending = p.pending[i:]
+}
+
+// bookmark records a bookmark and returns the time since the previous one,
+// 0 for the first one.
+func (p *watchProgress) bookmark(now time.Time) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	since := time.Duration(0)
+	if !p.lastBookmark.IsZero() {
+		since = now.Sub(p.lastBookmark)
+	}
+
+	p.lastBookmark = now
+	p.bookmarks++
+
+	return since
+}
+
+// staleness is how long the oldest write the watch hasn't seen is waiting,
+// and whether the watch just crossed the limit.
+func (p *watchProgress) staleness(now time.Time, limit time.Duration) (time.Duration, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.pending) == 0 {
+		p.stale = false
+		return 0, false
+	}
+
+	d := now.Sub(p.pending[0].at)
+	if d < limit {
+		p.stale = false
+		return d, false
+	}
+
+	crossed := !p.stale
+	p.stale = true
+
+	return d, crossed
+}
+
+// watchLagSetup creates the object and starts watching it, each event is
+// timed against the write it carries.
+func (r *Runner) watchLagSetup() error {
+	if err := r.create(); err != nil {
+		return err
+	}
+
+	wc, err := client.NewWithWatch(r.config, client.Options{})
+	if err != nil {
+		return fmt.Errorf("failed to create watch client, error: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(r.context())
+	r.watchCancel = cancel
+	r.watchProgress = &watchProgress{}
+
+	// the writes of the mode are always stamped, the watch checks their
+	// sequence, which a restarted runner picks up from the object
+	if r.stamps == nil {
+		WithStampWrites(true)(r)
+	}
+
+	current := r.template.DeepCopy()
+	if err := r.Client.Get(ctx, r.getKey(), current); err == nil {
+		if seq, _, ok := parseStamp(current); ok {
+			r.stamped(r.getKey().String(), seq)
+		}
+	}
+
+	var restarts <-chan *restartStorm
+	if r.watchRestarts != nil {
+		restarts = r.watchRestarts.register(r.index)
+	}
+
+	go r.watchLag(ctx, wc, restarts)
+
+	return nil
+}
+
+// watchLag watches the runner's object until ctx is done, re-opening the
+// watch when the apiserver closes it. The watch asks for bookmarks, the time
+// between them is reported as watch-lag/bookmark-interval. A restart from
+// restarts drops the watch and relists, until the watch caught up again.
+func (r *Runner) watchLag(ctx context.Context, wc client.WithWatch, restarts <-chan *restartStorm) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(r.template.GroupVersionKind())
+
+	opts := []client.ListOption{
+		client.InNamespace(r.template.GetNamespace()),
+		client.MatchingFieldsSelector{Selector: fields.OneTermEqualSelector("metadata.name", r.template.GetName())},
+		&client.ListOptions{Raw: &metav1.ListOptions{AllowWatchBookmarks: true}},
+	}
+
+	watchOpts := opts
+
+	// storm is the restart the watch is recovering from, until it catches up
+	// with the writes
+	var storm *restartStorm
+
+	settle := func() {
+		if storm != nil && r.watchProgress.caughtUp() {
+			r.metrics.Observe("watch-restart/reconverge", time.Since(storm.start), nil)
+			storm.reconverged()
+			storm = nil
+		}
+	}
+
+	for ctx.Err() == nil {
+		w, err := wc.Watch(ctx, list, watchOpts...)
+		if err != nil {
+			r.metrics.Observe("watch-lag/watch", 0, err)
+			time.Sleep(time.Second)
+
+			continue
+		}
+
+		watchOpts = opts
+
+		restarted := false
+		for !restarted {
+			var ev watch.Event
+			var ok bool
+
+			select {
+			case ev, ok = <-w.ResultChan():
+			case s := <-restarts:
+				// the previous storm doesn't wait for this watch anymore
+				if storm != nil {
+					storm.reconverged()
+				}
+
+				storm, restarted = s, true
+
+				continue
+			}
+
+			if !ok {
+				break
+			}
+
+			r.watchEvent(ev)
+			settle()
+		}
+
+		w.Stop()
+
+		if !restarted {
+			continue
+		}
+
+		// like an informer, relist before watching again from the list
+		rv, err := r.relist(ctx, wc)
+		if err != nil {
+			r.logger.Error(err, "failed to relist after the watch restart")
+			continue
+		}
+
+		settle()
+
+		watchOpts = append(opts, &client.ListOptions{Raw: &metav1.ListOptions{AllowWatchBookmarks: true, ResourceVersion: rv}})
+	}
+}
+
+// relist lists the objects of the runner's kind in its namespace, the way
+// an informer restarting its watch does, and returns the resourceVersion to
+// watch from.
+func (r *Runner) relist(ctx context.Context, wc client.WithWatch) (string, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(r.template.GroupVersionKind())
+
+	if err := r.metrics.Time("watch-restart/relist", func() error {
+		return wc.List(ctx, list, client.InNamespace(r.template.GetNamespace()))
+	}); err != nil {
+		return "", err
+	}
+
+	for i := range list.Items {
+		if list.Items[i].GetName() == r.template.GetName() {
+			r.watchProgress.observed(list.Items[i].GetResourceVersion())
+
+			if seq, _, ok := parseStamp(&list.Items[i]); ok {
+				r.watchLastSeq = seq
+
+				if r.watchSequence != nil {
+					r.watchSequence.resync(r.getKey().String(), seq)
+				}
+			}
+		}
+	}
+
+	return list.GetResourceVersion(), nil
+}
+
+func (r *Runner) watchEvent(ev watch.Event) {
+	obj, ok := ev.Object.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	r.watchProgress.observed(obj.GetResourceVersion())
+
+	if ev.Type == watch.Bookmark {
+		if since := r.watchProgress.bookmark(time.Now()); since > 0 {
+			r.metrics.Observe("watch-lag/bookmark-interval", since, nil)
+		}
+
+		return
+	}
+
+	if ev.Type != watch.Added && ev.Type != watch.Modified {
+		return
+	}
+
+	seq, writtenAt, ok := parseStamp(obj)
+	if !ok {
+		return
+	}
+
+	r.checkSequence(ev.Type, r.getKey().String(), seq)
+
+	// a watch opened again starts with an Added event of the object as it
+	// was written a while ago, only the writes newer than the last one seen
+	// tell the lag
+	newer := seq > r.watchLastSeq
+	if newer {
+		r.watchLastSeq = seq
+	}
+
+	if ev.Type != watch.Modified || !newer {
+		return
+	}
+
+	r.metrics.Observe("watch-lag/event", time.Since(writtenAt), nil)
+}
+
+// checkSequence follows the sequence of the writes in the events of the
+// watch, logging the writes it missed, got twice or out of order. A watch
+// opened again without a resourceVersion starts with the current object,
+// the Added events only resync the sequence.
+func (r *Runner) checkSequence(t watch.EventType, key string, seq int) {
+	if r.watchSequence == nil {
+		return
+	}
+
+	if t == watch.Added {
+		r.watchSequence.resync(key, seq)
+		return
+	}
+
+	switch r.watchSequence.observe(key, seq) {
+	case seqLost:
+		r.logger.Info(fmt.Sprintf("the watch of %s missed the writes before %v", key, seq))
+	case seqRepeated:
+		r.logger.Info(fmt.Sprintf("the watch of %s got the write %v twice", key, seq))
+	case seqReordered:
+		r.logger.Info(fmt.Sprintf("the watch of %s got the write %v out of order", key, seq))
+	}
+}
+
+// watchLagTick stamps the object with the time of the write, and checks how
+// far the watch is behind the writes. The staleness is recorded on every tick
+// as watch-lag/staleness, a watch behind for longer than r.watchStaleAfter is
+// flagged once as watch-lag/stale until it catches up.
+func (r *Runner) watchLagTick(seq int) {
+	now := time.Now()
+	annotations, stamp := r.stamp(r.getKey().String(), nil)
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+	})
+	if err != nil {
+		r.logger.Error(err, "failed to marshal the stamp")
+		return
+	}
+
+	obj := r.template.DeepCopy()
+	if err := r.metrics.Time("watch-lag/patch", func() error {
+		return r.Client.Patch(r.context(), obj, client.RawPatch(types.MergePatchType, patch))
+	}); err != nil {
+		r.logger.Error(err, fmt.Sprintf("failed to stamp %s", r.getKey()))
+	} else {
+		r.stamped(r.getKey().String(), stamp)
+		r.watchProgress.written(obj.GetResourceVersion(), now)
+	}
+
+	staleness, crossed := r.watchProgress.staleness(time.Now(), r.watchStaleAfter)
+	r.metrics.Observe("watch-lag/staleness", staleness, nil)
+
+	if crossed {
+		r.metrics.Observe("watch-lag/stale", staleness, errWatchStale)
+		r.logger.Error(errWatchStale, fmt.Sprintf("the watch of %s hasn't seen the writes of the last %v", r.getKey(), staleness.Round(time.Second)))
+	}
+}
+
+func (r *Runner) watchLagTeardown() {
+	if r.watchCancel != nil {
+		r.watchCancel()
+	}
+
+	if r.watchRestarts != nil {
+		r.watchRestarts.unregister(r.index)
+	}
+
+	if p := r.watchProgress; p != nil {
+		p.mu.Lock()
+		if p.bookmarks == 0 {
+			r.logger.Info(fmt.Sprintf("the watch of %s didn't get any bookmark", r.getKey()))
+		}
+		p.mu.Unlock()
+	}
+
+	r.delete()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// watchRestarts restarts a fraction of the watches of the watch-lag mode at
+// once, the way an apiserver rollout drops them. Each restarted watch relists
+// then watches again, the storm is over once all of them caught up with the
+// writes.
+type watchRestarts struct {
+	fraction float64
+	// at is the time of the first storm since the start of the run, every
+	// repeats it, 0 only restarts once
+	at    time.Duration
+	every time.Duration
+
+	mu   sync.Mutex
+	subs map[int]chan *restartStorm
+}
+
+// restartStorm counts the restarted watches which didn't reconverge yet.
+type restartStorm struct {
+	start     time.Time
+	remaining int32
+	metrics   *Metrics
+}
+
+func newWatchRestarts(fraction float64, at, every time.Duration) *watchRestarts {
+	if fraction <= 0 {
+		return nil
+	}
+
+	return &watchRestarts{fraction: fraction, at: at, every: every, subs: map[int]chan *restartStorm{}}
+}
+
+func (w *watchRestarts) register(idx int) <-chan *restartStorm {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ch := make(chan *restartStorm, 1)
+	w.subs[idx] = ch
+
+	return ch
+}
+
+func (w *watchRestarts) unregister(idx int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.subs, idx)
+}
+
+// run triggers the storms until stop.
+func (w *watchRestarts) run(metrics *Metrics, logger logr.Logger, stop <-chan struct{}, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		timer := time.NewTimer(w.at)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-timer.C:
+			}
+
+			n := w.trigger(metrics)
+			logger.Info(fmt.Sprintf("restarted %v watches", n))
+
+			if w.every <= 0 {
+				return
+			}
+
+			timer.Reset(w.every)
+		}
+	}()
+}
+
+// trigger signals a random fraction of the registered watches and returns how
+// many.
+func (w *watchRestarts) trigger(metrics *Metrics) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	subs := []chan *restartStorm{}
+	for _, ch := range w.subs {
+		subs = append(subs, ch)
+	}
+
+	n := int(math.Ceil(w.fraction * float64(len(subs))))
+	if n == 0 {
+		return 0
+	}
+
+	storm := &restartStorm{start: time.Now(), remaining: int32(n), metrics: metrics}
+
+	for _, i := range rand.Perm(len(subs))[:n] {
+		select {
+		case subs[i] <- storm:
+		default:
+			// still restarting from the previous storm
+			storm.reconverged()
+		}
+	}
+
+	return n
+}
+
+// reconverged records the storm once its last watch caught up.
+func (s *restartStorm) reconverged() {
+	if atomic.AddInt32(&s.remaining, -1) == 0 {
+		s.metrics.Observe("watch-restart/storm", time.Since(s.start), nil)
+	}
+}
+
+func validateWatchRestarts(fraction float64, at, every int) error {
+	if fraction < 0 || fraction > 1 {
+		return fmt.Errorf("watch-restart-fraction has to be between 0 and 1, got %v", fraction)
+	}
+
+	if at < 0 || every < 0 {
+		return fmt.Errorf("watch-restart-at and watch-restart-every can't be negative")
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	admissionv1 "k8s.io/api/admissionregistration/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	restclient "k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	webhookDurationMetric = "apiserver_admission_webhook_admission_duration_seconds"
+	webhookOp             = "webhook/dry-run-create"
+)
+
+// webhookTick dry-run creates a copy of the template under a new name, the
+// request goes through the whole admission chain, including the webhooks,
+// without being persisted.
+func (r *Runner) webhookTick(seq int) {
+	obj := r.object()
+	obj.SetName(fmt.Sprintf("%s-%v", r.template.GetName(), seq))
+	obj.SetResourceVersion("")
+
+	if err := r.metrics.Time(webhookOp, func() error {
+		return r.Client.Create(r.context(), obj, client.DryRunAll)
+	}); err != nil && !k8serrors.IsAlreadyExists(err) {
+		r.logger.Error(err, fmt.Sprintf("failed to dry-run create %s", r.getKey()))
+	}
+}
+
+// webhookProbe attributes the client side latency to the webhooks of a
+// ValidatingWebhookConfiguration, by diffing the apiserver webhook admission
+// duration histogram before and after the run.
+type webhookProbe struct {
+	config   *restclient.Config
+	webhooks []string
+	before   []sample
+}
+
+func newWebhookProbe(ctx context.Context, config *restclient.Config, name string) (*webhookProbe, error) {
+	cl, err := client.New(config, client.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client, error: %w", err)
+	}
+
+	vwc := &admissionv1.ValidatingWebhookConfiguration{}
+	if err := cl.Get(ctx, types.NamespacedName{Name: name}, vwc); err != nil {
+		return nil, fmt.Errorf("failed to get ValidatingWebhookConfiguration %s, error: %w", name, err)
+	}
+
+	p := &webhookProbe{config: config}
+	for _, w := range vwc.Webhooks {
+		p.webhooks = append(p.webhooks, w.Name)
+	}
+
+	// it's fine to run without the histogram, e.g. when the user can't read
+	// /metrics, we'll only report the client side latency then
+	p.before, _ = scrapeAPIServer(ctx, config, webhookDurationMetric+"_sum", webhookDurationMetric+"_count")
+
+	return p, nil
+}
+
+func (p *webhookProbe) report(ctx context.Context, logger logr.Logger, metrics *Metrics) {
+	after, err := scrapeAPIServer(ctx, p.config, webhookDurationMetric+"_sum", webhookDurationMetric+"_count")
+	if err != nil {
+		logger.Error(err, "failed to scrape webhook admission duration, only client side latency is available")
+		return
+	}
+
+	// the ops are prefixed with their scope, e.g. the identity or the hub,
+	// the client latency is the mean over the scopes
+	var total time.Duration
+	count := 0
+	for _, s := range metrics.Summary() {
+		if s.Op[strings.LastIndex(s.Op, ":")+1:] == webhookOp {
+			total += s.Mean * time.Duration(s.Count)
+			count += s.Count
+		}
+	}
+
+	var client time.Duration
+	if count > 0 {
+		client = total / time.Duration(count)
+	}
+
+	for _, name := range p.webhooks {
+		labels := map[string]string{"name": name, "type": "validating"}
+
+		sum := sumSamples(after, webhookDurationMetric+"_sum", labels) - sumSamples(p.before, webhookDurationMetric+"_sum", labels)
+		cnt := sumSamples(after, webhookDurationMetric+"_count", labels) - sumSamples(p.before, webhookDurationMetric+"_count", labels)
+
+		if cnt <= 0 {
+			logger.Info(fmt.Sprintf("webhook %s: no admission observed during the run", name))
+			continue
+		}
+
+		mean := time.Duration(sum / cnt * float64(time.Second))
+
+		share := 0.0
+		if client > 0 {
+			share = float64(mean) / float64(client) * 100
+		}
+
+		logger.Info(fmt.Sprintf("webhook %s: calls=%v mean=%v, %.1f%% of the mean client latency %v", name, cnt, mean, share, client))
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const workPayloadPrefix = "load-simulator-payload"
+
+// workPayload replaces the manifests of the ManifestWork templates with
+// generated ConfigMaps, since the shape of the payload drives both the hub
+// storage and the apply cost on the spoke.
+type workPayload struct {
+	// manifests is the number of ConfigMaps of each work, 0 keeps the
+	// manifests of the template
+	manifests int
+	// bytes is the size of the data of each ConfigMap
+	bytes int
+}
+
+func (p workPayload) apply(w *weightedTemplate) error {
+	if p.manifests == 0 || w.obj.GetKind() != "ManifestWork" {
+		return nil
+	}
+
+	payload := strings.Repeat("x", p.bytes)
+
+	manifests := make([]interface{}, p.manifests)
+	for i := range manifests {
+		manifests[i] = map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata": map[string]interface{}{
+				"name":      fmt.Sprintf("%s-%v", workPayloadPrefix, i),
+				"namespace": "default",
+			},
+			"data": map[string]interface{}{
+				"payload": payload,
+			},
+		}
+	}
+
+	if err := unstructured.SetNestedSlice(w.obj.Object, manifests, "spec", "workload", "manifests"); err != nil {
+		return fmt.Errorf("failed to set the manifests of template %s, error: %w", w.path, err)
+	}
+
+	return nil
+}
+
+// WithDistinctManifests suffixes the names of the resources of the
+// ManifestWorks with the name of their work, see suffixManifests.
+func WithDistinctManifests(distinct bool) Option {
+	return func(r *Runner) {
+		r.distinctManifests = r.distinctManifests || distinct
+	}
+}
+
+// suffixManifests suffixes the names of the resources of the ManifestWork
+// with its name, so the works don't apply the same resources on the managed
+// cluster, and each of them waits for its own ones on the spoke instead of
+// finding them as soon as the first work is applied.
+func (r *Runner) suffixManifests(work *unstructured.Unstructured) {
+	if !r.distinctManifests || work.GetKind() != "ManifestWork" {
+		return
+	}
+
+	items, _, _ := unstructured.NestedSlice(work.Object, "spec", "workload", "manifests")
+	if len(items) == 0 {
+		return
+	}
+
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); ok {
+			obj := &unstructured.Unstructured{Object: m}
+			obj.SetName(fmt.Sprintf("%s-%s", obj.GetName(), work.GetName()))
+		}
+	}
+
+	_ = unstructured.SetNestedSlice(work.Object, items, "spec", "workload", "manifests")
+}